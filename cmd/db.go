@@ -0,0 +1,280 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/zhihu/norm"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	targetFlag     = "to"
+	stepsFlag      = "steps"
+	partitionsFlag = "partitions"
+	replicasFlag   = "replicas"
+	vidLengthFlag  = "vid-length"
+	yesFlag        = "yes"
+	refreshFlag    = "refresh"
+)
+
+// dbCmd represents the db command
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database space and schema",
+}
+
+func printTable(table [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, row := range table {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// spaceName returns the space in args, or the configured space.
+func spaceName(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return config.GetConfig().DbSpace
+}
+
+// activeSpaceName returns the space in args, or the space the service uses, which is
+// the configured space until a blue/green switch.
+func activeSpaceName(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return database.ActiveSpace(config.GetConfig())
+}
+
+// activeDb connects to the space the service uses.
+func activeDb() (*norm.DB, error) {
+	space, err := activeSpaceName(nil)
+	if err != nil {
+		return nil, err
+	}
+	return database.NewDbForSpace(config.GetConfig(), space)
+}
+
+var dbCreateSpaceCmd = &cobra.Command{
+	Use:   "create-space [space]",
+	Short: "Create the configured space or the given space",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := config.GetConfig()
+		opts := database.SpaceOptionsFromConfig(conf)
+		if cmd.Flags().Changed(partitionsFlag) {
+			opts.Partitions, _ = cmd.Flags().GetInt(partitionsFlag)
+		}
+		if cmd.Flags().Changed(replicasFlag) {
+			opts.Replicas, _ = cmd.Flags().GetInt(replicasFlag)
+		}
+		if cmd.Flags().Changed(vidLengthFlag) {
+			opts.VidLength, _ = cmd.Flags().GetInt(vidLengthFlag)
+		}
+		db, err := database.NewSpaceDb(conf)
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer db.Close()
+		name := spaceName(args)
+		if err = database.CreateSpace(db, name, opts, time.Duration(conf.DbHeartbeat)*time.Second); err != nil {
+			log.Errorf("create space %s failed with err:(%s)", name, err)
+		} else {
+			log.Infof("create space %s finished", name)
+		}
+	},
+}
+
+var dbDropSpaceCmd = &cobra.Command{
+	Use:   "drop-space [space]",
+	Short: "Drop the configured space or the given space with all its data",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := spaceName(args)
+		if yes, _ := cmd.Flags().GetBool(yesFlag); !yes {
+			log.Errorf("drop space %s deletes all its data, confirm with --%s", name, yesFlag)
+			return
+		}
+		db, err := database.NewSpaceDb(config.GetConfig())
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer db.Close()
+		if err = database.DropSpace(db, name); err != nil {
+			log.Errorf("drop space %s failed with err:(%s)", name, err)
+		} else {
+			log.Infof("drop space %s finished", name)
+		}
+	},
+}
+
+var dbDescribeCmd = &cobra.Command{
+	Use:   "describe [space]",
+	Short: "Describe the active space or the given space",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		space, err := activeSpaceName(args)
+		if err != nil {
+			log.Errorf("get active space failed with err:(%s)", err)
+			return
+		}
+		db, err := database.NewSpaceDb(config.GetConfig())
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer db.Close()
+		table, err := database.DescribeSpace(db, space)
+		if err != nil {
+			log.Errorf("describe space failed with err:(%s)", err)
+			return
+		}
+		printTable(table)
+	},
+}
+
+var dbStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the vertex and edge statistics of the active space",
+	Run: func(cmd *cobra.Command, args []string) {
+		refresh, _ := cmd.Flags().GetBool(refreshFlag)
+		db, err := activeDb()
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer db.Close()
+		table, err := database.SpaceStats(db, refresh)
+		if err != nil {
+			log.Errorf("get space stats failed with err:(%s)", err)
+			return
+		}
+		printTable(table)
+	},
+}
+
+// newMigrator returns the migrator of the active space and the closer of its connection.
+func newMigrator() (*database.Migrator, func(), error) {
+	conf := config.GetConfig()
+	db, err := activeDb()
+	if err != nil {
+		return nil, nil, err
+	}
+	return database.NewMigrator(db, time.Duration(conf.DbHeartbeat)*time.Second), db.Close, nil
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the schema to the latest or a given version",
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _ := cmd.Flags().GetInt(targetFlag)
+		if target < 0 {
+			target = database.LatestVersion()
+		}
+		migrator, closer, err := newMigrator()
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer closer()
+		if err := migrator.Migrate(target); err != nil {
+			log.Errorf("migrate schema failed with err:(%s)", err)
+		} else {
+			log.Infof("migrate schema to version %d finished", target)
+		}
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the schema version and the pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		migrator, closer, err := newMigrator()
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer closer()
+		version, err := migrator.Version()
+		if err != nil {
+			log.Errorf("get schema version failed with err:(%s)", err)
+			return
+		}
+		fmt.Printf("schema version: %d, latest version: %d\n", version, database.LatestVersion())
+		for _, migration := range database.Migrations {
+			state := "pending"
+			if migration.Version <= version {
+				state = "applied"
+			}
+			fmt.Printf("%4d  %-8s  %s\n", migration.Version, state, migration.Name)
+		}
+	},
+}
+
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Rollback the last applied migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		steps, _ := cmd.Flags().GetInt(stepsFlag)
+		migrator, closer, err := newMigrator()
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer closer()
+		if err := migrator.Rollback(steps); err != nil {
+			log.Errorf("rollback schema failed with err:(%s)", err)
+		} else {
+			log.Infof("rollback %d migrations finished", steps)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbRollbackCmd)
+	dbCmd.AddCommand(dbCreateSpaceCmd)
+	dbCmd.AddCommand(dbDropSpaceCmd)
+	dbCmd.AddCommand(dbDescribeCmd)
+	dbCmd.AddCommand(dbStatsCmd)
+	dbMigrateCmd.Flags().Int(targetFlag, -1, "target schema version, default is the latest version")
+	dbRollbackCmd.Flags().Int(stepsFlag, 1, "count of migrations to rollback")
+	dbCreateSpaceCmd.Flags().Int(partitionsFlag, database.DefaultPartitions, "partition count of the space")
+	dbCreateSpaceCmd.Flags().Int(replicasFlag, database.DefaultReplicas, "replica factor of the space")
+	dbCreateSpaceCmd.Flags().Int(vidLengthFlag, database.DefaultVidLength, "length of the fixed string vid")
+	dbDropSpaceCmd.Flags().Bool(yesFlag, false, "confirm to drop the space")
+	dbStatsCmd.Flags().Bool(refreshFlag, false, "run a stats job before showing the statistics")
+}
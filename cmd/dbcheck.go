@@ -0,0 +1,89 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+	"strconv"
+)
+
+const (
+	repairFlag  = "repair"
+	verboseFlag = "verbose"
+)
+
+var dbCheckCmd = &cobra.Command{
+	Use:   "check [space]",
+	Short: "Check the pair edges for wrong ranks, duplicates and missing reverse edges",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repair, _ := cmd.Flags().GetBool(repairFlag)
+		verbose, _ := cmd.Flags().GetBool(verboseFlag)
+		space, err := activeSpaceName(args)
+		if err != nil {
+			log.Errorf("get active space failed with err:(%s)", err)
+			return
+		}
+		db, err := database.NewDbForSpace(config.GetConfig(), space)
+		if err != nil {
+			log.Errorf("connect space %s failed with err:(%s)", space, err)
+			return
+		}
+		defer db.Close()
+		report, err := database.CheckEdges(db)
+		if err != nil {
+			log.Errorf("check edges failed with err:(%s)", err)
+			return
+		}
+		if verbose && len(report.Issues) > 0 {
+			table := [][]string{{"issue", "src", "dst", "rank", "dex", "pair"}}
+			for _, issue := range report.Issues {
+				p := issue.Pair
+				table = append(table, []string{issue.Kind, fmt.Sprint(p.Src), fmt.Sprint(p.Dst), strconv.Itoa(p.Rank), p.DexName, p.PairAddress})
+			}
+			printTable(table)
+		}
+		fmt.Printf("edges: %d, %s: %d, %s: %d, %s: %d, %s: %d\n", report.Edges,
+			database.IssueWrongRank, report.Count(database.IssueWrongRank),
+			database.IssueDuplicate, report.Count(database.IssueDuplicate),
+			database.IssueMissingReverse, report.Count(database.IssueMissingReverse),
+			database.IssueCollision, report.Count(database.IssueCollision))
+		if !repair || len(report.Issues) == 0 {
+			return
+		}
+		if err = database.RepairEdges(db, report); err != nil {
+			log.Errorf("repair edges failed with err:(%s)", err)
+		} else {
+			log.Infof("repair edges of space %s finished", space)
+		}
+	},
+}
+
+func init() {
+	dbCmd.AddCommand(dbCheckCmd)
+	dbCheckCmd.Flags().Bool(repairFlag, false, "repair the issues found")
+	dbCheckCmd.Flags().BoolP(verboseFlag, "v", false, "list every issue found")
+}
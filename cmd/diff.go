@@ -0,0 +1,185 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/dataset"
+	"github.com/xueqianLu/routegen/log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	thresholdFlag = "threshold"
+	planFlag      = "plan"
+
+	// liveDataset is the dataset of the configured store, space:<name> is the dataset of a nebula space.
+	liveDataset = "live"
+	spacePrefix = "space:"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old> <new>",
+	Short: "Compare two datasets, each is comma separated pair files or snapshots, live or space:<name>",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		threshold, _ := cmd.Flags().GetFloat64(thresholdFlag)
+		format, _ := cmd.Flags().GetString(formatFlag)
+		planFile, _ := cmd.Flags().GetString(planFlag)
+		verbose, _ := cmd.Flags().GetBool(verboseFlag)
+		if format != outputTable && format != outputJSON {
+			log.Errorf("unknown diff format (%s), want %s or %s", format, outputTable, outputJSON)
+			return
+		}
+		conf := config.GetConfig()
+		datasets := make([]*dataset.Dataset, 0, 2)
+		for _, spec := range args {
+			d, err := loadDataset(conf, spec)
+			if err != nil {
+				log.WithField("err", err).Errorf("load dataset %s failed", spec)
+				return
+			}
+			datasets = append(datasets, d)
+		}
+		diff := dataset.Compare(datasets[0], datasets[1], threshold)
+		if len(planFile) > 0 {
+			if err := writePlan(planFile, diff.Plan()); err != nil {
+				log.WithField("err", err).Error("write plan failed")
+				return
+			}
+		}
+		if format == outputJSON {
+			data, _ := json.MarshalIndent(diff, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+		printDiff(diff, verbose)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().Float64(thresholdFlag, 0.1, "least relative change of the tracked liquidity listed")
+	diffCmd.Flags().String(formatFlag, outputTable, "output format, table or json")
+	diffCmd.Flags().String(planFlag, "", "write the upsert and delete steps of the admin api to this file, one json per line")
+	diffCmd.Flags().BoolP(verboseFlag, "v", false, "list the added and removed pairs")
+}
+
+// loadDataset loads the dataset of spec.
+func loadDataset(conf *config.Config, spec string) (*dataset.Dataset, error) {
+	d := dataset.NewDataset()
+	var store database.Store
+	var err error
+	switch {
+	case spec == liveDataset:
+		store, err = database.OpenStore(conf)
+	case strings.HasPrefix(spec, spacePrefix):
+		store, err = database.OpenNebulaStore(conf, strings.TrimPrefix(spec, spacePrefix))
+	default:
+		for _, file := range strings.Split(spec, ",") {
+			if err = d.AddFile(file); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return d, d.AddStore(store)
+}
+
+func writePlan(file string, steps []dataset.PlanStep) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, step := range steps {
+		if err = enc.Encode(step); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	log.Infof("write %d plan steps to %s", len(steps), file)
+	return f.Close()
+}
+
+func formatRatio(ratio float64) string {
+	if math.IsInf(ratio, 1) {
+		return "new"
+	}
+	return fmt.Sprintf("%.1f%%", ratio*100)
+}
+
+func printDiff(diff *dataset.Diff, verbose bool) {
+	table := [][]string{{"dex", "added", "removed", "changed", "liquidity changed", "old tracked", "new tracked"}}
+	for _, dex := range diff.Dexes {
+		table = append(table, []string{dex.Dex, strconv.Itoa(dex.Added), strconv.Itoa(dex.Removed),
+			strconv.Itoa(dex.Changed), strconv.Itoa(dex.Liquidity),
+			strconv.FormatFloat(dex.OldTracked, 'f', 2, 64), strconv.FormatFloat(dex.NewTracked, 'f', 2, 64)})
+	}
+	printTable(table)
+
+	if len(diff.Liquidity) > 0 {
+		table = [][]string{{"", "dex", "pair", "old tracked", "new tracked", "change"}}
+		for _, change := range diff.Liquidity {
+			table = append(table, []string{"", change.New.Dex, change.New.Pair, change.Old.TrackedRaw, change.New.TrackedRaw,
+				formatRatio(change.Ratio)})
+		}
+		fmt.Printf("\n%d pairs with liquidity changed\n", len(diff.Liquidity))
+		printTable(table)
+	}
+	if len(diff.Renamed) > 0 {
+		table = [][]string{{"", "token", "old name", "new name"}}
+		for _, rename := range diff.Renamed {
+			table = append(table, []string{"", rename.Token, rename.Old, rename.New})
+		}
+		fmt.Printf("\n%d tokens renamed\n", len(diff.Renamed))
+		printTable(table)
+	}
+	if !verbose {
+		return
+	}
+	for _, pools := range []struct {
+		title string
+		pools []*dataset.Pool
+	}{{"added", diff.Added}, {"removed", diff.Removed}} {
+		if len(pools.pools) == 0 {
+			continue
+		}
+		table = [][]string{{"", "dex", "pair", "token0", "token1", "tracked"}}
+		for _, pool := range pools.pools {
+			table = append(table, []string{"", pool.Dex, pool.Pair, pool.Token0, pool.Token1, pool.TrackedRaw})
+		}
+		fmt.Printf("\n%d pairs %s\n", len(pools.pools), pools.title)
+		printTable(table)
+	}
+}
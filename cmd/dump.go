@@ -28,22 +28,32 @@ import (
 	"github.com/xueqianLu/routegen/cmd/utils"
 	"github.com/xueqianLu/routegen/config"
 	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/dataset"
 	"github.com/xueqianLu/routegen/log"
 	"github.com/xueqianLu/routegen/tool"
 	"github.com/xueqianLu/routegen/types"
-	"github.com/zhihu/norm"
 	"io/ioutil"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
-	"time"
 )
 
 const (
-	outputFlag    = "out"
-	maxOpFlag     = "op"
-	routineFlag   = "routine"
-	maxRoutesFlag = "max-steps"
+	outputFlag     = "out"
+	maxOpFlag      = "op"
+	routineFlag    = "routine"
+	maxRoutesFlag  = "max-steps"
+	shardFlag      = "shard"
+	formatFlag     = "format"
+	tokensFlag     = "tokens"
+	hubsFlag       = "hubs"
+	minTrackedFlag = "min-tracked"
+	asymmetricFlag = "asymmetric"
+	quoteSizesFlag = "quote-sizes"
+	quoteBaseFlag  = "quote-base"
+	quoteDecFlag   = "quote-base-decimals"
 )
 
 // dumpCmd represents the dump command
@@ -51,34 +61,25 @@ var dumpCmd = &cobra.Command{
 	Use:   "dump",
 	Short: "Dump all route for given token pairs",
 	Run: func(cmd *cobra.Command, args []string) {
-		tokenMap := make(map[string]bool)
-		tokenList := make([]string, 0)
-		for _, datafile := range args {
-			if utils.Exists(datafile) {
-				log.Info("import from file ", datafile)
-			} else {
-				log.Errorf("file (%s) not exist", datafile)
-				continue
-			}
-
-			data, err := ioutil.ReadFile(datafile)
-			if err != nil {
-				log.WithField("err", err).Error("read data file failed")
-				continue
-			}
-			var dexInfo = new(ImportData)
-			err = json.Unmarshal(data, &dexInfo)
+		tokenFile, _ := cmd.PersistentFlags().GetString(tokensFlag)
+		minTracked, _ := cmd.PersistentFlags().GetFloat64(minTrackedFlag)
+		var tokenList []string
+		var allowed map[string]bool
+		if len(tokenFile) > 0 {
+			list, err := ReadTokenList(tokenFile)
 			if err != nil {
-				log.WithField("err", err).Error("unmarshal file failed")
-				continue
+				log.WithField("err", err).Error("read token list failed")
+				return
 			}
-			for _, pair := range dexInfo.Data.Pairs {
-				tokenMap[pair.Token0.Address] = true
-				tokenMap[pair.Token1.Address] = true
+			allowed = make(map[string]bool)
+			for _, token := range list {
+				allowed[strings.ToLower(token)] = true
 			}
+			// the list is used as is when no data file is given.
+			tokenList = list
 		}
-		for token, _ := range tokenMap {
-			tokenList = append(tokenList, token)
+		if len(args) > 0 {
+			tokenList = collectDumpTokens(args, allowed, minTracked)
 		}
 
 		if err := DumpHandler(cmd, tokenList); err != nil {
@@ -95,6 +96,171 @@ func init() {
 	dumpCmd.PersistentFlags().Int(maxOpFlag, 4, "max jump for token swap route")
 	dumpCmd.PersistentFlags().Int(maxRoutesFlag, 10, "max routes flag")
 	dumpCmd.PersistentFlags().Uint(routineFlag, 5, "routine count to dump route file")
+	dumpCmd.PersistentFlags().String(shardFlag, "", "only dump routes from the i-th of N source token shards, format i/N")
+	dumpCmd.PersistentFlags().String(formatFlag, FormatLiteral, "dump format (literal, jsonl, csv), append .gz or .zst to compress, eg: jsonl.gz")
+	dumpCmd.PersistentFlags().String(tokensFlag, "", "file with the token addresses to dump, one address per line")
+	dumpCmd.PersistentFlags().StringSlice(hubsFlag, nil, "base tokens, only dump routes from and to the hubs")
+	dumpCmd.PersistentFlags().Float64(minTrackedFlag, 0, "drop the pairs with tracked liquidity at or below the threshold")
+	dumpCmd.PersistentFlags().Bool(asymmetricFlag, false, "query both directions of a token pair, instead of deriving the reverse routes")
+	dumpCmd.PersistentFlags().Float64Slice(quoteSizesFlag, nil, "attach quotes at these input sizes in base token to routes, eg: 1,100,10000 (jsonl format only)")
+	dumpCmd.PersistentFlags().String(quoteBaseFlag, "", "base token the quote sizes are measured in, eg: a USD stable coin")
+	dumpCmd.PersistentFlags().Int(quoteDecFlag, 18, "decimals of the quote base token")
+}
+
+// collectDumpTokens returns the tokens of the pairs in datafiles, the pairs not above minTracked
+// are skipped, and only the allowed tokens are returned if allowed is not nil.
+func collectDumpTokens(datafiles []string, allowed map[string]bool, minTracked float64) []string {
+	tokenMap := make(map[string]bool)
+	tokenList := make([]string, 0)
+	for _, datafile := range datafiles {
+		if utils.Exists(datafile) {
+			log.Info("import from file ", datafile)
+		} else {
+			log.Errorf("file (%s) not exist", datafile)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(datafile)
+		if err != nil {
+			log.WithField("err", err).Error("read data file failed")
+			continue
+		}
+		var dexInfo = new(dataset.ImportData)
+		err = json.Unmarshal(data, &dexInfo)
+		if err != nil {
+			log.WithField("err", err).Error("unmarshal file failed")
+			continue
+		}
+		for _, pair := range dexInfo.Data.Pairs {
+			if minTracked > 0 && pairLiquidity(pair) <= minTracked {
+				continue
+			}
+			for _, token := range []string{pair.Token0.Address, pair.Token1.Address} {
+				if allowed == nil || allowed[strings.ToLower(token)] {
+					tokenMap[token] = true
+				}
+			}
+		}
+	}
+	for token, _ := range tokenMap {
+		tokenList = append(tokenList, token)
+	}
+	// keep the token order stable, so every shard sees the same token set.
+	sort.Strings(tokenList)
+	return tokenList
+}
+
+// ReadTokenList reads token addresses from file, one address per line,
+// empty lines and lines start with '#' are ignored.
+func ReadTokenList(file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	sort.Strings(tokens)
+	return tokens, nil
+}
+
+func pairLiquidity(pair dataset.ImportPairInfo) float64 {
+	v, err := strconv.ParseFloat(pair.TrackedValue, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// RoutePair is a directed token pair to dump routes for, the routes from Dst to Src
+// are derived from the routes from Src to Dst if Reverse is set.
+type RoutePair struct {
+	Src, Dst string
+	Reverse  bool
+}
+
+// PlanRoutePairs returns the token pairs owned by shard, routes between all tokens
+// when hubs is empty, else only the routes from and to the hubs.
+// With symmetric, every unordered token pair is planned only once and is owned by the
+// shard of the pair, otherwise the token pairs are owned by the shard of the source token.
+func PlanRoutePairs(tokens []string, hubs []string, shard *Shard, symmetric bool) []RoutePair {
+	pairs := make([]RoutePair, 0)
+	add := func(src, dst string) {
+		if !symmetric {
+			if shard.Owns(src) {
+				pairs = append(pairs, RoutePair{Src: src, Dst: dst})
+			}
+			return
+		}
+		if src < dst && shard.OwnsPair(src, dst) {
+			pairs = append(pairs, RoutePair{Src: src, Dst: dst, Reverse: true})
+		}
+	}
+
+	if len(hubs) == 0 {
+		for _, src := range tokens {
+			for _, dst := range tokens {
+				if src != dst {
+					add(src, dst)
+				}
+			}
+		}
+		return pairs
+	}
+
+	isHub := make(map[string]bool)
+	for _, hub := range hubs {
+		isHub[strings.ToLower(hub)] = true
+	}
+	for _, hub := range hubs {
+		for _, token := range tokens {
+			if isHub[strings.ToLower(token)] {
+				continue
+			}
+			add(token, hub)
+			add(hub, token)
+		}
+		for _, other := range hubs {
+			if other != hub {
+				add(hub, other)
+			}
+		}
+	}
+	return pairs
+}
+
+// filterLiquidity keeps the pairs with tracked liquidity above minTracked in routes, and
+// drops the routes that have a step without any pair left.
+func filterLiquidity(routes []*types.TokenRoute, minTracked float64) []*types.TokenRoute {
+	if minTracked <= 0 {
+		return routes
+	}
+	filtered := make([]*types.TokenRoute, 0, len(routes))
+	for _, route := range routes {
+		valid := true
+		for i, step := range route.Steps {
+			pairs := make([]types.RoutePairInfo, 0, len(step.Pairs))
+			for _, pair := range step.Pairs {
+				if pair.Liquidity() > minTracked {
+					pairs = append(pairs, pair)
+				}
+			}
+			if len(pairs) == 0 {
+				valid = false
+				break
+			}
+			route.Steps[i].Pairs = pairs
+		}
+		if valid {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
 }
 
 func getPairInfoText(step types.RouteStep) string {
@@ -146,32 +312,86 @@ func DumpHandler(cmd *cobra.Command, tokens []string) error {
 	maxOp, _ := cmd.PersistentFlags().GetInt(maxOpFlag)
 	routine, _ := cmd.PersistentFlags().GetUint(routineFlag)
 	maxroutes, _ := cmd.PersistentFlags().GetInt(maxRoutesFlag)
+	shardStr, _ := cmd.PersistentFlags().GetString(shardFlag)
+	format, _ := cmd.PersistentFlags().GetString(formatFlag)
+	hubs, _ := cmd.PersistentFlags().GetStringSlice(hubsFlag)
+	minTracked, _ := cmd.PersistentFlags().GetFloat64(minTrackedFlag)
+	asymmetric, _ := cmd.PersistentFlags().GetBool(asymmetricFlag)
+	quoteSizes, _ := cmd.PersistentFlags().GetFloat64Slice(quoteSizesFlag)
+	quoteBase, _ := cmd.PersistentFlags().GetString(quoteBaseFlag)
+	quoteDecimals, _ := cmd.PersistentFlags().GetInt(quoteDecFlag)
+
+	shard, err := ParseShard(shardStr)
+	if err != nil {
+		return err
+	}
+	if _, _, err = ParseFormat(format); err != nil {
+		return err
+	}
+	if shard != nil {
+		dumpfile = shard.OutputName(dumpfile)
+		log.Infof("dump shard %s to %s", shard, dumpfile)
+	}
 
-	worker := NewWorker(routine, maxroutes)
+	worker, err := NewWorker(routine, maxroutes, minTracked, NewQuoter(quoteSizes, quoteBase, quoteDecimals))
+	if err != nil {
+		return err
+	}
+	defer worker.Close()
 	worker.Start()
-	return worker.DumpRouteToFile(dumpfile, tokens, maxOp)
+	pairs := PlanRoutePairs(tokens, hubs, shard, !asymmetric)
+	count, err := worker.DumpRouteToFile(dumpfile, format, pairs, maxOp)
+	if err != nil || shard == nil {
+		return err
+	}
+	tokenSet := make([]string, 0, len(tokens)+len(hubs))
+	tokenSet = append(tokenSet, tokens...)
+	for _, hub := range hubs {
+		tokenSet = append(tokenSet, "hub:"+hub)
+	}
+	if !asymmetric {
+		// symmetric and asymmetric shards partition the token pairs differently.
+		tokenSet = append(tokenSet, "symmetric")
+	}
+	return WriteShardManifest(shard, dumpfile, format, tokenSet, len(pairs), count)
 }
 
 type Worker struct {
-	task     *tool.Tasks
-	maxroute int
-	dbpool   []*norm.DB
+	task       *tool.Tasks
+	maxroute   int
+	minTracked float64
+	quoter     *Quoter
+	dbpool     []database.Store
 }
 
-func NewWorker(rountines uint, maxroute int) *Worker {
+func NewWorker(rountines uint, maxroute int, minTracked float64, quoter *Quoter) (*Worker, error) {
 	w := new(Worker)
 	task := tool.NewTasks(rountines, w.handler)
 	w.task = task
 	w.maxroute = maxroute
-	w.dbpool = make([]*norm.DB, int(rountines))
+	w.minTracked = minTracked
+	w.quoter = quoter
+	w.dbpool = make([]database.Store, 0, int(rountines))
 	for i := 0; i < int(rountines); i++ {
-		w.dbpool[i] = database.NewDb(config.GetConfig())
+		store, err := database.OpenStore(config.GetConfig())
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		w.dbpool = append(w.dbpool, store)
+	}
+	return w, nil
+}
+
+// Close closes the stores of the worker.
+func (w *Worker) Close() {
+	for _, store := range w.dbpool {
+		store.Close()
 	}
-	return w
 }
 
 func (w *Worker) sortRoutes(paths []*types.TokenRoute) []*types.TokenRoute {
-	sort.Sort(types.SortTokenRoutes(paths))
+	sort.Sort(types.SortScoredTokenRoutes(paths))
 	return paths
 }
 
@@ -299,17 +519,35 @@ func (w *Worker) FilterRoutes(paths []*types.TokenRoute, index int) []*types.Tok
 func (w *Worker) handler(t interface{}) {
 	item := t.(Item)
 	db := w.dbpool[item.index%len(w.dbpool)]
-	paths := database.QueryRouteWithMaxJump(db, item.token0, item.token1, item.maxOp)
+	paths, err := db.QueryRoutes(item.token0, item.token1, item.maxOp, 0)
+	if err != nil {
+		log.WithField("err", err).Error("query route failed")
+	}
 	//paths := make([]*types.TokenRoute, 0)
 	log.Infof("got token path %d", len(paths))
+	paths = filterLiquidity(paths, w.minTracked)
+	for _, path := range paths {
+		path.Score = types.ScoreRoute(path)
+	}
 	sorted := w.sortRoutes(paths)
 	merged := w.MergeRoutes(sorted)
 	filter := w.FilterRoutes(merged, 0)
 	trimed := w.trimRoutes(filter)
+	// merged routes have more pairs in their steps.
+	for _, path := range trimed {
+		path.Score = types.ScoreRoute(path)
+	}
+	w.quoter.Quote(db, trimed)
 
-	data := convertPathToString(trimed)
-	for _, str := range data {
-		item.response <- str
+	item.response <- trimed
+	if item.reverse {
+		reversed := make([]*types.TokenRoute, len(trimed))
+		for i, path := range trimed {
+			reversed[i] = types.ReverseRoute(path)
+		}
+		// quotes depend on the direction, they are computed again from the reserves.
+		w.quoter.Quote(db, reversed)
+		item.response <- reversed
 	}
 	close(item.response)
 }
@@ -322,85 +560,106 @@ type Item struct {
 	token0, token1 string
 	maxOp          int
 	index          int
+	reverse        bool
 	response       chan interface{}
 }
 
-func (w *Worker) DumpRouteToFile(dumpfile string, tokens []string, maxOp int) error {
-	fp, err := os.OpenFile(dumpfile, os.O_CREATE|os.O_APPEND|os.O_RDWR, os.ModeAppend|os.ModePerm) // 读写方式打开
+// DumpRouteToFile dumps the routes of the token pairs with the given format,
+// and returns the count of routes written to dumpfile. The routes are written to a
+// temporary file first, dumpfile is replaced only when the dump succeeds.
+func (w *Worker) DumpRouteToFile(dumpfile string, format string, pairs []RoutePair, maxOp int) (int, error) {
+	tmpfile := dumpfile + ".tmp"
+	fp, err := os.OpenFile(tmpfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
-		log.WithField("err", err).WithField("file", dumpfile).Error("open file failed")
-		return err
+		log.WithField("err", err).WithField("file", tmpfile).Error("open file failed")
+		return 0, err
+	}
+	writer, err := NewRouteWriter(fp, format, true)
+	if err != nil {
+		fp.Close()
+		os.Remove(tmpfile)
+		return 0, err
 	}
-	defer fp.Close()
-	log.Infof("total token %d", len(tokens))
+	log.Infof("total token pair %d", len(pairs))
 
-	results := make(chan string, 10000000)
-	writeFinished := false
+	results := make(chan []*types.TokenRoute, 10000000)
+	var (
+		count    = 0
+		writeErr error
+		done     = make(chan struct{})
+	)
 
+	// count and writeErr belong to the writer routine until done is closed.
 	go func() {
-		var count = 0
-		for {
-			select {
-			case s, ok := <-results:
-				if !ok {
-					writeFinished = true
-					log.Infof("total write to file count %d", count)
-					return
-				}
-				_, err = fp.WriteString(s)
-				count += 1
-				if (count % 20) == 0 {
-					log.Infof("write to file count %d", count)
-					fp.Sync()
-				}
-				//log.Infof("consume routine write to file")
-				if err != nil {
-					log.WithField("err", err).Error("write to file failed")
-					return
-				}
+		defer close(done)
+		for routes := range results {
+			if writeErr != nil {
+				// keep draining so that the producers never block.
+				continue
+			}
+			if writeErr = writer.Write(routes); writeErr != nil {
+				log.WithField("err", writeErr).Error("write to file failed")
+				continue
+			}
+			if (count / 20) != (count+len(routes))/20 {
+				log.Infof("write to file count %d", count+len(routes))
+				fp.Sync()
 			}
+			count += len(routes)
+		}
+		log.Infof("total write to file count %d", count)
+		if e := writer.Close(); e != nil && writeErr == nil {
+			writeErr = e
 		}
 	}()
 
+	var (
+		mux     sync.Mutex
+		taskErr error
+	)
 	wg := sync.WaitGroup{}
-	for i := 0; i < len(tokens); i++ {
-		for j := 0; j < len(tokens); j++ {
-			if i == j {
-				continue
+	for _, pair := range pairs {
+		wg.Add(1)
+		go func(pair RoutePair, op int) {
+			defer wg.Done()
+			res := make(chan interface{})
+			item := Item{
+				response: res,
+				token0:   pair.Src,
+				token1:   pair.Dst,
+				maxOp:    op,
+				reverse:  pair.Reverse,
 			}
-			wg.Add(1)
-			go func(token0, token1 string, op int) {
-				defer wg.Done()
-				res := make(chan interface{})
-				item := Item{
-					response: res,
-					token0:   token0,
-					token1:   token1,
-					maxOp:    op,
-				}
-				//log.Debugf("add item to task")
-				if e := w.task.AddTask(item); e != nil {
-					err = e
-				} else {
-					for {
-						select {
-						case data, ok := <-res:
-							if !ok {
-								return
-							}
-							results <- data.(string)
-						}
-					}
+			if e := w.task.AddTask(item); e != nil {
+				mux.Lock()
+				if taskErr == nil {
+					taskErr = e
 				}
-			}(tokens[i], tokens[j], maxOp)
-		}
+				mux.Unlock()
+				return
+			}
+			for data := range res {
+				results <- data.([]*types.TokenRoute)
+			}
+		}(pair, maxOp)
 	}
 	wg.Wait()
 	close(results)
-	for !writeFinished {
-		log.Info("wait write file finish")
-		time.Sleep(time.Second)
-	}
+	<-done
 
-	return err
+	err = writeErr
+	if err == nil {
+		err = taskErr
+	}
+	if e := fp.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmpfile, dumpfile)
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+		return count, err
+	}
+	return count, nil
 }
@@ -0,0 +1,385 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/log"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidShard = errors.New("invalid shard, expect format i/N with 0 <= i < N")
+)
+
+// Shard is the i-th of N partitions of the source tokens.
+type Shard struct {
+	Index int
+	Total int
+}
+
+func ParseShard(s string) (*Shard, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return nil, ErrInvalidShard
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, ErrInvalidShard
+	}
+	total, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, ErrInvalidShard
+	}
+	if total <= 0 || index < 0 || index >= total {
+		return nil, ErrInvalidShard
+	}
+	return &Shard{Index: index, Total: total}, nil
+}
+
+func (s *Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Total)
+}
+
+// Owns reports whether token belongs to the shard, it only depends on the token address,
+// so the partition is the same on every process and machine.
+func (s *Shard) Owns(token string) bool {
+	if s == nil {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(token)))
+	return int(h.Sum32()%uint32(s.Total)) == s.Index
+}
+
+// OwnsPair reports whether the unordered token pair belongs to the shard.
+func (s *Shard) OwnsPair(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a > b {
+		a, b = b, a
+	}
+	return s.Owns(a + "-" + b)
+}
+
+func (s *Shard) OutputName(dumpfile string) string {
+	return fmt.Sprintf("%s.shard-%d-of-%d", dumpfile, s.Index, s.Total)
+}
+
+func ManifestName(output string) string {
+	return output + ".manifest.json"
+}
+
+// ShardManifest describes the output of one dump shard.
+type ShardManifest struct {
+	Shard int `json:"shard"`
+	Total int `json:"total"`
+	// Output is the file name of the shard output, which is next to the manifest.
+	Output    string `json:"output"`
+	Format    string `json:"format"`
+	TokenSet  string `json:"token_set"`
+	Tokens    int    `json:"tokens"`
+	Pairs     int    `json:"pairs"`
+	Routes    int    `json:"routes"`
+	Size      int64  `json:"size"`
+	Sha256    string `json:"sha256"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// tokenSetHash identifies the token set, shards built from different data files can not be merged.
+func tokenSetHash(tokens []string) string {
+	sorted := make([]string, len(tokens))
+	copy(sorted, tokens)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, token := range sorted {
+		h.Write([]byte(strings.ToLower(token)))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fileSha256(path string) (string, int64, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, fp)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func WriteShardManifest(shard *Shard, output string, format string, tokens []string, pairs int, routes int) error {
+	sum, size, err := fileSha256(output)
+	if err != nil {
+		return err
+	}
+	manifest := ShardManifest{
+		Shard:     shard.Index,
+		Total:     shard.Total,
+		Output:    filepath.Base(output),
+		Format:    format,
+		TokenSet:  tokenSetHash(tokens),
+		Tokens:    len(tokens),
+		Pairs:     pairs,
+		Routes:    routes,
+		Size:      size,
+		Sha256:    sum,
+		Timestamp: time.Now().Unix(),
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Infof("write shard manifest to %s", ManifestName(output))
+	return ioutil.WriteFile(ManifestName(output), data, 0644)
+}
+
+// readShardManifest reads the manifest at path, and resolves its output against the
+// directory of the manifest, so the shards can be merged wherever they are copied to.
+func readShardManifest(path string) (*ShardManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(ShardManifest)
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	manifest.Output = filepath.Join(filepath.Dir(path), filepath.Base(manifest.Output))
+	return manifest, nil
+}
+
+// dumpMergeCmd represents the dump merge command
+var dumpMergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Validate and concatenate the outputs of dump shards",
+	Long: `Validate the shard manifests and concatenate the shard outputs in shard order.
+The csv shards keep one header and their routes are numbered again.
+Arguments are shard manifest files or shard output files, for example:
+
+routegen dump merge --out dump.txt dump.txt.shard-*-of-4.manifest.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			log.Error("please enter shard manifest files")
+			return
+		}
+		output, _ := cmd.Flags().GetString(outputFlag)
+		if err := MergeShards(output, args); err != nil {
+			log.Errorf("merge dump shards failed with err:(%s)", err)
+		} else {
+			log.Info("merge dump shards finished")
+		}
+	},
+}
+
+func init() {
+	dumpCmd.AddCommand(dumpMergeCmd)
+}
+
+// MergeShards checks that the manifests describe exactly one complete set of shards,
+// and then concatenates the shard outputs into output.
+func MergeShards(output string, files []string) error {
+	manifests := make(map[int][]*ShardManifest)
+	total, tokenSet, format := -1, "", ""
+	problems := make([]string, 0)
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".manifest.json") {
+			file = ManifestName(file)
+		}
+		manifest, err := readShardManifest(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("read manifest %s failed: %s", file, err))
+			continue
+		}
+		if total < 0 {
+			total, tokenSet, format = manifest.Total, manifest.TokenSet, manifest.Format
+		}
+		if manifest.Shard < 0 || manifest.Shard >= manifest.Total {
+			problems = append(problems, fmt.Sprintf("manifest %s has invalid shard %d/%d", file, manifest.Shard, manifest.Total))
+			continue
+		}
+		if manifest.Total != total {
+			problems = append(problems, fmt.Sprintf("manifest %s has %d shards, expect %d", file, manifest.Total, total))
+			continue
+		}
+		if manifest.TokenSet != tokenSet {
+			problems = append(problems, fmt.Sprintf("manifest %s is built from a different token set", file))
+			continue
+		}
+		if manifest.Format != format {
+			problems = append(problems, fmt.Sprintf("manifest %s has format %s, expect %s", file, manifest.Format, format))
+			continue
+		}
+		sum, _, err := fileSha256(manifest.Output)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("read shard output %s failed: %s", manifest.Output, err))
+			continue
+		}
+		if sum != manifest.Sha256 {
+			problems = append(problems, fmt.Sprintf("shard output %s checksum mismatch", manifest.Output))
+			continue
+		}
+		manifests[manifest.Shard] = append(manifests[manifest.Shard], manifest)
+	}
+	for i := 0; i < total; i++ {
+		switch n := len(manifests[i]); {
+		case n == 0:
+			problems = append(problems, fmt.Sprintf("missing shard %d/%d", i, total))
+		case n > 1:
+			outputs := make([]string, 0, n)
+			for _, m := range manifests[i] {
+				outputs = append(outputs, m.Output)
+			}
+			problems = append(problems, fmt.Sprintf("duplicated shard %d/%d in %s", i, total, strings.Join(outputs, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		for _, p := range problems {
+			log.Error(p)
+		}
+		return fmt.Errorf("%d problems found in dump shards", len(problems))
+	}
+
+	name, compress, err := ParseFormat(format)
+	if err != nil {
+		// the manifests written before the format was recorded.
+		name, compress = "", ""
+	}
+	fp, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if name == FormatCSV {
+		return mergeCSVShards(fp, compress, total, manifests)
+	}
+	routes := 0
+	for i := 0; i < total; i++ {
+		manifest := manifests[i][0]
+		shardfp, err := os.Open(manifest.Output)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fp, shardfp)
+		shardfp.Close()
+		if err != nil {
+			return err
+		}
+		routes += manifest.Routes
+	}
+	log.Infof("merged %d shards with %d routes to %s", total, routes, output)
+	return nil
+}
+
+// mergeCSVShards writes the rows of the csv shards to w with one header, every shard
+// numbers its routes from 0, so the routes are numbered again in the merged output.
+func mergeCSVShards(w io.Writer, compress string, total int, manifests map[int][]*ShardManifest) error {
+	compressor, err := newCompressor(w, compress)
+	if err != nil {
+		return err
+	}
+	if compressor != nil {
+		w = compressor
+	}
+	writer := csv.NewWriter(w)
+	if err = writer.Write(csvHeader); err != nil {
+		return err
+	}
+	routes := 0
+	for i := 0; i < total; i++ {
+		n, err := copyCSVShard(writer, manifests[i][0].Output, compress, routes)
+		if err != nil {
+			return fmt.Errorf("merge shard output %s failed: %w", manifests[i][0].Output, err)
+		}
+		routes += n
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		if err = compressor.Close(); err != nil {
+			return err
+		}
+	}
+	log.Infof("merged %d shards with %d routes", total, routes)
+	return nil
+}
+
+// copyCSVShard copies the rows of the shard output without its header, the routes are
+// numbered from offset, it returns the count of the routes.
+func copyCSVShard(writer *csv.Writer, output string, compress string, offset int) (int, error) {
+	fp, err := os.Open(output)
+	if err != nil {
+		return 0, err
+	}
+	defer fp.Close()
+	r, err := newDecompressor(fp, compress)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	routes, last := 0, ""
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return routes, nil
+		}
+		if err != nil {
+			return routes, err
+		}
+		if line == 0 && record[0] == csvHeader[0] {
+			continue
+		}
+		if routes == 0 || record[0] != last {
+			last = record[0]
+			routes++
+		}
+		record[0] = strconv.Itoa(offset + routes - 1)
+		if err = writer.Write(record); err != nil {
+			return routes, err
+		}
+	}
+}
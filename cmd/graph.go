@@ -0,0 +1,241 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/graph"
+	"github.com/xueqianLu/routegen/log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	tokenFlag   = "token"
+	hopsFlag    = "hops"
+	topFlag     = "top"
+	samplesFlag = "samples"
+
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Inspect the token graph",
+}
+
+var graphExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export the token graph, or the subgraph around the given tokens, for Graphviz or Gephi",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString(formatFlag)
+		tokens, _ := cmd.Flags().GetStringSlice(tokenFlag)
+		hops, _ := cmd.Flags().GetInt(hopsFlag)
+		g, err := loadGraph(cmd)
+		if err != nil {
+			log.WithField("err", err).Error("load graph failed")
+			return
+		}
+		if len(tokens) > 0 {
+			if g, err = g.Subgraph(tokens, hops); err != nil {
+				log.Error(err)
+				return
+			}
+		}
+		if url, _ := cmd.Flags().GetString(urlFlag); len(url) > 0 {
+			if err = readSymbols(g, url); err != nil {
+				log.WithField("err", err).Error("read token symbols failed")
+				return
+			}
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			log.WithField("err", err).Error("create graph file failed")
+			return
+		}
+		if err = graph.Export(f, g, format); err == nil {
+			err = f.Close()
+		} else {
+			f.Close()
+		}
+		if err != nil {
+			log.WithField("err", err).Error("export graph failed")
+			return
+		}
+		log.Infof("export %d tokens and %d pools to %s", len(g.Tokens()), len(g.Pools()), args[0])
+	},
+}
+
+var graphStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report the components, hub tokens, degree distribution and reachability of the token graph",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString(formatFlag)
+		top, _ := cmd.Flags().GetInt(topFlag)
+		samples, _ := cmd.Flags().GetInt(samplesFlag)
+		hubs, _ := cmd.Flags().GetStringSlice(hubsFlag)
+		if format != outputTable && format != outputJSON {
+			log.Errorf("unknown stats format (%s), want %s or %s", format, outputTable, outputJSON)
+			return
+		}
+		g, err := loadGraph(cmd)
+		if err != nil {
+			log.WithField("err", err).Error("load graph failed")
+			return
+		}
+		stats, err := g.Stats(graph.StatsOptions{Top: top, Samples: samples, Bases: hubs})
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if format == outputJSON {
+			data, _ := json.MarshalIndent(stats, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+		printGraphStats(stats)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+	graphCmd.AddCommand(graphExportCmd, graphStatsCmd)
+	graphCmd.PersistentFlags().String(spaceFlag, "", "nebula space, the active space by default")
+	graphExportCmd.Flags().StringP(formatFlag, "f", graph.FormatDOT, fmt.Sprintf("graph format, one of %s", strings.Join(graph.Formats, ", ")))
+	graphExportCmd.Flags().StringSlice(tokenFlag, nil, "only export the tokens within --hops of these tokens")
+	graphExportCmd.Flags().Int(hopsFlag, 2, "steps from the --token tokens")
+	graphExportCmd.Flags().String(urlFlag, "", "rpc url to read the symbols of the tokens not in the token lists")
+	graphStatsCmd.Flags().String(formatFlag, outputTable, "output format, table or json")
+	graphStatsCmd.Flags().Int(topFlag, 10, "count of the hub tokens listed")
+	graphStatsCmd.Flags().Int(samplesFlag, 0, "source tokens sampled for the betweenness, 0 for exact")
+	graphStatsCmd.Flags().StringSlice(hubsFlag, nil, "base tokens, list the tokens unreachable from them")
+}
+
+// loadGraph reads the graph of the configured store into memory, with the symbols of
+// the imported token lists.
+func loadGraph(cmd *cobra.Command) (*graph.Graph, error) {
+	db, err := openSpaceStore(cmd, config.GetConfig(), false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	g, err := database.LoadGraph(db)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := db.TokenInfos()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		g.SetSymbol(info.Address, info.Symbol)
+	}
+	return g, nil
+}
+
+// readSymbols reads the symbols of the tokens without one from their contracts.
+func readSymbols(g *graph.Graph, url string) error {
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	missing := 0
+	for _, token := range g.Tokens() {
+		if _, exist := g.Symbol(token); exist {
+			continue
+		}
+		symbol, _, err := contracts.GetTokenSymbol(client, token)
+		if err != nil {
+			missing++
+			continue
+		}
+		g.SetSymbol(token, symbol)
+	}
+	if missing > 0 {
+		log.Warnf("%d tokens have no symbol, they are labelled with their names", missing)
+	}
+	return nil
+}
+
+func printGraphStats(stats *graph.Stats) {
+	printTable([][]string{
+		{"tokens", strconv.Itoa(stats.Tokens)},
+		{"pools", strconv.Itoa(stats.Pools)},
+		{"components", strconv.Itoa(stats.Components)},
+		{"largest component", strconv.Itoa(stats.LargestSize)},
+		{"isolated tokens", strconv.Itoa(stats.Isolated)},
+	})
+
+	dexes := make([]string, 0, len(stats.PoolsByDex))
+	for dex := range stats.PoolsByDex {
+		dexes = append(dexes, dex)
+	}
+	sort.Strings(dexes)
+	table := [][]string{{"", "dex", "pools", "tokens"}}
+	for _, dex := range dexes {
+		table = append(table, []string{"", dex, strconv.Itoa(stats.PoolsByDex[dex]), strconv.Itoa(stats.TokensByDex[dex])})
+	}
+	fmt.Println()
+	printTable(table)
+
+	table = [][]string{{"", "degree", "tokens"}}
+	for _, bucket := range stats.Degrees {
+		degree := strconv.Itoa(bucket.Min)
+		if bucket.Max > bucket.Min {
+			degree = fmt.Sprintf("%d-%d", bucket.Min, bucket.Max)
+		}
+		table = append(table, []string{"", degree, strconv.Itoa(bucket.Count)})
+	}
+	fmt.Println()
+	printTable(table)
+
+	for _, hubs := range []struct {
+		title  string
+		scores []graph.TokenScore
+	}{{"degree", stats.TopDegree}, {"betweenness", stats.TopBetweenness}} {
+		table = [][]string{{"", "token", "name", hubs.title}}
+		for _, score := range hubs.scores {
+			table = append(table, []string{"", score.Token, score.Name, strconv.FormatFloat(score.Score, 'g', 6, 64)})
+		}
+		fmt.Println()
+		printTable(table)
+	}
+
+	if len(stats.Bases) > 0 {
+		fmt.Printf("\n%d tokens unreachable from %s\n", len(stats.Unreachable), strings.Join(stats.Bases, ", "))
+		for _, token := range stats.Unreachable {
+			fmt.Println("  " + token)
+		}
+	}
+}
@@ -28,40 +28,29 @@ import (
 	"github.com/xueqianLu/routegen/config"
 	"github.com/xueqianLu/routegen/contracts"
 	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/dataset"
 	"github.com/xueqianLu/routegen/log"
-	"github.com/zhihu/norm"
 	"io/ioutil"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 const (
-	urlFlag    = "url"
-	initDBFlag = "initdb"
-)
-
-type ImportToken struct {
-	Address string `json:"id"`
-	Name    string `json:"name"`
-}
-
-type ImportPairInfo struct {
-	Address      string      `json:"id"`
-	Name         string      `json:"name"`
-	TrackedValue string      `json:"trackedReserveBNB"`
-	Token0       ImportToken `json:"token0"`
-	Token1       ImportToken `json:"token1"`
-}
-
-type ImportPairs struct {
-	Pairs []ImportPairInfo `json:"pairs"`
-}
+	urlFlag       = "url"
+	initDBFlag    = "initdb"
+	reservesFlag  = "reserves"
+	noRebuildFlag = "no-rebuild"
+	newSpaceFlag  = "new-space"
+	switchFlag    = "switch"
+	strictFlag    = "strict"
+	create2Flag   = "create2"
 
-type ImportData struct {
-	Name string      `json:"name"`
-	Fee  string      `json:"fee"`
-	Data ImportPairs `json:"data"`
-}
+	// create2 modes of the pairs of the dexes in the config.
+	create2Off    = "off"
+	create2Warn   = "warn"
+	create2Reject = "reject"
+)
 
 // importCmd represents the import command
 var importCmd = &cobra.Command{
@@ -74,16 +63,67 @@ var importCmd = &cobra.Command{
 		//}
 		url, _ := cmd.PersistentFlags().GetString(urlFlag)
 		initdb, _ := cmd.PersistentFlags().GetBool(initDBFlag)
+		withReserves, _ := cmd.PersistentFlags().GetBool(reservesFlag)
+		noRebuild, _ := cmd.PersistentFlags().GetBool(noRebuildFlag)
+
+		newSpace, _ := cmd.Flags().GetBool(newSpaceFlag)
+		switchTo, _ := cmd.Flags().GetBool(switchFlag)
+		strict, _ := cmd.Flags().GetBool(strictFlag)
+		create2, _ := cmd.Flags().GetString(create2Flag)
+		opts, err := validateOptions(cmd)
+		if err != nil {
+			log.Error(err)
+			return
+		}
 
-		db := database.NewDb(config.GetConfig())
+		conf := config.GetConfig()
+		var verifier *dataset.PairVerifier
+		switch create2 {
+		case create2Off:
+		case create2Warn, create2Reject:
+			if verifier, err = dataset.NewPairVerifier(conf.Dexes); err != nil {
+				log.WithField("err", err).Error("invalid dex config")
+				return
+			}
+		default:
+			log.Errorf("unknown --%s mode (%s), want %s, %s or %s", create2Flag, create2, create2Off, create2Warn, create2Reject)
+			return
+		}
+		if newSpace && !database.IsNebula(conf) {
+			log.Errorf("--%s only works on nebula", newSpaceFlag)
+			return
+		}
+		var space string
+		switch {
+		case newSpace:
+			if space, err = createImportSpace(conf); err != nil {
+				log.WithField("err", err).Error("create new space failed")
+				return
+			}
+			// a new space always needs the schema.
+			initdb = true
+		case database.IsNebula(conf):
+			if space, err = activeSpaceName(nil); err != nil {
+				log.WithField("err", err).Error("get active space failed")
+				return
+			}
+		}
+		db, err := openImportStore(conf, space)
+		if err != nil {
+			log.WithField("err", err).Errorf("open db failed")
+			return
+		}
+		defer db.Close()
 		if initdb {
-			if err := prepare(db); err != nil {
+			if err := db.Prepare(); err != nil {
 				log.WithField("err", err).Fatalf("prepare db failed")
 				panic(err)
 			}
 			log.Infof("init db finished")
 		}
 
+		imported := make([]database.GraphSource, 0, len(args))
+		validator := dataset.NewValidator(verifier)
 		for _, datafile := range args {
 			if utils.Exists(datafile) {
 				log.Info("import from file ", datafile)
@@ -91,12 +131,46 @@ var importCmd = &cobra.Command{
 				log.Errorf("file (%s) not exist", datafile)
 				continue
 			}
-			if err := ImportHandler(db, datafile, url); err != nil {
-				log.Error("import data from %s failed", datafile)
+			if strict && !validFile(validator, datafile) {
+				log.Errorf("refuse to import %s, check it with: validate %s", datafile, datafile)
+				continue
+			}
+			if err := ImportHandler(db, datafile, url, withReserves, verifier, create2 == create2Reject); err != nil {
+				log.Errorf("import data from %s failed", datafile)
 			} else {
 				log.Infof("import data from %s finished", datafile)
+				if source, err := database.FileSource(datafile); err == nil {
+					imported = append(imported, source)
+				}
+			}
+		}
+		if len(imported) > 0 {
+			if err := database.RecordImport(db, imported); err != nil {
+				log.WithField("err", err).Error("record the imported files failed")
 			}
 		}
+		if !noRebuild && len(args) > 0 {
+			if err := db.RebuildIndexes(); err != nil {
+				log.WithField("err", err).Error("rebuild index failed")
+			}
+		}
+		if !newSpace {
+			return
+		}
+		if err = validateSpace(conf, space, opts); err != nil {
+			log.Errorf("validate space %s failed with err:(%s), the service keeps the active space", space, err)
+			return
+		}
+		log.Infof("validate space %s passed", space)
+		if !switchTo {
+			log.Infof("switch the service with: db switch-space %s", space)
+			return
+		}
+		if err = switchSpace(conf, space); err != nil {
+			log.Errorf("switch to space %s failed with err:(%s)", space, err)
+		} else {
+			log.Infof("switch to space %s finished", space)
+		}
 	},
 }
 
@@ -104,19 +178,55 @@ func init() {
 	rootCmd.AddCommand(importCmd)
 	importCmd.PersistentFlags().String(urlFlag, "https://rpc.ankr.com/bsc", "rpc url")
 	importCmd.PersistentFlags().Bool(initDBFlag, false, "init database")
+	importCmd.PersistentFlags().Bool(reservesFlag, false, "read the pair reserves from rpc and store them with the pairs")
+	importCmd.PersistentFlags().Bool(noRebuildFlag, false, "do not rebuild the indexes after import")
+	importCmd.Flags().Bool(newSpaceFlag, false, "import into the next versioned space of db_space instead of the active space")
+	importCmd.Flags().Bool(switchFlag, false, "switch the service to the new space after it is validated")
+	importCmd.Flags().Bool(strictFlag, false, "refuse the files with problems found by validate")
+	importCmd.Flags().String(create2Flag, create2Warn, "check the pair addresses of the configured dexes: off, warn or reject the mismatched pairs")
+	addValidateFlags(importCmd)
+}
+
+// validFile checks datafile with validator, and logs the problems found.
+func validFile(validator *dataset.Validator, datafile string) bool {
+	issues, err := validator.File(datafile)
+	if err != nil {
+		log.WithField("err", err).Errorf("read %s failed", datafile)
+		return false
+	}
+	for _, issue := range issues {
+		log.Warn(issue.String())
+	}
+	return len(issues) == 0
+}
+
+// openImportStore opens the store to import into, space is only used by nebula.
+func openImportStore(conf *config.Config, space string) (database.Store, error) {
+	if database.IsNebula(conf) {
+		return database.OpenNebulaStore(conf, space)
+	}
+	return database.OpenStore(conf)
 }
 
-func prepare(db *norm.DB) error {
-	createSchema := "" +
-		"CREATE TAG IF NOT EXISTS token(name string, address string);" +
-		"CREATE EDGE IF NOT EXISTS pair(dex string, tracked string, fee string, pairaddress string, token0 string, token1 string);" +
-		"CREATE TAG INDEX token_index on token();" +
-		"CREATE EDGE INDEX pair_index on pair();"
-	_, err := db.Execute(createSchema)
-	return err
+// createImportSpace creates the next versioned space of db_space, like routes_v42.
+func createImportSpace(conf *config.Config) (string, error) {
+	spaceDb, err := database.NewSpaceDb(conf)
+	if err != nil {
+		return "", err
+	}
+	defer spaceDb.Close()
+	space, err := database.NextSpaceName(spaceDb, conf.DbSpace)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("create new space %s", space)
+	heartbeat := time.Duration(conf.DbHeartbeat) * time.Second
+	return space, database.CreateSpace(spaceDb, space, database.SpaceOptionsFromConfig(conf), heartbeat)
 }
 
-func ImportHandler(db *norm.DB, datafile string, url string) error {
+// ImportHandler imports the pairs of datafile, the pairs of the dexes known by verifier
+// are checked against their CREATE2 address, and skipped on mismatch with reject.
+func ImportHandler(db database.Store, datafile string, url string, withReserves bool, verifier *dataset.PairVerifier, reject bool) error {
 
 	//return nil
 	client, err := ethclient.Dial(url)
@@ -129,29 +239,46 @@ func ImportHandler(db *norm.DB, datafile string, url string) error {
 		log.WithField("err", err).Fatalf("read data file failed")
 		return err
 	}
-	var dexInfo = new(ImportData)
+	var dexInfo = new(dataset.ImportData)
 	err = json.Unmarshal(data, &dexInfo)
 	if err != nil {
 		//log.WithField("err", err).Fatalf("read data file failed")
 		return err
 	}
 	dexName := dexInfo.Name
-	for _, pair := range dexInfo.Data.Pairs {
-		var name0, name1 = pair.Token0.Name, pair.Token1.Name
-		if len(name0) == 0 {
-			name0 = contracts.GetTokenName(client, pair.Token0.Address)
-		}
-		if len(name1) == 0 {
-			name1 = contracts.GetTokenName(client, pair.Token1.Address)
-		}
+	// the pairs of a file are written in one batch.
+	return database.Batch(db, func(db database.Store) error {
+		for _, pair := range dexInfo.Data.Pairs {
+			if err := verifier.Verify(dexName, pair.Address, pair.Token0.Address, pair.Token1.Address); err != nil {
+				log.WithField("err", err).WithField("pair", pair.Address).Warnf("pair of %s failed the CREATE2 check", dexName)
+				if reject {
+					continue
+				}
+			}
+			var name0, name1 = pair.Token0.Name, pair.Token1.Name
+			if len(name0) == 0 {
+				name0 = contracts.GetTokenName(client, pair.Token0.Address)
+			}
+			if len(name1) == 0 {
+				name1 = contracts.GetTokenName(client, pair.Token1.Address)
+			}
 
-		_ = database.InsertToken(db, name0, pair.Token0.Address)
-		_ = database.InsertToken(db, name1, pair.Token1.Address)
-		// token0 -> token1
-		_ = database.InsertPair(db, dexName, pair.Address, dexInfo.Fee, pair.TrackedValue, pair.Token0.Address, pair.Token1.Address)
-		// and support token1 -> token0
-		_ = database.InsertPair(db, dexName, pair.Address, dexInfo.Fee, pair.TrackedValue, pair.Token1.Address, pair.Token0.Address)
-	}
+			var reserves *contracts.PairReserves
+			if withReserves {
+				if reserves, err = contracts.GetPairReserves(client, pair.Address); err != nil {
+					log.WithField("err", err).WithField("pair", pair.Address).Error("get pair reserves failed")
+				}
+			}
+
+			_ = db.InsertToken(name0, pair.Token0.Address)
+			_ = db.InsertToken(name1, pair.Token1.Address)
+			// token0 -> token1
+			_ = db.InsertPair(dexName, pair.Address, dexInfo.Fee, pair.TrackedValue, pair.Token0.Address, pair.Token1.Address, reserves)
+			// and support token1 -> token0
+			_ = db.InsertPair(dexName, pair.Address, dexInfo.Fee, pair.TrackedValue, pair.Token1.Address, pair.Token0.Address, reserves.Reverse())
+		}
+		return nil
+	})
 	//for _, dex := range dexlist {
 	//	for _, pair := range dex.Pairs {
 	//		name0 := contracts.GetTokenName(client, pair.Token0)
@@ -161,6 +288,4 @@ func ImportHandler(db *norm.DB, datafile string, url string) error {
 	//		_ = database.InsertPair(db, dex.Name, pair.Address, pair.Token0, pair.Token1)
 	//	}
 	//}
-	db.Close()
-	return nil
 }
@@ -0,0 +1,119 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+)
+
+const (
+	feeFlag     = "fee"
+	trackedFlag = "tracked"
+)
+
+// pairCmd represents the pair command
+var pairCmd = &cobra.Command{
+	Use:   "pair",
+	Short: "Update or delete the pairs in the active space",
+}
+
+var pairUpdateCmd = &cobra.Command{
+	Use:   "update <pair>",
+	Short: "Update the fee, tracked value or reserves of the pair in both directions",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pairaddr := args[0]
+		state := database.PairState{}
+		if cmd.Flags().Changed(feeFlag) {
+			fee, _ := cmd.Flags().GetString(feeFlag)
+			state.Fee = &fee
+		}
+		if cmd.Flags().Changed(trackedFlag) {
+			tracked, _ := cmd.Flags().GetString(trackedFlag)
+			state.Tracked = &tracked
+		}
+		if withReserves, _ := cmd.Flags().GetBool(reservesFlag); withReserves {
+			url, _ := cmd.Flags().GetString(urlFlag)
+			client, err := ethclient.Dial(url)
+			if err != nil {
+				log.WithField("err", err).Error("dial rpc failed")
+				return
+			}
+			if state.Reserves, err = contracts.GetPairReserves(client, pairaddr); err != nil {
+				log.WithField("err", err).Error("get pair reserves failed")
+				return
+			}
+			if state.Token0, err = contracts.GetPairToken0(client, pairaddr); err != nil {
+				log.WithField("err", err).Error("get pair token0 failed")
+				return
+			}
+		}
+		if state.Fee == nil && state.Tracked == nil && state.Reserves == nil {
+			log.Errorf("nothing to update, set --%s, --%s or --%s", feeFlag, trackedFlag, reservesFlag)
+			return
+		}
+		db, err := activeDb()
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer db.Close()
+		if edges, err := database.UpdatePairState(db, pairaddr, state); err != nil {
+			log.Errorf("update pair %s failed with err:(%s)", pairaddr, err)
+		} else {
+			log.Infof("update %d edges of pair %s finished", edges, pairaddr)
+		}
+	},
+}
+
+var pairDeleteCmd = &cobra.Command{
+	Use:   "delete <pair>",
+	Short: "Delete the pair in both directions",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := activeDb()
+		if err != nil {
+			log.Errorf("connect db failed with err:(%s)", err)
+			return
+		}
+		defer db.Close()
+		if edges, err := database.DeletePair(db, args[0]); err != nil {
+			log.Errorf("delete pair %s failed with err:(%s)", args[0], err)
+		} else {
+			log.Infof("delete %d edges of pair %s finished", edges, args[0])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pairCmd)
+	pairCmd.AddCommand(pairUpdateCmd)
+	pairCmd.AddCommand(pairDeleteCmd)
+	pairUpdateCmd.Flags().String(feeFlag, "", "new fee of the pair")
+	pairUpdateCmd.Flags().String(trackedFlag, "", "new tracked value of the pair")
+	pairUpdateCmd.Flags().Bool(reservesFlag, false, "read the reserves of the pair from rpc")
+	pairUpdateCmd.Flags().String(urlFlag, "https://rpc.ankr.com/bsc", "rpc url")
+}
@@ -45,8 +45,36 @@ to quickly create a Cobra application.`,
 			return
 		}
 		token0, token1 := args[0], args[1]
-		db := database.NewDb(config.GetConfig())
-		paths := database.QueryRoute(db, token0, token1)
+		minTracked, _ := cmd.Flags().GetFloat64(minTrackedFlag)
+		includeRisky, _ := cmd.Flags().GetBool(includeRiskyFlag)
+		verifiedOnly, _ := cmd.Flags().GetBool(verifiedOnlyFlag)
+		store, err := database.OpenStore(config.GetConfig())
+		if err != nil {
+			log.Errorf("open db failed with err:(%s)", err)
+			return
+		}
+		defer store.Close()
+		paths, err := store.QueryRoutes(token0, token1, 0, minTracked)
+		if err != nil {
+			log.Errorf("query route failed with err:(%s)", err)
+			return
+		}
+		if !includeRisky {
+			risks, err := database.LoadRiskSet(store)
+			if err != nil {
+				log.Errorf("load token risks failed with err:(%s)", err)
+				return
+			}
+			paths = risks.FilterRoutes(paths)
+		}
+		if verifiedOnly {
+			verified, err := database.LoadVerifiedSet(store)
+			if err != nil {
+				log.Errorf("load verified tokens failed with err:(%s)", err)
+				return
+			}
+			paths = verified.FilterRoutes(paths)
+		}
 		for i, path := range paths {
 			route := fmt.Sprintf("path[%d]=", i)
 			for n, step := range path.Steps {
@@ -65,6 +93,9 @@ to quickly create a Cobra application.`,
 
 func init() {
 	rootCmd.AddCommand(queryCmd)
+	queryCmd.Flags().Float64(minTrackedFlag, 0, "only route over the pairs with more tracked liquidity")
+	queryCmd.Flags().Bool(includeRiskyFlag, false, "keep the routes through the tokens flagged as risky")
+	queryCmd.Flags().Bool(verifiedOnlyFlag, false, "only keep the routes through the verified tokens of the token lists")
 
 	// Here you will define your flags and configuration settings.
 
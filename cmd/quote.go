@@ -0,0 +1,127 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/types"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// Quoter attaches quote snapshots to the dumped routes, the reference sizes are
+// amounts of the base token (eg: a USD stable coin).
+type Quoter struct {
+	sizes []float64
+	base  string
+	one   *big.Float // one whole base token in raw units
+
+	mu    sync.Mutex
+	units map[string]*big.Float // raw amount of a token worth one whole base token
+}
+
+// NewQuoter returns nil if there is no size or base token, a nil Quoter does nothing.
+func NewQuoter(sizes []float64, base string, baseDecimals int) *Quoter {
+	if len(sizes) == 0 || len(base) == 0 {
+		return nil
+	}
+	one := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(baseDecimals)), nil))
+	return &Quoter{
+		sizes: sizes,
+		base:  base,
+		one:   one,
+		units: make(map[string]*big.Float),
+	}
+}
+
+// unit returns the raw amount of token worth one whole base token, it is priced by
+// the deepest direct pair between the base token and token.
+func (q *Quoter) unit(db database.Store, token string) *big.Float {
+	if strings.EqualFold(token, q.base) {
+		return q.one
+	}
+	q.mu.Lock()
+	unit, exist := q.units[strings.ToLower(token)]
+	q.mu.Unlock()
+	if exist {
+		return unit
+	}
+
+	var deepest *big.Int
+	routes, err := db.QueryRoutes(q.base, token, 1, 0)
+	if err != nil {
+		log.WithField("err", err).WithField("token", token).Error("query base pair failed")
+	}
+	for _, route := range routes {
+		for _, step := range route.Steps {
+			for _, pair := range step.Pairs {
+				reserveBase, reserveToken, ok := pair.ReservesFor(q.base)
+				if !ok || (deepest != nil && reserveBase.Cmp(deepest) <= 0) {
+					continue
+				}
+				deepest = reserveBase
+				unit = new(big.Float).Quo(new(big.Float).SetInt(reserveToken), new(big.Float).SetInt(reserveBase))
+				unit.Mul(unit, q.one)
+			}
+		}
+	}
+	if unit == nil {
+		log.WithField("token", token).Debug("no pair with reserves to price token")
+	}
+	q.mu.Lock()
+	q.units[strings.ToLower(token)] = unit
+	q.mu.Unlock()
+	return unit
+}
+
+// Quote attaches a quote snapshot for every reference size to the routes.
+func (q *Quoter) Quote(db database.Store, routes []*types.TokenRoute) {
+	if q == nil || len(routes) == 0 || len(routes[0].Steps) == 0 {
+		return
+	}
+	unit := q.unit(db, routes[0].Steps[0].Src)
+	if unit == nil {
+		return
+	}
+	for _, route := range routes {
+		route.Quotes = make([]types.QuoteSnapshot, 0, len(q.sizes))
+		for _, size := range q.sizes {
+			amountIn, _ := new(big.Float).Mul(unit, big.NewFloat(size)).Int(nil)
+			if amountIn.Sign() <= 0 {
+				continue
+			}
+			amountOut, impact, block, ok := types.QuoteRoute(route, amountIn)
+			if !ok {
+				break
+			}
+			route.Quotes = append(route.Quotes, types.QuoteSnapshot{
+				Size:        size,
+				AmountIn:    amountIn.String(),
+				AmountOut:   amountOut.String(),
+				PriceImpact: impact,
+				Block:       block,
+			})
+		}
+	}
+}
@@ -0,0 +1,344 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/dataset"
+	"github.com/xueqianLu/routegen/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dryRunFlag       = "dry-run"
+	includeRiskyFlag = "include-risky"
+
+	// riskSourceDetect is the source of the risks found by risk detect.
+	riskSourceDetect = "detect"
+	// probeTimeout bounds the simulations of one token.
+	probeTimeout = time.Minute
+)
+
+var riskCmd = &cobra.Command{
+	Use:   "risk",
+	Short: "Manage the token risk flags, the routes through the flagged tokens are excluded",
+}
+
+var riskImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a blocklist and allowlist file of tokens",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		list, err := dataset.ReadRiskList(args[0])
+		if err != nil {
+			log.WithField("err", err).Errorf("read risk list %s failed", args[0])
+			return
+		}
+		risks, err := list.Risks("list:" + filepath.Base(args[0]))
+		if err != nil {
+			log.WithField("err", err).Errorf("invalid risk list %s", args[0])
+			return
+		}
+		db, err := openSpaceStore(cmd, config.GetConfig(), false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		addresses, err := tokenAddresses(db)
+		if err != nil {
+			log.WithField("err", err).Error("read tokens failed")
+			return
+		}
+		for _, risk := range risks {
+			if address, exist := addresses[strings.ToLower(risk.Address)]; exist {
+				risk.Address = address
+			}
+			if err = db.SetTokenRisk(risk); err != nil {
+				log.WithField("err", err).Errorf("set risk of token %s failed", risk.Address)
+				return
+			}
+		}
+		log.Infof("import %d blocked and %d allowed tokens from %s", len(list.Blocklist), len(list.Allowlist), args[0])
+	},
+}
+
+var riskDetectCmd = &cobra.Command{
+	Use:   "detect",
+	Short: "Simulate the transfers of the tokens with eth_call and flag the honeypot and fee-on-transfer tokens",
+	Long: `Simulate a transfer of 1% of the balance of the deepest pool of each token out of the
+pool, like a buy, and back into the pool from a probe address, like a sell. A token
+whose transfer fails is flagged as honeypot, and a token that takes a fee from the sell
+is flagged as fee-on-transfer. The node of --url, or risk_rpc in the config, must support
+the state override of eth_call. The allowlisted and blocklisted tokens are skipped, and
+the former detected flags of the clean tokens are cleared.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		url, _ := cmd.Flags().GetString(urlFlag)
+		tokens, _ := cmd.Flags().GetStringSlice(tokenFlag)
+		routine, _ := cmd.Flags().GetUint(routineFlag)
+		dryRun, _ := cmd.Flags().GetBool(dryRunFlag)
+		conf := config.GetConfig()
+		if len(url) == 0 {
+			url = conf.RiskRPC
+		}
+		if len(url) == 0 {
+			log.Errorf("no node to simulate the transfers, set --%s or risk_rpc", urlFlag)
+			return
+		}
+		if routine == 0 {
+			routine = 1
+		}
+		db, err := openSpaceStore(cmd, conf, false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		risks, err := database.LoadRiskSet(db)
+		if err != nil {
+			log.WithField("err", err).Error("read token risks failed")
+			return
+		}
+		pools, err := deepestPools(db)
+		if err != nil {
+			log.WithField("err", err).Error("read pairs failed")
+			return
+		}
+		if len(tokens) == 0 {
+			for token := range pools {
+				tokens = append(tokens, token)
+			}
+			sort.Strings(tokens)
+		}
+		prober, err := contracts.DialTokenProber(url)
+		if err != nil {
+			log.WithField("err", err).Error("dial rpc failed")
+			return
+		}
+		defer prober.Close()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		results := make([]riskResult, 0, len(tokens))
+		queue := make(chan database.PairRecord)
+		for i := uint(0); i < routine; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for pool := range queue {
+					result := probeToken(prober, pool)
+					mu.Lock()
+					results = append(results, result)
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, token := range tokens {
+			if risk, exist := risks.Get(token); exist && risk.Source != riskSourceDetect {
+				continue
+			}
+			pool, exist := pools[strings.ToLower(token)]
+			if !exist {
+				log.Warnf("token %s has no pool", token)
+				continue
+			}
+			queue <- pool
+		}
+		close(queue)
+		wg.Wait()
+
+		sort.Slice(results, func(i, j int) bool { return results[i].risk.Address < results[j].risk.Address })
+		table := [][]string{{"TOKEN", "POOL", "FLAG", "REASON"}}
+		flagged := 0
+		for _, result := range results {
+			flag, reason := result.risk.Flag, result.risk.Reason
+			if result.err != nil {
+				flag, reason = "error", result.err.Error()
+			} else if len(flag) == 0 {
+				flag = "-"
+			}
+			table = append(table, []string{result.risk.Address, result.pool, flag, reason})
+			if result.err != nil || dryRun {
+				continue
+			}
+			if result.risk.Flagged() {
+				flagged++
+			} else if _, exist := risks.Get(result.risk.Address); !exist {
+				// nothing to clear.
+				continue
+			}
+			if err = db.SetTokenRisk(result.risk); err != nil {
+				log.WithField("err", err).Errorf("set risk of token %s failed", result.risk.Address)
+				return
+			}
+		}
+		printTable(table)
+		fmt.Printf("%d tokens probed, %d flagged\n", len(results), flagged)
+	},
+}
+
+var riskListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the token risk flags",
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString(formatFlag)
+		db, err := openSpaceStore(cmd, config.GetConfig(), false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		risks, err := db.TokenRisks()
+		if err != nil {
+			log.WithField("err", err).Error("read token risks failed")
+			return
+		}
+		switch format {
+		case outputJSON:
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err = enc.Encode(risks); err != nil {
+				log.WithField("err", err).Error("encode token risks failed")
+			}
+		case outputTable:
+			table := [][]string{{"TOKEN", "FLAG", "SOURCE", "REASON"}}
+			for _, risk := range risks {
+				table = append(table, []string{risk.Address, risk.Flag, risk.Source, risk.Reason})
+			}
+			printTable(table)
+		default:
+			log.Errorf("unknown format (%s), want %s or %s", format, outputTable, outputJSON)
+		}
+	},
+}
+
+var riskClearCmd = &cobra.Command{
+	Use:   "clear <tokens>",
+	Short: "Clear the risk flags of the tokens",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := openSpaceStore(cmd, config.GetConfig(), false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		risks, err := database.LoadRiskSet(db)
+		if err != nil {
+			log.WithField("err", err).Error("read token risks failed")
+			return
+		}
+		for _, token := range args {
+			risk, exist := risks.Get(token)
+			if !exist {
+				log.Warnf("token %s has no risk flag", token)
+				continue
+			}
+			if err = db.SetTokenRisk(database.TokenRisk{Address: risk.Address}); err != nil {
+				log.WithField("err", err).Errorf("clear risk of token %s failed", token)
+				return
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(riskCmd)
+	riskCmd.AddCommand(riskImportCmd, riskDetectCmd, riskListCmd, riskClearCmd)
+	riskCmd.PersistentFlags().String(spaceFlag, "", "nebula space, the active space by default")
+	riskDetectCmd.Flags().String(urlFlag, "", "rpc url of the node, risk_rpc of the config by default")
+	riskDetectCmd.Flags().StringSlice(tokenFlag, nil, "only probe these tokens, all the tokens by default")
+	riskDetectCmd.Flags().Uint(routineFlag, 4, "count of the tokens probed at the same time")
+	riskDetectCmd.Flags().Bool(dryRunFlag, false, "only print the results, do not change the flags")
+	riskListCmd.Flags().String(formatFlag, outputTable, "output format (table, json)")
+}
+
+// tokenAddresses returns the addresses of the tokens as stored, keyed by the lower case address.
+func tokenAddresses(db database.Store) (map[string]string, error) {
+	tokens, err := db.Tokens()
+	if err != nil {
+		return nil, err
+	}
+	addresses := make(map[string]string, len(tokens))
+	for _, token := range tokens {
+		addresses[strings.ToLower(token.Address)] = token.Address
+	}
+	return addresses, nil
+}
+
+// deepestPools returns the pair edge from each token with the most tracked liquidity,
+// keyed by the lower case token.
+func deepestPools(db database.Store) (map[string]database.PairRecord, error) {
+	pairs, err := db.Pairs()
+	if err != nil {
+		return nil, err
+	}
+	pools := make(map[string]database.PairRecord)
+	for _, pair := range pairs {
+		token := strings.ToLower(pair.Src)
+		if best, exist := pools[token]; !exist || pair.Tracked > best.Tracked {
+			pools[token] = pair
+		}
+	}
+	return pools, nil
+}
+
+type riskResult struct {
+	pool string
+	risk database.TokenRisk // an empty flag for a clean token
+	err  error
+}
+
+// probeToken simulates the transfers of the source token of pool, and returns its risk.
+func probeToken(prober *contracts.TokenProber, pool database.PairRecord) riskResult {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	result := riskResult{pool: pool.Pair, risk: database.TokenRisk{Address: pool.Src, Source: riskSourceDetect}}
+	probe, err := prober.Probe(ctx, pool.Src, pool.Pair)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	switch {
+	case probe.BuyFails:
+		result.risk.Flag, result.risk.Reason = database.RiskHoneypot, "transfer out of the pool fails"
+	case probe.SellFails:
+		result.risk.Flag, result.risk.Reason = database.RiskHoneypot, "transfer into the pool fails"
+	case probe.SellFee() > 0:
+		result.risk.Flag = database.RiskFeeOnTransfer
+		result.risk.Reason = fmt.Sprintf("%.2f%% fee on transfer", probe.SellFee()*100)
+	case !probe.SellChecked():
+		result.risk.Reason = "balances not found, sell not simulated"
+	}
+	return result
+}
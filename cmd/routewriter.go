@@ -0,0 +1,249 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/xueqianLu/routegen/types"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatLiteral = "literal"
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+
+	CompressGzip = "gz"
+	CompressZstd = "zst"
+)
+
+// RouteWriter writes the dumped routes in one output format.
+type RouteWriter interface {
+	// Write writes the routes of one token pair.
+	Write(routes []*types.TokenRoute) error
+	// Close flushes the buffered data, it does not close the underlying writer.
+	Close() error
+}
+
+// ParseFormat splits a format like "jsonl.gz" into the route format and the compression.
+func ParseFormat(format string) (string, string, error) {
+	name, compress := format, ""
+	if idx := strings.Index(format, "."); idx >= 0 {
+		name, compress = format[:idx], format[idx+1:]
+	}
+	switch name {
+	case FormatLiteral, FormatJSONL, FormatCSV:
+	default:
+		return "", "", fmt.Errorf("unknown dump format (%s)", name)
+	}
+	switch compress {
+	case "", CompressGzip, CompressZstd:
+	default:
+		return "", "", fmt.Errorf("unknown dump compression (%s)", compress)
+	}
+	return name, compress, nil
+}
+
+// NewRouteWriter creates a RouteWriter for format on w, header tells whether w is
+// a new file that needs a header line.
+func NewRouteWriter(w io.Writer, format string, header bool) (RouteWriter, error) {
+	name, compress, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	compressor, err := newCompressor(w, compress)
+	if err != nil {
+		return nil, err
+	}
+	if compressor != nil {
+		w = compressor
+	}
+
+	var writer RouteWriter
+	switch name {
+	case FormatJSONL:
+		writer = &jsonlWriter{enc: json.NewEncoder(w)}
+	case FormatCSV:
+		writer = &csvWriter{w: csv.NewWriter(w), header: header}
+	default:
+		writer = &literalWriter{w: w}
+	}
+	if compressor != nil {
+		writer = &compressedWriter{RouteWriter: writer, compressor: compressor}
+	}
+	return writer, nil
+}
+
+// newCompressor wraps w with the compression, it returns nil without compression.
+func newCompressor(w io.Writer, compress string) (io.WriteCloser, error) {
+	switch compress {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, nil
+}
+
+// newDecompressor reads the data of r written with the compression.
+func newDecompressor(r io.Reader, compress string) (io.ReadCloser, error) {
+	switch compress {
+	case CompressGzip:
+		return gzip.NewReader(r)
+	case CompressZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+type compressedWriter struct {
+	RouteWriter
+	compressor io.WriteCloser
+}
+
+func (c *compressedWriter) Close() error {
+	if err := c.RouteWriter.Close(); err != nil {
+		return err
+	}
+	return c.compressor.Close()
+}
+
+// literalWriter writes the routes as solidity array literals, same as the former dump file.
+type literalWriter struct {
+	w io.Writer
+}
+
+func (l *literalWriter) Write(routes []*types.TokenRoute) error {
+	for _, str := range convertPathToString(routes) {
+		if _, err := io.WriteString(l.w, str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *literalWriter) Close() error {
+	return nil
+}
+
+// jsonlWriter writes one full TokenRoute in json per line, with the tracked liquidity
+// of the pairs and the score that the route api leaves out.
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+type jsonlPair struct {
+	types.RoutePairInfo
+	Tracked string `json:"tracked"`
+}
+
+type jsonlStep struct {
+	Pairs []jsonlPair `json:"pair"`
+	Src   string      `json:"from"`
+	Dst   string      `json:"to"`
+}
+
+type jsonlRoute struct {
+	Steps  []jsonlStep           `json:"steps"`
+	Score  float64               `json:"score"`
+	Quotes []types.QuoteSnapshot `json:"quotes,omitempty"`
+}
+
+func (j *jsonlWriter) Write(routes []*types.TokenRoute) error {
+	for _, route := range routes {
+		record := jsonlRoute{
+			Steps:  make([]jsonlStep, len(route.Steps)),
+			Score:  route.Score,
+			Quotes: route.Quotes,
+		}
+		for i, step := range route.Steps {
+			record.Steps[i] = jsonlStep{Pairs: make([]jsonlPair, len(step.Pairs)), Src: step.Src, Dst: step.Dst}
+			for k, pair := range step.Pairs {
+				record.Steps[i].Pairs[k] = jsonlPair{RoutePairInfo: pair, Tracked: pair.Tracked}
+			}
+		}
+		if err := j.enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes one row per route step, the pairs in a step are joined with '|'.
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+	route  int
+}
+
+var csvHeader = []string{"route", "hop", "from", "to", "pairs", "dexes", "fees", "tracked", "score"}
+
+func (c *csvWriter) Write(routes []*types.TokenRoute) error {
+	if c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = false
+	}
+	for _, route := range routes {
+		score := strconv.FormatFloat(route.Score, 'f', -1, 64)
+		for hop, step := range route.Steps {
+			pairs := make([]string, len(step.Pairs))
+			dexes := make([]string, len(step.Pairs))
+			fees := make([]string, len(step.Pairs))
+			tracked := make([]string, len(step.Pairs))
+			for i, pair := range step.Pairs {
+				pairs[i], dexes[i], fees[i], tracked[i] = pair.Pair, pair.Dex, pair.Fee, pair.Tracked
+			}
+			row := []string{
+				strconv.Itoa(c.route), strconv.Itoa(hop), step.Src, step.Dst,
+				strings.Join(pairs, "|"), strings.Join(dexes, "|"), strings.Join(fees, "|"),
+				strings.Join(tracked, "|"), score,
+			}
+			if err := c.w.Write(row); err != nil {
+				return err
+			}
+		}
+		c.route++
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,161 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+	"os"
+)
+
+const spaceFlag = "space"
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Backup and restore the graph independent of the database",
+}
+
+var snapshotExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Export all the tokens and pairs to a compressed snapshot file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := config.GetConfig()
+		db, err := openSpaceStore(cmd, conf, false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		snapshot, err := database.ReadSnapshot(db)
+		if err != nil {
+			log.WithField("err", err).Error("read graph failed")
+			return
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			log.WithField("err", err).Error("create snapshot file failed")
+			return
+		}
+		if err = snapshot.Write(f); err == nil {
+			err = f.Close()
+		} else {
+			f.Close()
+		}
+		if err != nil {
+			log.WithField("err", err).Error("write snapshot failed")
+			return
+		}
+		printSnapshotHeader(&snapshot.Header)
+	},
+}
+
+var snapshotImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a snapshot file into the configured database",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initdb, _ := cmd.Flags().GetBool(initDBFlag)
+		noRebuild, _ := cmd.Flags().GetBool(noRebuildFlag)
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.WithField("err", err).Error("open snapshot file failed")
+			return
+		}
+		snapshot, err := database.LoadSnapshot(f)
+		f.Close()
+		if err != nil {
+			log.WithField("err", err).Errorf("load snapshot %s failed", args[0])
+			return
+		}
+		printSnapshotHeader(&snapshot.Header)
+
+		conf := config.GetConfig()
+		db, err := openSpaceStore(cmd, conf, true)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		if initdb {
+			if err = db.Prepare(); err != nil {
+				log.WithField("err", err).Error("prepare db failed")
+				return
+			}
+		}
+		if err = snapshot.Restore(db); err != nil {
+			log.WithField("err", err).Error("restore snapshot failed")
+			return
+		}
+		if !noRebuild {
+			if err = db.RebuildIndexes(); err != nil {
+				log.WithField("err", err).Error("rebuild index failed")
+			}
+		}
+		log.Infof("import snapshot %s finished", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotExportCmd, snapshotImportCmd)
+	snapshotCmd.PersistentFlags().String(spaceFlag, "", "nebula space, the active space for export and db_space for import by default")
+	snapshotImportCmd.Flags().Bool(initDBFlag, false, "init database")
+	snapshotImportCmd.Flags().Bool(noRebuildFlag, false, "do not rebuild the indexes after import")
+}
+
+// openSpaceStore opens the store of the config, the space flag of cmd selects the nebula space.
+func openSpaceStore(cmd *cobra.Command, conf *config.Config, importing bool) (database.Store, error) {
+	space, _ := cmd.Flags().GetString(spaceFlag)
+	if !database.IsNebula(conf) {
+		return database.OpenStore(conf)
+	}
+	if len(space) > 0 {
+		return database.OpenNebulaStore(conf, space)
+	}
+	if importing {
+		active, err := activeSpaceName(nil)
+		if err != nil {
+			return nil, err
+		}
+		return openImportStore(conf, active)
+	}
+	return database.OpenStore(conf)
+}
+
+func printSnapshotHeader(header *database.SnapshotHeader) {
+	table := [][]string{
+		{"format", fmt.Sprint(header.Format)},
+		{"created", header.Created.Format("2006-01-02 15:04:05")},
+		{"graph version", header.GraphVersion},
+		{"tokens", fmt.Sprint(header.Tokens)},
+		{"pairs", fmt.Sprint(header.Pairs)},
+		{"checksum", header.Checksum},
+	}
+	for _, source := range header.Sources {
+		table = append(table, []string{"source", source.File + " " + source.Sha256})
+	}
+	printTable(table)
+}
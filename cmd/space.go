@@ -0,0 +1,199 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+	"strings"
+)
+
+const (
+	sampleFlag     = "sample"
+	ratioFlag      = "ratio"
+	noValidateFlag = "no-validate"
+)
+
+// parseSamples parses the sample queries in "src:dst" form.
+func parseSamples(samples []string) ([][2]string, error) {
+	parsed := make([][2]string, 0, len(samples))
+	for _, sample := range samples {
+		src, dst, found := strings.Cut(sample, ":")
+		if !found || len(src) == 0 || len(dst) == 0 {
+			return nil, fmt.Errorf("invalid sample (%s), want src:dst", sample)
+		}
+		parsed = append(parsed, [2]string{src, dst})
+	}
+	return parsed, nil
+}
+
+func validateOptions(cmd *cobra.Command) (database.ValidateOptions, error) {
+	sampleArgs, _ := cmd.Flags().GetStringSlice(sampleFlag)
+	ratio, _ := cmd.Flags().GetFloat64(ratioFlag)
+	samples, err := parseSamples(sampleArgs)
+	return database.ValidateOptions{Ratio: ratio, Samples: samples}, err
+}
+
+func addValidateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice(sampleFlag, nil, "token pairs in src:dst that must have routes, sampled from the space if not set")
+	cmd.Flags().Float64(ratioFlag, database.DefaultValidateRatio, "least ratio of the tokens and pairs compared with the active space")
+}
+
+// validateSpace checks space with opts, the counts of the active space are the baseline.
+func validateSpace(conf *config.Config, space string, opts database.ValidateOptions) error {
+	active, err := database.ActiveSpace(conf)
+	if err != nil {
+		return err
+	}
+	if active != space {
+		activeDb, err := database.NewDbForSpace(conf, active)
+		if err == nil {
+			opts.Baseline, err = database.CountSpace(activeDb)
+			activeDb.Close()
+		}
+		if err != nil {
+			log.Warnf("count active space %s failed, validate without baseline: %s", active, err)
+		}
+	}
+	db, err := database.NewDbForSpace(conf, space)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = database.ValidateSpace(db, opts)
+	return err
+}
+
+// switchSpace points the service to space.
+func switchSpace(conf *config.Config, space string) error {
+	controller, err := database.NewSpaceController(conf)
+	if err != nil {
+		return err
+	}
+	defer controller.Close()
+	return controller.Switch(space)
+}
+
+var dbValidateCmd = &cobra.Command{
+	Use:   "validate [space]",
+	Short: "Validate the space with the counts and sample queries",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := validateOptions(cmd)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		space, err := activeSpaceName(args)
+		if err != nil {
+			log.Errorf("get active space failed with err:(%s)", err)
+			return
+		}
+		if err = validateSpace(config.GetConfig(), space, opts); err != nil {
+			log.Errorf("validate space %s failed with err:(%s)", space, err)
+		} else {
+			log.Infof("validate space %s passed", space)
+		}
+	},
+}
+
+var dbActiveSpaceCmd = &cobra.Command{
+	Use:   "active-space",
+	Short: "Show the space the service uses and the previous one",
+	Run: func(cmd *cobra.Command, args []string) {
+		controller, err := database.NewSpaceController(config.GetConfig())
+		if err != nil {
+			log.Errorf("connect control space failed with err:(%s)", err)
+			return
+		}
+		defer controller.Close()
+		active, err := controller.Active()
+		if err != nil {
+			log.Errorf("get active space failed with err:(%s)", err)
+			return
+		}
+		previous, err := controller.Previous()
+		if err != nil {
+			log.Errorf("get previous space failed with err:(%s)", err)
+			return
+		}
+		fmt.Printf("active space: %s, previous space: %s\n", active, previous)
+	},
+}
+
+var dbSwitchSpaceCmd = &cobra.Command{
+	Use:   "switch-space <space>",
+	Short: "Switch the service to the space after it is validated",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conf := config.GetConfig()
+		space := args[0]
+		if noValidate, _ := cmd.Flags().GetBool(noValidateFlag); !noValidate {
+			opts, err := validateOptions(cmd)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			if err = validateSpace(conf, space, opts); err != nil {
+				log.Errorf("validate space %s failed with err:(%s)", space, err)
+				return
+			}
+		}
+		if err := switchSpace(conf, space); err != nil {
+			log.Errorf("switch to space %s failed with err:(%s)", space, err)
+		} else {
+			log.Infof("switch to space %s finished", space)
+		}
+	},
+}
+
+var dbRollbackSpaceCmd = &cobra.Command{
+	Use:   "rollback-space",
+	Short: "Switch the service back to the previous space",
+	Run: func(cmd *cobra.Command, args []string) {
+		controller, err := database.NewSpaceController(config.GetConfig())
+		if err != nil {
+			log.Errorf("connect control space failed with err:(%s)", err)
+			return
+		}
+		defer controller.Close()
+		if err = controller.Rollback(); err != nil {
+			log.Errorf("rollback space failed with err:(%s)", err)
+			return
+		}
+		active, _ := controller.Active()
+		log.Infof("rollback to space %s finished", active)
+	},
+}
+
+func init() {
+	dbCmd.AddCommand(dbValidateCmd)
+	dbCmd.AddCommand(dbActiveSpaceCmd)
+	dbCmd.AddCommand(dbSwitchSpaceCmd)
+	dbCmd.AddCommand(dbRollbackSpaceCmd)
+	addValidateFlags(dbValidateCmd)
+	addValidateFlags(dbSwitchSpaceCmd)
+	dbSwitchSpaceCmd.Flags().Bool(noValidateFlag, false, "switch without validating the space")
+}
@@ -0,0 +1,255 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/dataset"
+	"github.com/xueqianLu/routegen/log"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	chainIDFlag      = "chain-id"
+	verifiedFlag     = "verified"
+	verifiedOnlyFlag = "verified-only"
+	listNameFlag     = "name"
+
+	// defaultChainID is the chain of the PancakeSwap pairs, BNB Smart Chain.
+	defaultChainID = 56
+)
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Import and export the token metadata as Uniswap token lists",
+}
+
+var tokensImportCmd = &cobra.Command{
+	Use:   "import <tokenlist.json>",
+	Short: "Enrich the tokens of the graph with a token list and mark them as verified",
+	Long: `Set the chain id, symbol, decimals, logo and tags of the list to the tokens of the
+graph, the tokens of the list on the other chains or not in the graph are skipped. The
+tokens are marked as verified unless --verified=false, the verified only routes go
+through the verified tokens only. A token without name takes the name of the list.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		chainID, _ := cmd.Flags().GetInt64(chainIDFlag)
+		verified, _ := cmd.Flags().GetBool(verifiedFlag)
+		list, err := dataset.ReadTokenList(args[0])
+		if err != nil {
+			log.WithField("err", err).Errorf("read token list %s failed", args[0])
+			return
+		}
+		infos, err := list.Infos(chainID, verified)
+		if err != nil {
+			log.WithField("err", err).Errorf("invalid token list %s", args[0])
+			return
+		}
+		db, err := openSpaceStore(cmd, config.GetConfig(), false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		tokens, err := db.Tokens()
+		if err != nil {
+			log.WithField("err", err).Error("read tokens failed")
+			return
+		}
+		known := make(map[string]database.TokenRecord, len(tokens))
+		for _, token := range tokens {
+			known[strings.ToLower(token.Address)] = token
+		}
+		imported := 0
+		for _, info := range infos {
+			token, exist := known[strings.ToLower(info.Address)]
+			if !exist {
+				continue
+			}
+			info.Address = token.Address
+			if len(token.Name) == 0 && len(info.Name) > 0 {
+				if err = db.InsertToken(info.Name, token.Address); err != nil {
+					log.WithField("err", err).Errorf("set name of token %s failed", token.Address)
+					return
+				}
+			}
+			if err = db.SetTokenInfo(info); err != nil {
+				log.WithField("err", err).Errorf("set info of token %s failed", token.Address)
+				return
+			}
+			imported++
+		}
+		log.Infof("import %d tokens from %s, %d on other chains, %d not in the graph", imported, args[0],
+			len(list.Tokens)-len(infos), len(infos)-imported)
+	},
+}
+
+var tokensExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the routable tokens as a token list, to stdout without file",
+	Long: `Export the tokens with a pair as a Uniswap token list, the tokens flagged as risky are
+left out unless --include-risky. The symbol and decimals come from the imported token
+lists, the tokens without are read from the node of --url, or skipped without it.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		chainID, _ := cmd.Flags().GetInt64(chainIDFlag)
+		name, _ := cmd.Flags().GetString(listNameFlag)
+		url, _ := cmd.Flags().GetString(urlFlag)
+		includeRisky, _ := cmd.Flags().GetBool(includeRiskyFlag)
+		verifiedOnly, _ := cmd.Flags().GetBool(verifiedOnlyFlag)
+		db, err := openSpaceStore(cmd, config.GetConfig(), false)
+		if err != nil {
+			log.WithField("err", err).Error("open db failed")
+			return
+		}
+		defer db.Close()
+		entries, skipped, err := routableTokens(db, chainID, url, includeRisky, verifiedOnly)
+		if err != nil {
+			log.WithField("err", err).Error("read tokens failed")
+			return
+		}
+		if skipped > 0 {
+			log.Warnf("skip %d tokens without symbol or decimals, set --%s to read them from the node", skipped, urlFlag)
+		}
+		var w io.Writer = os.Stdout
+		if len(args) > 0 {
+			f, err := os.Create(args[0])
+			if err != nil {
+				log.WithField("err", err).Error("create token list file failed")
+				return
+			}
+			defer f.Close()
+			w = f
+		}
+		if err = dataset.NewTokenList(name, entries).Write(w); err != nil {
+			log.WithField("err", err).Error("write token list failed")
+			return
+		}
+		if len(args) > 0 {
+			fmt.Printf("%d tokens exported to %s\n", len(entries), args[0])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tokensCmd)
+	tokensCmd.AddCommand(tokensImportCmd, tokensExportCmd)
+	tokensCmd.PersistentFlags().String(spaceFlag, "", "nebula space, the active space by default")
+	tokensCmd.PersistentFlags().Int64(chainIDFlag, defaultChainID, "chain id of the tokens")
+	tokensImportCmd.Flags().Bool(verifiedFlag, true, "mark the tokens of the list as verified")
+	tokensExportCmd.Flags().String(listNameFlag, "routegen", "name of the token list")
+	tokensExportCmd.Flags().String(urlFlag, "", "rpc url of the node to read the symbol and decimals of the tokens not in a token list")
+	tokensExportCmd.Flags().Bool(includeRiskyFlag, false, "keep the tokens flagged as risky")
+	tokensExportCmd.Flags().Bool(verifiedOnlyFlag, false, "only export the verified tokens")
+}
+
+// routableTokens returns the token list entries of the tokens with a pair ordered by
+// address, and the count of the tokens skipped for lack of symbol or decimals. The
+// tokens without info are read from the node at url if it is set.
+func routableTokens(db database.Store, chainID int64, url string, includeRisky, verifiedOnly bool) ([]dataset.TokenListEntry, int, error) {
+	tokens, err := db.Tokens()
+	if err != nil {
+		return nil, 0, err
+	}
+	pools, err := deepestPools(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	risks, err := database.LoadRiskSet(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	stored, err := db.TokenInfos()
+	if err != nil {
+		return nil, 0, err
+	}
+	infos := make(map[string]database.TokenInfo, len(stored))
+	for _, info := range stored {
+		infos[strings.ToLower(info.Address)] = info
+	}
+	var client *ethclient.Client
+	if len(url) > 0 {
+		if client, err = ethclient.Dial(url); err != nil {
+			return nil, 0, err
+		}
+		defer client.Close()
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return strings.ToLower(tokens[i].Address) < strings.ToLower(tokens[j].Address)
+	})
+	entries := make([]dataset.TokenListEntry, 0, len(tokens))
+	skipped := 0
+	for _, token := range tokens {
+		address := strings.ToLower(token.Address)
+		if _, exist := pools[address]; !exist {
+			continue
+		}
+		if !includeRisky && risks.Flagged(address) {
+			continue
+		}
+		info, exist := infos[address]
+		if verifiedOnly && !info.Verified {
+			continue
+		}
+		if !exist || info.ChainID != chainID {
+			info = database.TokenInfo{Address: token.Address}
+			if client == nil {
+				skipped++
+				continue
+			}
+			symbol, decimals, err := contracts.GetTokenSymbol(client, token.Address)
+			if err != nil || len(symbol) == 0 {
+				log.WithField("err", err).Warnf("read symbol of token %s failed", token.Address)
+				skipped++
+				continue
+			}
+			info.Symbol, info.Decimals = symbol, int(decimals)
+		}
+		entry := dataset.TokenListEntry{
+			ChainID:  chainID,
+			Address:  common.HexToAddress(token.Address).Hex(),
+			Name:     info.Name,
+			Symbol:   info.Symbol,
+			Decimals: info.Decimals,
+			LogoURI:  info.LogoURI,
+			Tags:     info.Tags,
+		}
+		if len(entry.Name) == 0 {
+			entry.Name = token.Name
+		}
+		if len(entry.Name) == 0 {
+			entry.Name = entry.Symbol
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, nil
+}
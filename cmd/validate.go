@@ -0,0 +1,67 @@
+/*
+Copyright © 2023 xueqianLu
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/dataset"
+	"github.com/xueqianLu/routegen/log"
+	"os"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <files>",
+	Short: "Check the import data files and report the problems with file and line",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		verifier, err := dataset.NewPairVerifier(config.GetConfig().Dexes)
+		if err != nil {
+			log.WithField("err", err).Error("invalid dex config")
+			return
+		}
+		validator := dataset.NewValidator(verifier)
+		total := 0
+		for _, datafile := range args {
+			issues, err := validator.File(datafile)
+			if err != nil {
+				log.WithField("err", err).Errorf("read %s failed", datafile)
+				total++
+				continue
+			}
+			for _, issue := range issues {
+				fmt.Println(issue)
+			}
+			total += len(issues)
+		}
+		if total > 0 {
+			fmt.Printf("%d problems in %d files\n", total, len(args))
+			os.Exit(1)
+		}
+		fmt.Printf("%d files ok\n", len(args))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -7,11 +7,37 @@ import (
 )
 
 type Config struct {
-	DbHost     string `toml:"db_host"`
-	DbSpace    string `toml:"db_space"`
-	DbUser     string `toml:"db_username"`
-	DbPasswd   string `toml:"db_password"`
-	ServerAddr string `toml:"server_addr"`
+	DbDriver         string `toml:"db_driver"`
+	DbDSN            string `toml:"db_dsn"`
+	DbHost           string `toml:"db_host"`
+	DbSpace          string `toml:"db_space"`
+	DbUser           string `toml:"db_username"`
+	DbPasswd         string `toml:"db_password"`
+	ServerAddr       string `toml:"server_addr"`
+	DbHeartbeat      int    `toml:"db_heartbeat"`
+	DbPartitions     int    `toml:"db_partitions"`
+	DbReplicas       int    `toml:"db_replicas"`
+	DbVidLength      int    `toml:"db_vid_length"`
+	DbControlSpace   string `toml:"db_control_space"`
+	SpaceCheckPeriod int    `toml:"space_check_period"`
+	RouteCacheSize   int    `toml:"route_cache_size"`
+	RouteCacheTTL    int    `toml:"route_cache_ttl"`
+	AsymmetricRoutes bool   `toml:"asymmetric_routes"`
+	AdminToken       string `toml:"admin_token"`
+	RiskRPC          string `toml:"risk_rpc"`
+	RiskRefresh      int    `toml:"risk_refresh_period"`
+	IndexRefresh     int    `toml:"token_index_refresh_period"`
+	BatchWorkers     int    `toml:"route_batch_workers"`
+
+	Dexes []DexConfig `toml:"dex"`
+}
+
+// DexConfig is a uniswap v2 like dex, its pair addresses are derived from the factory
+// and the init code hash of the pair contract with CREATE2.
+type DexConfig struct {
+	Name         string `toml:"name"`
+	Factory      string `toml:"factory"`
+	InitCodeHash string `toml:"init_code_hash"`
 }
 
 var _cfg *Config = nil
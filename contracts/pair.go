@@ -0,0 +1,91 @@
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"math/big"
+	"strings"
+)
+
+const pairABI = `[{"constant":true,"inputs":[],"name":"getReserves","outputs":[{"internalType":"uint112","name":"_reserve0","type":"uint112"},{"internalType":"uint112","name":"_reserve1","type":"uint112"},{"internalType":"uint32","name":"_blockTimestampLast","type":"uint32"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"token0","outputs":[{"internalType":"address","name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+var (
+	parsedPairABI, _ = abi.JSON(strings.NewReader(pairABI))
+)
+
+// PairReserves is the reserves of an uniswap v2 like pair at block.
+type PairReserves struct {
+	Reserve0 *big.Int
+	Reserve1 *big.Int
+	Block    uint64
+}
+
+// Reverse returns the reserves with token0 and token1 swapped, for the reverse pair edge.
+func (r *PairReserves) Reverse() *PairReserves {
+	if r == nil {
+		return nil
+	}
+	return &PairReserves{Reserve0: r.Reserve1, Reserve1: r.Reserve0, Block: r.Block}
+}
+
+// ParsePairReserves parses the decimal reserves, it returns nil if both reserves are empty.
+func ParsePairReserves(reserve0, reserve1 string, block uint64) (*PairReserves, error) {
+	if len(reserve0) == 0 && len(reserve1) == 0 {
+		return nil, nil
+	}
+	r0, ok0 := new(big.Int).SetString(reserve0, 10)
+	r1, ok1 := new(big.Int).SetString(reserve1, 10)
+	if !ok0 || !ok1 {
+		return nil, fmt.Errorf("invalid reserves (%s, %s)", reserve0, reserve1)
+	}
+	return &PairReserves{Reserve0: r0, Reserve1: r1, Block: block}, nil
+}
+
+// GetPairReserves reads the reserves of the pair at the latest block.
+func GetPairReserves(client *ethclient.Client, address string) (*PairReserves, error) {
+	block, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	contract := bind.NewBoundContract(common.HexToAddress(address), parsedPairABI, client, nil, nil)
+	opts := &bind.CallOpts{
+		Context:     context.Background(),
+		BlockNumber: new(big.Int).SetUint64(block),
+	}
+	var out []interface{}
+	if err := contract.Call(opts, &out, "getReserves"); err != nil {
+		return nil, err
+	}
+	return &PairReserves{
+		Reserve0: *abi.ConvertType(out[0], new(*big.Int)).(**big.Int),
+		Reserve1: *abi.ConvertType(out[1], new(*big.Int)).(**big.Int),
+		Block:    block,
+	}, nil
+}
+
+// GetPairToken0 reads the token0 of the pair, the token Reserve0 belongs to.
+func GetPairToken0(client *ethclient.Client, address string) (string, error) {
+	contract := bind.NewBoundContract(common.HexToAddress(address), parsedPairABI, client, nil, nil)
+	var out []interface{}
+	if err := contract.Call(&bind.CallOpts{Context: context.Background()}, &out, "token0"); err != nil {
+		return "", err
+	}
+	token0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+	return strings.ToLower(token0.Hex()), nil
+}
+
+// ComputePairAddress returns the CREATE2 address of the uniswap v2 like pair of the
+// tokens, the salt is the keccak256 of the sorted tokens.
+func ComputePairAddress(factory, tokenA, tokenB common.Address, initCodeHash common.Hash) common.Address {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) > 0 {
+		tokenA, tokenB = tokenB, tokenA
+	}
+	salt := crypto.Keccak256Hash(tokenA.Bytes(), tokenB.Bytes())
+	return crypto.CreateAddress2(factory, salt, initCodeHash.Bytes())
+}
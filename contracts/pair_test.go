@@ -0,0 +1,47 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The PancakeSwap v2 factory and pair init code hash on BSC.
+var (
+	pancakeFactory      = common.HexToAddress("0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73")
+	pancakeInitCodeHash = common.HexToHash("0x00fb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5")
+)
+
+func TestComputePairAddress(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokenA, tokenB string
+		pair           string
+	}{
+		{
+			name:   "WBNB/BUSD",
+			tokenA: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+			tokenB: "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56",
+			pair:   "0x58F876857a02D6762E0101bb5C46A8c1ED44Dc16",
+		},
+		{
+			name:   "USDT/WBNB",
+			tokenA: "0x55d398326f99059fF775485246999027B3197955",
+			tokenB: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+			pair:   "0x16b9a82891338f9bA80E2D6970FddA79D1eb0daE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := common.HexToAddress(tt.tokenA), common.HexToAddress(tt.tokenB)
+			want := common.HexToAddress(tt.pair)
+			if got := ComputePairAddress(pancakeFactory, a, b, pancakeInitCodeHash); got != want {
+				t.Fatalf("got %s, want %s", got.Hex(), want.Hex())
+			}
+			// the tokens are sorted, their order does not change the pair.
+			if got := ComputePairAddress(pancakeFactory, b, a, pancakeInitCodeHash); got != want {
+				t.Fatalf("got %s with the tokens swapped, want %s", got.Hex(), want.Hex())
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package contracts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MaxBalanceSlot is the last storage slot tried for the balances mapping of a token.
+const MaxBalanceSlot = 32
+
+var (
+	selectorBalanceOf = common.FromHex("0x70a08231")
+	selectorTransfer  = common.FromHex("0xa9059cbb")
+
+	// probeAddress is the holder of the simulated sells, an address without code or state.
+	probeAddress = common.BytesToAddress(crypto.Keccak256([]byte("routegen.risk.probe")))
+
+	// probeCode is put on probeAddress by the state override of the sell simulation. The
+	// calldata is the token, the recipient and the amount, 32 bytes each, it transfers the
+	// amount to the recipient and returns whether the transfer succeeded and the balance
+	// change of the recipient, so the fee is seen in one eth_call:
+	//
+	//	ok := staticcall(gas, token, balanceOf(to)) -> 0x80
+	//	mstore(0xa0, 1) // kept by the tokens that return nothing
+	//	ok &= call(gas, token, transfer(to, amount)) -> 0xa0
+	//	ok &= staticcall(gas, token, balanceOf(to)) -> 0xc0
+	//	return(ok && mload(0xa0) != 0, mload(0xc0) - mload(0x80))
+	probeCode = common.FromHex("0x6370a0823160e01b60005260203560045260206080602460006000355afa" +
+		"63a9059cbb60e01b600052602035600452604035602452600160a052602060a06044600060006000355af116" +
+		"6370a0823160e01b600052602035600452602060c0602460006000355afa16" +
+		"60a05115151660e05260805160c0510361010052604060e0f3")
+
+	ErrNoPoolBalance = errors.New("pool holds none of the token")
+)
+
+// TokenProbe is the result of the simulated transfers of a token between one of its
+// pools and the probe address.
+type TokenProbe struct {
+	Token string
+	Pool  string
+	// Amount is the amount transferred, 1% of the pool balance.
+	Amount *big.Int
+	// BuyFails is a transfer out of the pool that reverts or returns false.
+	BuyFails bool
+	// BalanceSlot is the slot of the balances mapping, -1 if it is not found, then the
+	// probe holds no token and the sell is not simulated.
+	BalanceSlot int
+	// SellFails is a transfer into the pool that reverts or returns false.
+	SellFails bool
+	// Received is the amount the pool got from the sell of Amount.
+	Received *big.Int
+}
+
+// SellChecked tells whether the sell was simulated.
+func (p *TokenProbe) SellChecked() bool {
+	return p.BalanceSlot >= 0
+}
+
+// SellFee is the part of Amount taken by the token on the sell, 0 if the sell failed
+// or was not simulated.
+func (p *TokenProbe) SellFee() float64 {
+	if !p.SellChecked() || p.SellFails || p.Received.Cmp(p.Amount) >= 0 {
+		return 0
+	}
+	lost := new(big.Float).SetInt(new(big.Int).Sub(p.Amount, p.Received))
+	fee, _ := new(big.Float).Quo(lost, new(big.Float).SetInt(p.Amount)).Float64()
+	return fee
+}
+
+// TokenProber simulates the transfers of the tokens with eth_call, the node must support
+// the state override of eth_call for the sell simulation.
+type TokenProber struct {
+	rpc    *rpc.Client
+	client *ethclient.Client
+}
+
+// DialTokenProber connects to the node at url.
+func DialTokenProber(url string) (*TokenProber, error) {
+	c, err := rpc.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenProber{rpc: c, client: ethclient.NewClient(c)}, nil
+}
+
+func (p *TokenProber) Close() {
+	p.client.Close()
+}
+
+// overrideAccount is the state override of an account in eth_call. It is not the one of
+// gethclient, which sends the empty code and the zero nonce of an override too, and so
+// wipes the code of the token.
+type overrideAccount struct {
+	Code      hexutil.Bytes               `json:"code,omitempty"`
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+}
+
+// call runs eth_call at block, from is left out if it is the zero address.
+func (p *TokenProber) call(ctx context.Context, from, to common.Address, data []byte, block *big.Int,
+	overrides map[common.Address]overrideAccount) ([]byte, error) {
+	msg := map[string]interface{}{"to": to, "data": hexutil.Bytes(data)}
+	if from != (common.Address{}) {
+		msg["from"] = from
+	}
+	params := []interface{}{msg, hexutil.EncodeBig(block)}
+	if len(overrides) > 0 {
+		params = append(params, overrides)
+	}
+	var out hexutil.Bytes
+	err := p.rpc.CallContext(ctx, &out, "eth_call", params...)
+	return out, err
+}
+
+// callFailed tells whether err is the error of the call itself, like a revert, and not
+// of the connection to the node.
+func callFailed(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
+
+func balanceOfData(holder common.Address) []byte {
+	return append(append([]byte{}, selectorBalanceOf...), common.LeftPadBytes(holder.Bytes(), 32)...)
+}
+
+func transferData(to common.Address, amount *big.Int) []byte {
+	data := append(append([]byte{}, selectorTransfer...), common.LeftPadBytes(to.Bytes(), 32)...)
+	return append(data, math.U256Bytes(new(big.Int).Set(amount))...)
+}
+
+// balanceKey is the storage key of the holder in the solidity mapping at slot.
+func balanceKey(holder common.Address, slot int) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(holder.Bytes(), 32), common.LeftPadBytes(big.NewInt(int64(slot)).Bytes(), 32))
+}
+
+func (p *TokenProber) balanceOf(ctx context.Context, token, holder common.Address, block *big.Int,
+	overrides map[common.Address]overrideAccount) (*big.Int, error) {
+	out, err := p.call(ctx, common.Address{}, token, balanceOfData(holder), block, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) < 32 {
+		return nil, fmt.Errorf("invalid balanceOf output (%x)", out)
+	}
+	return new(big.Int).SetBytes(out[:32]), nil
+}
+
+// transferOK tells whether the output of a transfer is a success, the tokens that
+// return nothing succeed.
+func transferOK(out []byte) bool {
+	return len(out) < 32 || new(big.Int).SetBytes(out[:32]).Sign() != 0
+}
+
+// Probe simulates a transfer of 1% of the pool balance of token out of the pool, like a
+// buy, and if the balances mapping of the token is found, a transfer of the same amount
+// from the probe into the pool, like a sell, which measures the transfer fee.
+func (p *TokenProber) Probe(ctx context.Context, token, pool string) (*TokenProbe, error) {
+	number, err := p.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	block := new(big.Int).SetUint64(number)
+	tokenAddr, poolAddr := common.HexToAddress(token), common.HexToAddress(pool)
+	balance, err := p.balanceOf(ctx, tokenAddr, poolAddr, block, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get pool balance failed: %w", err)
+	}
+	if balance.Sign() == 0 {
+		return nil, ErrNoPoolBalance
+	}
+	probe := &TokenProbe{Token: token, Pool: pool, BalanceSlot: -1}
+	probe.Amount = new(big.Int).Div(balance, big.NewInt(100))
+	if probe.Amount.Sign() == 0 {
+		probe.Amount.SetInt64(1)
+	}
+
+	out, err := p.call(ctx, poolAddr, tokenAddr, transferData(probeAddress, probe.Amount), block, nil)
+	switch {
+	case err != nil && !callFailed(err):
+		return nil, err
+	case err != nil || !transferOK(out):
+		probe.BuyFails = true
+	}
+
+	for slot := 0; slot <= MaxBalanceSlot; slot++ {
+		overrides := map[common.Address]overrideAccount{
+			tokenAddr: {StateDiff: map[common.Hash]common.Hash{
+				balanceKey(probeAddress, slot): common.BigToHash(probe.Amount),
+			}},
+		}
+		held, err := p.balanceOf(ctx, tokenAddr, probeAddress, block, overrides)
+		if err != nil && !callFailed(err) {
+			return nil, err
+		}
+		if err == nil && held.Cmp(probe.Amount) == 0 {
+			probe.BalanceSlot = slot
+			break
+		}
+	}
+	if !probe.SellChecked() {
+		return probe, nil
+	}
+
+	overrides := map[common.Address]overrideAccount{
+		tokenAddr: {StateDiff: map[common.Hash]common.Hash{
+			balanceKey(probeAddress, probe.BalanceSlot): common.BigToHash(probe.Amount),
+		}},
+		probeAddress: {Code: probeCode},
+	}
+	data := append(common.LeftPadBytes(tokenAddr.Bytes(), 32), common.LeftPadBytes(poolAddr.Bytes(), 32)...)
+	data = append(data, math.U256Bytes(new(big.Int).Set(probe.Amount))...)
+	if out, err = p.call(ctx, common.Address{}, probeAddress, data, block, overrides); err != nil {
+		return nil, fmt.Errorf("simulate sell failed: %w", err)
+	}
+	if len(out) < 64 {
+		return nil, fmt.Errorf("invalid probe output (%x)", out)
+	}
+	probe.SellFails = new(big.Int).SetBytes(out[:32]).Sign() == 0
+	probe.Received = new(big.Int).SetBytes(out[32:64])
+	return probe, nil
+}
@@ -25,3 +25,20 @@ func GetTokenName(client *ethclient.Client, address string) string {
 	}
 	return name
 }
+
+// GetTokenSymbol returns the symbol and the decimals of the token.
+func GetTokenSymbol(client *ethclient.Client, address string) (string, uint8, error) {
+	contract, err := erc20.NewErc20(common.HexToAddress(address), client)
+	if err != nil {
+		return "", 0, err
+	}
+	symbol, err := contract.Symbol(callOpt)
+	if err != nil {
+		return "", 0, err
+	}
+	decimals, err := contract.Decimals(callOpt)
+	if err != nil {
+		return "", 0, err
+	}
+	return symbol, decimals, nil
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/zhihu/norm"
+	"github.com/zhihu/norm/dialectors"
+)
+
+const (
+	MetaActiveSpace   = "active_space"
+	MetaPreviousSpace = "previous_space"
+
+	// DefaultValidateRatio is the least ratio of the tokens and pairs a new space must have
+	// compared with the active space.
+	DefaultValidateRatio = 0.9
+	DefaultSampleCount   = 5
+)
+
+var (
+	ErrNoControlSpace = errors.New("db_control_space is not configured")
+	ErrNoPrevious     = errors.New("no previous space to rollback")
+)
+
+// NewDbForSpace connects to the given space instead of the configured one.
+func NewDbForSpace(conf *config.Config, space string) (*norm.DB, error) {
+	dalector, err := dialectors.NewNebulaDialector(dialectors.DialectorConfig{
+		Addresses: []string{conf.DbHost},
+		Timeout:   time.Second * 5,
+		Space:     space,
+		Username:  conf.DbUser,
+		Password:  conf.DbPasswd,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return norm.Open(dalector, norm.Config{})
+}
+
+// unquote removes the quotes nebula adds to the strings in a string table.
+func unquote(s string) string {
+	return strings.Trim(s, "\"")
+}
+
+// ListSpaces returns the names of all spaces.
+func ListSpaces(db *norm.DB) ([]string, error) {
+	res, err := db.Execute("SHOW SPACES")
+	if err != nil {
+		return nil, err
+	}
+	table := res.AsStringTable()
+	spaces := make([]string, 0, len(table))
+	for i := 1; i < len(table); i++ {
+		if len(table[i]) > 0 {
+			spaces = append(spaces, unquote(table[i][0]))
+		}
+	}
+	return spaces, nil
+}
+
+// VersionedSpaceName returns the name of version of the base space, like routes_v42.
+func VersionedSpaceName(base string, version int) string {
+	return fmt.Sprintf("%s_v%d", base, version)
+}
+
+// NextSpaceName returns the versioned space after the latest existing version of base.
+func NextSpaceName(db *norm.DB, base string) (string, error) {
+	spaces, err := ListSpaces(db)
+	if err != nil {
+		return "", err
+	}
+	latest := 0
+	for _, space := range spaces {
+		if !strings.HasPrefix(space, base+"_v") {
+			continue
+		}
+		if version, err := strconv.Atoi(strings.TrimPrefix(space, base+"_v")); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return VersionedSpaceName(base, latest+1), nil
+}
+
+// SpaceController keeps the pointer to the space the service uses in the meta tag of the control space.
+type SpaceController struct {
+	conf *config.Config
+	db   *norm.DB
+}
+
+// NewSpaceController connects to the control space, it is created with the meta tag if not exist.
+func NewSpaceController(conf *config.Config) (*SpaceController, error) {
+	if len(conf.DbControlSpace) == 0 {
+		return nil, ErrNoControlSpace
+	}
+	heartbeat := time.Duration(conf.DbHeartbeat) * time.Second
+	spaceDb, err := NewSpaceDb(conf)
+	if err != nil {
+		return nil, err
+	}
+	spaces, err := ListSpaces(spaceDb)
+	if err == nil && !containsString(spaces, conf.DbControlSpace) {
+		err = CreateSpace(spaceDb, conf.DbControlSpace, SpaceOptionsFromConfig(conf), heartbeat)
+	}
+	spaceDb.Close()
+	if err != nil {
+		return nil, err
+	}
+	db, err := NewDbForSpace(conf, conf.DbControlSpace)
+	if err != nil {
+		return nil, err
+	}
+	if err = NewMigrator(db, heartbeat).prepare(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SpaceController{conf: conf, db: db}, nil
+}
+
+func (c *SpaceController) Close() {
+	c.db.Close()
+}
+
+// Active returns the space the service uses, the configured db_space if it is never switched.
+func (c *SpaceController) Active() (string, error) {
+	space, err := GetMeta(c.db, MetaActiveSpace)
+	if err != nil || len(space) > 0 {
+		return space, err
+	}
+	return c.conf.DbSpace, nil
+}
+
+// Previous returns the space used before the last switch.
+func (c *SpaceController) Previous() (string, error) {
+	return GetMeta(c.db, MetaPreviousSpace)
+}
+
+// Switch points the service to space, the former active space is kept for Rollback.
+// The service only reads the active space, so the switch takes effect with one write.
+func (c *SpaceController) Switch(space string) error {
+	active, err := c.Active()
+	if err != nil {
+		return err
+	}
+	if active == space {
+		return nil
+	}
+	if err = SetMeta(c.db, MetaPreviousSpace, active); err != nil {
+		return err
+	}
+	return SetMeta(c.db, MetaActiveSpace, space)
+}
+
+// Rollback points the service back to the previous space.
+func (c *SpaceController) Rollback() error {
+	previous, err := c.Previous()
+	if err != nil {
+		return err
+	}
+	if len(previous) == 0 {
+		return ErrNoPrevious
+	}
+	return c.Switch(previous)
+}
+
+// ActiveSpace returns the space the service should use, it is db_space if there is no control space.
+func ActiveSpace(conf *config.Config) (string, error) {
+	if len(conf.DbControlSpace) == 0 {
+		return conf.DbSpace, nil
+	}
+	db, err := NewDbForSpace(conf, conf.DbControlSpace)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	space, err := GetMeta(db, MetaActiveSpace)
+	if err != nil || len(space) > 0 {
+		return space, err
+	}
+	return conf.DbSpace, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SpaceCounts are the token and pair counts of a space.
+type SpaceCounts struct {
+	Tokens int64
+	Pairs  int64
+}
+
+// CountSpace runs a stats job and returns the token and pair counts of the space db uses.
+func CountSpace(db *norm.DB) (SpaceCounts, error) {
+	table, err := SpaceStats(db, true)
+	if err != nil {
+		return SpaceCounts{}, err
+	}
+	counts := SpaceCounts{}
+	for i := 1; i < len(table); i++ {
+		if len(table[i]) < 3 {
+			continue
+		}
+		count, err := strconv.ParseInt(unquote(table[i][2]), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch unquote(table[i][0]) + ":" + unquote(table[i][1]) {
+		case "Tag:token":
+			counts.Tokens = count
+		case "Edge:pair":
+			counts.Pairs = count
+		}
+	}
+	return counts, nil
+}
+
+// samplePairs returns some token pairs connected by a pair edge, to query routes between.
+func samplePairs(db *norm.DB, count int) ([][2]string, error) {
+	res, err := db.Execute(fmt.Sprintf("LOOKUP ON pair YIELD src(edge) AS src, dst(edge) AS dst | LIMIT %d", count))
+	if err != nil {
+		return nil, err
+	}
+	samples := make([][2]string, 0, count)
+	for i := 0; i < res.GetRowSize(); i++ {
+		values := res.GetRows()[i].GetValues()
+		src, err := decodeVid(values[0])
+		if err != nil {
+			return nil, err
+		}
+		dst, err := decodeVid(values[1])
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, [2]string{src, dst})
+	}
+	return samples, nil
+}
+
+// ValidateOptions are the checks a space must pass before the service switches to it.
+type ValidateOptions struct {
+	// Baseline are the counts of the active space, zero to skip the comparison.
+	Baseline SpaceCounts
+	// Ratio is the least ratio of the baseline counts.
+	Ratio float64
+	// Samples are the token pairs that must have routes, some connected tokens are sampled if empty.
+	Samples [][2]string
+}
+
+// ValidateSpace checks the space db uses has tokens and pairs, no less than the baseline
+// by ratio, and the sample queries return routes.
+func ValidateSpace(db *norm.DB, opts ValidateOptions) (SpaceCounts, error) {
+	counts, err := CountSpace(db)
+	if err != nil {
+		return counts, err
+	}
+	log.Infof("space has %d tokens and %d pairs", counts.Tokens, counts.Pairs)
+	if counts.Tokens == 0 || counts.Pairs == 0 {
+		return counts, errors.New("space is empty")
+	}
+	if float64(counts.Tokens) < float64(opts.Baseline.Tokens)*opts.Ratio {
+		return counts, fmt.Errorf("space has %d tokens, less than %.2f of %d", counts.Tokens, opts.Ratio, opts.Baseline.Tokens)
+	}
+	if float64(counts.Pairs) < float64(opts.Baseline.Pairs)*opts.Ratio {
+		return counts, fmt.Errorf("space has %d pairs, less than %.2f of %d", counts.Pairs, opts.Ratio, opts.Baseline.Pairs)
+	}
+	samples := opts.Samples
+	if len(samples) == 0 {
+		if samples, err = samplePairs(db, DefaultSampleCount); err != nil {
+			return counts, err
+		}
+		if len(samples) == 0 {
+			return counts, errors.New("no pair to sample")
+		}
+	}
+	for _, sample := range samples {
+		if routes := QueryRoute(db, sample[0], sample[1]); len(routes) == 0 {
+			return counts, fmt.Errorf("no route found from %s to %s", sample[0], sample[1])
+		}
+	}
+	return counts, nil
+}
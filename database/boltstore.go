@@ -0,0 +1,439 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/graph"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltSchemaVersion = "1"
+
+var (
+	boltTokens    = []byte("tokens")
+	boltAdjacency = []byte("adjacency")
+	boltMeta      = []byte("meta")
+	boltRisks     = []byte("risks")
+	boltInfos     = []byte("infos")
+
+	ErrBoltNotPrepared = errors.New("bolt store is not prepared, import with --initdb")
+)
+
+// boltPair is the pair record in the adjacency bucket of its source token.
+type boltPair struct {
+	Dex        string  `json:"dex"`
+	Pair       string  `json:"pair"`
+	Fee        int64   `json:"fee"`
+	Tracked    float64 `json:"tracked"`
+	TrackedRaw string  `json:"tracked_raw"`
+	Token0     string  `json:"token0"`
+	Token1     string  `json:"token1"`
+	Reserve0   string  `json:"reserve0,omitempty"`
+	Reserve1   string  `json:"reserve1,omitempty"`
+	Block      int64   `json:"block,omitempty"`
+}
+
+// record returns the pair edge as a PairRecord, the edge goes from token0 to token1.
+func (p *boltPair) record() PairRecord {
+	return PairRecord{
+		Src:        p.Token0,
+		Dst:        p.Token1,
+		Dex:        p.Dex,
+		Pair:       p.Pair,
+		Fee:        p.Fee,
+		Tracked:    p.Tracked,
+		TrackedRaw: p.TrackedRaw,
+		Token0:     p.Token0,
+		Token1:     p.Token1,
+		Reserve0:   p.Reserve0,
+		Reserve1:   p.Reserve1,
+		Block:      p.Block,
+	}
+}
+
+// boltFile is an open bolt file shared by the stores of a process, bolt locks the file
+// for one writer, so the dump workers and the service share one handle.
+type boltFile struct {
+	db   *bolt.DB
+	refs int
+
+	mu    sync.Mutex
+	graph *graph.Graph // loaded on the first query, dropped on writes
+}
+
+var (
+	boltFilesMu sync.Mutex
+	boltFiles   = make(map[string]*boltFile)
+)
+
+// BoltStore is the Store on an embedded bolt file, the token adjacency lists are kept
+// in a bucket per token, and the routes are searched in memory.
+type BoltStore struct {
+	path string
+	file *boltFile
+	tx   *bolt.Tx // the write transaction of a batch, nil outside of it
+}
+
+// OpenBoltStore opens or creates the bolt file at path.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	boltFilesMu.Lock()
+	defer boltFilesMu.Unlock()
+	file, exist := boltFiles[path]
+	if !exist {
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		file = &boltFile{db: db}
+		boltFiles[path] = file
+	}
+	file.refs++
+	return &BoltStore{path: path, file: file}, nil
+}
+
+func (s *BoltStore) Prepare() error {
+	return s.file.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltTokens, boltAdjacency, boltMeta, boltRisks, boltInfos} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltMeta).Put([]byte(MetaSchemaVersion), []byte(boltSchemaVersion))
+	})
+}
+
+// write runs fn in a write transaction of the prepared file, or in the transaction of the batch.
+func (s *BoltStore) write(fn func(tx *bolt.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.file.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltMeta) == nil {
+			return ErrBoltNotPrepared
+		}
+		return fn(tx)
+	})
+}
+
+// update runs fn in a write transaction, and drops the loaded graph.
+func (s *BoltStore) update(fn func(tx *bolt.Tx) error) error {
+	err := s.write(fn)
+	s.file.mu.Lock()
+	s.file.graph = nil
+	s.file.mu.Unlock()
+	return err
+}
+
+// Batch runs fn with a store on one write transaction, so an import syncs the file once
+// instead of once per record. The writes of fn are rolled back if it fails.
+func (s *BoltStore) Batch(fn func(store Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		return fn(&BoltStore{path: s.path, file: s.file, tx: tx})
+	})
+}
+
+func (s *BoltStore) InsertToken(name string, address string) error {
+	data, err := json.Marshal(TokenRecord{Address: address, Name: name})
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTokens).Put([]byte(strings.ToLower(address)), data)
+	})
+}
+
+// boltPairKey is the key of the pair in the adjacency bucket of the source token.
+func boltPairKey(dst, dex, pairaddr string) []byte {
+	return []byte(strings.ToLower(dst + "|" + dex + "|" + pairaddr))
+}
+
+func (s *BoltStore) InsertPair(dexname string, pairaddr string, fee string, tracked string, token0, token1 string, reserves *contracts.PairReserves) error {
+	feeBps, err := parseFee(fee)
+	if err != nil {
+		return err
+	}
+	pair := boltPair{
+		Dex:        dexname,
+		Pair:       pairaddr,
+		Fee:        feeBps,
+		Tracked:    parseTracked(tracked),
+		TrackedRaw: tracked,
+		Token0:     token0,
+		Token1:     token1,
+	}
+	if reserves != nil {
+		pair.Reserve0, pair.Reserve1, pair.Block = reserves.Reserve0.String(), reserves.Reserve1.String(), int64(reserves.Block)
+	}
+	data, err := json.Marshal(pair)
+	if err != nil {
+		return err
+	}
+	err = s.update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(boltAdjacency).CreateBucketIfNotExists([]byte(strings.ToLower(token0)))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(boltPairKey(token1, dexname, pairaddr), data)
+	})
+	if err != nil {
+		log.WithField("err", err).WithField("pair", pairaddr).Error("insert pair failed")
+	}
+	return err
+}
+
+// RebuildIndexes loads the graph, so the first query does not wait for it.
+func (s *BoltStore) RebuildIndexes() error {
+	_, err := s.Graph()
+	return err
+}
+
+// Graph returns the token graph in memory, it is loaded from the file on the first call.
+func (s *BoltStore) Graph() (*graph.Graph, error) {
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	if s.file.graph != nil && s.tx == nil {
+		return s.file.graph, nil
+	}
+	g := graph.New()
+	err := s.view(func(tx *bolt.Tx) error {
+		err := forEachBoltToken(tx, func(token *TokenRecord) error {
+			g.AddToken(token.Address, token.Name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return forEachBoltPair(tx, func(pair *boltPair) error {
+			record := pair.record()
+			g.AddEdge(record.Edge())
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.tx != nil {
+		// the writes of the batch are not committed yet.
+		return g, nil
+	}
+	log.Infof("load %d tokens and %d pair edges from %s", len(g.Tokens()), g.EdgeCount(), s.path)
+	s.file.graph = g
+	return g, nil
+}
+
+// forEachBoltToken calls fn with each token in the tokens bucket.
+func forEachBoltToken(tx *bolt.Tx, fn func(token *TokenRecord) error) error {
+	return tx.Bucket(boltTokens).ForEach(func(k, v []byte) error {
+		var token TokenRecord
+		if err := json.Unmarshal(v, &token); err != nil {
+			return err
+		}
+		return fn(&token)
+	})
+}
+
+// forEachBoltPair calls fn with each pair edge in the adjacency buckets.
+func forEachBoltPair(tx *bolt.Tx, fn func(pair *boltPair) error) error {
+	adjacency := tx.Bucket(boltAdjacency)
+	return adjacency.ForEach(func(src, _ []byte) error {
+		return adjacency.Bucket(src).ForEach(func(k, v []byte) error {
+			var pair boltPair
+			if err := json.Unmarshal(v, &pair); err != nil {
+				return err
+			}
+			return fn(&pair)
+		})
+	})
+}
+
+// view runs fn in a read transaction of the prepared file, or in the transaction of the batch.
+func (s *BoltStore) view(fn func(tx *bolt.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.file.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltMeta) == nil {
+			return ErrBoltNotPrepared
+		}
+		return fn(tx)
+	})
+}
+
+func (s *BoltStore) Tokens() ([]TokenRecord, error) {
+	tokens := make([]TokenRecord, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		return forEachBoltToken(tx, func(token *TokenRecord) error {
+			tokens = append(tokens, *token)
+			return nil
+		})
+	})
+	return tokens, err
+}
+
+func (s *BoltStore) Pairs() ([]PairRecord, error) {
+	pairs := make([]PairRecord, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		return forEachBoltPair(tx, func(pair *boltPair) error {
+			pairs = append(pairs, pair.record())
+			return nil
+		})
+	})
+	return pairs, err
+}
+
+func (s *BoltStore) TokenPairs(token string) ([]PairRecord, error) {
+	pairs := make([]PairRecord, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltAdjacency).Bucket([]byte(strings.ToLower(token)))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var pair boltPair
+			if err := json.Unmarshal(v, &pair); err != nil {
+				return err
+			}
+			pairs = append(pairs, pair.record())
+			return nil
+		})
+	})
+	return pairs, err
+}
+
+// PairEdges scans all the pairs, the pair addresses have no index in the bolt file.
+func (s *BoltStore) PairEdges(pair string) ([]PairRecord, error) {
+	pairs := make([]PairRecord, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		return forEachBoltPair(tx, func(p *boltPair) error {
+			if strings.EqualFold(p.Pair, pair) {
+				pairs = append(pairs, p.record())
+			}
+			return nil
+		})
+	})
+	return pairs, err
+}
+
+func (s *BoltStore) GetMeta(key string) (string, error) {
+	var value string
+	err := s.view(func(tx *bolt.Tx) error {
+		value = string(tx.Bucket(boltMeta).Get([]byte(key)))
+		return nil
+	})
+	return value, err
+}
+
+func (s *BoltStore) SetMeta(key string, value string) error {
+	return s.write(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMeta).Put([]byte(key), []byte(value))
+	})
+}
+
+func (s *BoltStore) TokenRisks() ([]TokenRisk, error) {
+	risks := make([]TokenRisk, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		// the files prepared before the risks have no bucket.
+		bucket := tx.Bucket(boltRisks)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var risk TokenRisk
+			if err := json.Unmarshal(v, &risk); err != nil {
+				return err
+			}
+			risks = append(risks, risk)
+			return nil
+		})
+	})
+	return risks, err
+}
+
+// SetTokenRisk changes the risks only, so the loaded graph is kept.
+func (s *BoltStore) SetTokenRisk(risk TokenRisk) error {
+	data, err := json.Marshal(risk)
+	if err != nil {
+		return err
+	}
+	return s.write(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltRisks)
+		if err != nil {
+			return err
+		}
+		if len(risk.Flag) == 0 {
+			return bucket.Delete([]byte(strings.ToLower(risk.Address)))
+		}
+		return bucket.Put([]byte(strings.ToLower(risk.Address)), data)
+	})
+}
+
+func (s *BoltStore) TokenInfos() ([]TokenInfo, error) {
+	infos := make([]TokenInfo, 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		// the files prepared before the token infos have no bucket.
+		bucket := tx.Bucket(boltInfos)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var info TokenInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return err
+			}
+			infos = append(infos, info)
+			return nil
+		})
+	})
+	return infos, err
+}
+
+// SetTokenInfo changes the token infos only, so the loaded graph is kept.
+func (s *BoltStore) SetTokenInfo(info TokenInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.write(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltInfos)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(strings.ToLower(info.Address)), data)
+	})
+}
+
+func (s *BoltStore) QueryRoutes(token0, token1 string, maxSteps int, minTracked float64) ([]*types.TokenRoute, error) {
+	g, err := s.Graph()
+	if err != nil {
+		return nil, err
+	}
+	return g.FindRoutes(token0, token1, maxSteps, minTracked), nil
+}
+
+// Close closes the file after all the stores on it are closed, the store of a batch
+// is closed with its transaction.
+func (s *BoltStore) Close() {
+	if s.tx != nil {
+		return
+	}
+	boltFilesMu.Lock()
+	defer boltFilesMu.Unlock()
+	s.file.refs--
+	if s.file.refs > 0 {
+		return
+	}
+	delete(boltFiles, s.path)
+	if err := s.file.db.Close(); err != nil {
+		log.WithField("err", err).Error("close bolt file failed")
+	}
+}
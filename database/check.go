@@ -0,0 +1,197 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/zhihu/norm"
+)
+
+const (
+	// IssueWrongRank is an edge whose rank is not PairRank of its dex and pair address.
+	IssueWrongRank = "wrong-rank"
+	// IssueDuplicate is an extra edge of a pair between the same tokens, left by the former rank.
+	IssueDuplicate = "duplicate"
+	// IssueMissingReverse is a pair edge without the reverse edge, the reverse edge of a pool
+	// was overwritten by another pool with the same former rank.
+	IssueMissingReverse = "missing-reverse"
+	// IssueCollision is two pairs between the same tokens with the same PairRank, it is not repairable.
+	IssueCollision = "collision"
+)
+
+// EdgeIssue is a problem found on a pair edge.
+type EdgeIssue struct {
+	Kind string
+	Pair *models.Pair
+}
+
+// EdgeReport is the result of CheckEdges.
+type EdgeReport struct {
+	Edges  int
+	Issues []EdgeIssue
+}
+
+// Count returns the count of issues of kind.
+func (r *EdgeReport) Count(kind string) int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// pairKey is the identity of a pair edge in one direction.
+func pairKey(src, dst interface{}, dex, pairaddr string) string {
+	return strings.ToLower(strings.Join([]string{fmt.Sprint(src), fmt.Sprint(dst), dex, pairaddr}, "|"))
+}
+
+// ScanPairs returns all the pair edges in the space.
+func ScanPairs(db *norm.DB) ([]*models.Pair, error) {
+	res, err := db.Execute("LOOKUP ON pair YIELD edge AS e")
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]*models.Pair, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		if len(values) < 1 || !values[0].IsSetEVal() {
+			continue
+		}
+		pair, err := DecodeEdge(values[0].GetEVal())
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// ScanTokens returns all the token vertices in the space.
+func ScanTokens(db *norm.DB) ([]*models.Token, error) {
+	res, err := db.Execute("LOOKUP ON token YIELD vertex AS v")
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*models.Token, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		if len(values) < 1 || !values[0].IsSetVVal() {
+			continue
+		}
+		token, err := DecodeToken(values[0].GetVVal())
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// CheckEdges finds the pair edges with a wrong rank, the duplicated edges, the edges
+// without a reverse edge and the rank collisions.
+func CheckEdges(db *norm.DB) (*EdgeReport, error) {
+	pairs, err := ScanPairs(db)
+	if err != nil {
+		return nil, err
+	}
+	report := &EdgeReport{Edges: len(pairs)}
+	groups := make(map[string][]*models.Pair)
+	keys := make([]string, 0)
+	for _, pair := range pairs {
+		key := pairKey(pair.Src, pair.Dst, pair.DexName, pair.PairAddress)
+		if _, exist := groups[key]; !exist {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], pair)
+	}
+
+	kept := make([]*models.Pair, 0, len(keys))
+	ranks := make(map[string]*models.Pair)
+	for _, key := range keys {
+		keep, duplicates := pickEdge(groups[key])
+		for _, pair := range duplicates {
+			report.Issues = append(report.Issues, EdgeIssue{Kind: IssueDuplicate, Pair: pair})
+		}
+		rank := PairRank(keep.DexName, keep.PairAddress)
+		rankKey := strings.ToLower(fmt.Sprintf("%v|%v|%d", keep.Src, keep.Dst, rank))
+		if _, exist := ranks[rankKey]; exist {
+			// moving it to the right rank would overwrite the other pair.
+			report.Issues = append(report.Issues, EdgeIssue{Kind: IssueCollision, Pair: keep})
+		} else if keep.Rank != rank {
+			report.Issues = append(report.Issues, EdgeIssue{Kind: IssueWrongRank, Pair: keep})
+		}
+		ranks[rankKey] = keep
+		kept = append(kept, keep)
+	}
+	for _, pair := range kept {
+		if _, exist := groups[pairKey(pair.Dst, pair.Src, pair.DexName, pair.PairAddress)]; !exist {
+			report.Issues = append(report.Issues, EdgeIssue{Kind: IssueMissingReverse, Pair: pair})
+		}
+	}
+	return report, nil
+}
+
+// pickEdge returns the edge to keep in the edges of one pair, it is the one with the
+// right rank, or the one with the latest reserves.
+func pickEdge(edges []*models.Pair) (*models.Pair, []*models.Pair) {
+	keep := 0
+	for i, pair := range edges {
+		if pair.Rank == PairRank(pair.DexName, pair.PairAddress) {
+			keep = i
+			break
+		}
+		if pair.Block > edges[keep].Block {
+			keep = i
+		}
+	}
+	duplicates := make([]*models.Pair, 0, len(edges)-1)
+	for i, pair := range edges {
+		if i != keep {
+			duplicates = append(duplicates, pair)
+		}
+	}
+	return edges[keep], duplicates
+}
+
+// reversePair returns the reverse edge of pair, the token and reserve props follow the direction.
+func reversePair(pair *models.Pair) *models.Pair {
+	reversed := *pair
+	reversed.Src, reversed.Dst = pair.Dst, pair.Src
+	reversed.Token0, reversed.Token1 = pair.Token1, pair.Token0
+	reversed.Reserve0, reversed.Reserve1 = pair.Reserve1, pair.Reserve0
+	reversed.Rank = PairRank(pair.DexName, pair.PairAddress)
+	return &reversed
+}
+
+func deletePairEdge(db *norm.DB, pair *models.Pair) error {
+	_, err := db.Execute(fmt.Sprintf("DELETE EDGE %s \"%v\"->\"%v\"@%d", pair.EdgeName(), pair.Src, pair.Dst, pair.Rank))
+	return err
+}
+
+// RepairEdges fixes the issues in report, the duplicated edges are deleted, the edges with a
+// wrong rank are moved to the right rank and the missing reverse edges are inserted.
+// The collisions are left as they are.
+func RepairEdges(db *norm.DB, report *EdgeReport) error {
+	for _, issue := range report.Issues {
+		var err error
+		switch issue.Kind {
+		case IssueDuplicate:
+			err = deletePairEdge(db, issue.Pair)
+		case IssueWrongRank:
+			fixed := *issue.Pair
+			fixed.Rank = PairRank(fixed.DexName, fixed.PairAddress)
+			if err = db.InsertEdge(&fixed); err == nil {
+				err = deletePairEdge(db, issue.Pair)
+			}
+		case IssueMissingReverse:
+			err = db.InsertEdge(reversePair(issue.Pair))
+		}
+		if err != nil {
+			return fmt.Errorf("repair %s edge %v->%v@%d failed: %w", issue.Kind, issue.Pair.Src, issue.Pair.Dst, issue.Pair.Rank, err)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"encoding/binary"
 	"fmt"
 	"github.com/vesoft-inc/nebula-go/v3/nebula"
 	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/contracts"
 	"github.com/xueqianLu/routegen/database/models"
 	"github.com/xueqianLu/routegen/log"
 	"github.com/xueqianLu/routegen/types"
@@ -11,7 +13,7 @@ import (
 	"github.com/zhihu/norm/constants"
 	"github.com/zhihu/norm/dialectors"
 	"golang.org/x/crypto/sha3"
-	"math/big"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -40,33 +42,44 @@ func InsertToken(db *norm.DB, name string, address string) error {
 	return err
 }
 
-func pairRank(dexname string, pairaddr string, fee string, tracked string, token0, token1 string) int {
-	content := strings.Join([]string{dexname, pairaddr, fee, tracked, token0, token1}, "")
-	hash := sha3.Sum256([]byte(content))
-	rank := new(big.Int)
-	rank.SetBytes(hash[:])
-	rankTrim := rank.Uint64() % 1000000
-	return int(rankTrim)
+// PairRank is the edge rank of the pair, it only depends on the dex and the pair address,
+// so the parallel pools between two tokens get different ranks and an update of a pair
+// overwrites its own edge. It is 63 bits of the sha3 hash, a valid non negative int64.
+func PairRank(dexname string, pairaddr string) int {
+	hash := sha3.Sum256([]byte(strings.ToLower(dexname) + "-" + strings.ToLower(pairaddr)))
+	return int(binary.BigEndian.Uint64(hash[:8]) >> 1)
 }
 
-func InsertPair(db *norm.DB, dexname string, pairaddr string, fee string, tracked string, token0, token1 string) error {
-	rank := pairRank(dexname, pairaddr, fee, tracked, token0, token1)
+// InsertPair inserts the pair edge from token0 to token1, reserves is nil if the reserves of pair are unknown.
+// The fee is in basis points and tracked is a decimal string, kept in tracked_raw for precision.
+func InsertPair(db *norm.DB, dexname string, pairaddr string, fee string, tracked string, token0, token1 string, reserves *contracts.PairReserves) error {
+	feeBps, err := parseFee(fee)
+	if err != nil {
+		log.WithField("err", err).WithField("pair", pairaddr).Error("invalid pair fee")
+		return err
+	}
 	pair := &models.Pair{
 		EModel: norm.EModel{
 			Src:       token0,
 			SrcPolicy: constants.PolicyNothing,
 			Dst:       token1,
 			DstPolicy: constants.PolicyNothing,
-			Rank:      rank,
+			Rank:      PairRank(dexname, pairaddr),
 		},
 		DexName:       dexname,
 		Token1:        token1,
 		Token0:        token0,
 		PairAddress:   pairaddr,
-		TrackedVolume: tracked,
-		Fee:           fee,
+		TrackedVolume: parseTracked(tracked),
+		TrackedRaw:    tracked,
+		Fee:           feeBps,
 	}
-	err := db.InsertEdge(pair)
+	if reserves != nil {
+		pair.Reserve0 = reserves.Reserve0.String()
+		pair.Reserve1 = reserves.Reserve1.String()
+		pair.Block = int64(reserves.Block)
+	}
+	err = db.InsertEdge(pair)
 	if err != nil {
 		log.WithField("err", err).WithField("pair", pairaddr).Error("insert pair failed")
 	} else {
@@ -76,56 +89,43 @@ func InsertPair(db *norm.DB, dexname string, pairaddr string, fee string, tracke
 }
 
 func getValueofValue(value *nebula.Value) string {
-	if value.NVal != nil {
-		return fmt.Sprintf("value.NVal=%v", value.NVal)
-	}
-	if value.BVal != nil {
-		return fmt.Sprintf("value.BVal=%v", value.BVal)
-	}
-	if value.IVal != nil {
-		return fmt.Sprintf("value.IVal=%v", value.IVal)
-	}
-	if value.FVal != nil {
-		return fmt.Sprintf("value.FVal=%v", value.FVal)
-	}
-	if value.SVal != nil {
-		return fmt.Sprintf("%v", string(value.SVal))
-	}
-	if value.DVal != nil {
-		return fmt.Sprintf("value.DVal=%v", value.DVal)
-	}
-	if value.TVal != nil {
-		return fmt.Sprintf("value.TVal=%v", value.TVal)
-	}
-	if value.DtVal != nil {
-		return fmt.Sprintf("value.DtVal=%v", value.DtVal)
-	}
-	if value.VVal != nil {
-		return fmt.Sprintf("value.VVal=%v", value.VVal)
-	}
-	if value.EVal != nil {
-		return fmt.Sprintf("value.EVal=%v", value.EVal)
-	}
-	if value.PVal != nil {
-		return fmt.Sprintf("value.PVal=%v", value.PVal)
-	}
-	if value.LVal != nil {
-		return fmt.Sprintf("value.LVal=%v", value.LVal)
-	}
-	if value.MVal != nil {
-		return fmt.Sprintf("value.MVal=%v", value.MVal)
-	}
-	if value.UVal != nil {
-		return fmt.Sprintf("value.UVal=%v", value.UVal)
-	}
-	if value.GVal != nil {
-		return fmt.Sprintf("value.GVal=%v", value.GVal)
-	}
-	if value.GgVal != nil {
-		return fmt.Sprintf("value.GgVal=%v", value.GgVal)
-	}
-	if value.DuVal != nil {
-		return fmt.Sprintf("value.DuVal=%v", value.DuVal)
+	switch {
+	case value == nil:
+		return "nil"
+	case value.NVal != nil:
+		return fmt.Sprintf("value.NVal=%s", value.NVal.String())
+	case value.BVal != nil:
+		return fmt.Sprintf("value.BVal=%t", *value.BVal)
+	case value.IVal != nil:
+		return fmt.Sprintf("value.IVal=%d", *value.IVal)
+	case value.FVal != nil:
+		return fmt.Sprintf("value.FVal=%v", *value.FVal)
+	case value.SVal != nil:
+		return string(value.SVal)
+	case value.DVal != nil:
+		return fmt.Sprintf("value.DVal=%s", value.DVal.String())
+	case value.TVal != nil:
+		return fmt.Sprintf("value.TVal=%s", value.TVal.String())
+	case value.DtVal != nil:
+		return fmt.Sprintf("value.DtVal=%s", value.DtVal.String())
+	case value.VVal != nil:
+		return fmt.Sprintf("value.VVal=%s", value.VVal.String())
+	case value.EVal != nil:
+		return fmt.Sprintf("value.EVal=%s", value.EVal.String())
+	case value.PVal != nil:
+		return fmt.Sprintf("value.PVal=%s", value.PVal.String())
+	case value.LVal != nil:
+		return fmt.Sprintf("value.LVal=%s", value.LVal.String())
+	case value.MVal != nil:
+		return fmt.Sprintf("value.MVal=%s", value.MVal.String())
+	case value.UVal != nil:
+		return fmt.Sprintf("value.UVal=%s", value.UVal.String())
+	case value.GVal != nil:
+		return fmt.Sprintf("value.GVal=%s", value.GVal.String())
+	case value.GgVal != nil:
+		return fmt.Sprintf("value.GgVal=%s", value.GgVal.String())
+	case value.DuVal != nil:
+		return fmt.Sprintf("value.DuVal=%s", value.DuVal.String())
 	}
 	return ""
 }
@@ -175,103 +175,109 @@ func printStep(index int, s *nebula.Step) {
 
 }
 
+// GetDstFromStep returns the vid of the destination of the step, empty if it is not a vid.
 func GetDstFromStep(step *nebula.Step) string {
-	return getValueofValue(step.Dst.GetVid())
-}
-
-func GetPairInfoFromStep(step *nebula.Step, routeStep *types.RouteStep) {
-	Pairs := make([]types.RoutePairInfo, 1)
-
-	if dex, exist := step.Props[PairProp_dex]; exist {
-		Pairs[0].Dex = getValueofValue(dex)
-	}
-	if pairAddr, exist := step.Props[PairProp_paircontract]; exist {
-		Pairs[0].Pair = getValueofValue(pairAddr)
-	}
-	if fee, exist := step.Props[PairProp_fee]; exist {
-		Pairs[0].Fee = getValueofValue(fee)
+	vid, err := decodeVid(step.GetDst().GetVid())
+	if err != nil {
+		return ""
 	}
-	routeStep.Pairs = Pairs
+	return vid
 }
 
-func ParsePathInfo(path *nebula.Path) []types.RouteStep {
-	src := path.GetSrc()
-	steps := path.GetSteps()
-	routePath := make([]types.RouteStep, len(steps))
-	srcToken := getValueofValue(src.Vid)
-	for i, step := range steps {
-		routeStep := types.RouteStep{
-			Src: srcToken,
+// ParsePathInfo decodes the path into route steps, one pair per step.
+func ParsePathInfo(path *nebula.Path) ([]types.RouteStep, error) {
+	decoded, err := DecodePath(path)
+	if err != nil {
+		return nil, err
+	}
+	routePath := make([]types.RouteStep, len(decoded.Pairs))
+	for i, pair := range decoded.Pairs {
+		routePath[i] = types.RouteStep{
+			Src:   decoded.Tokens[i].Address,
+			Dst:   decoded.Tokens[i+1].Address,
+			Pairs: []types.RoutePairInfo{PairInfo(pair)},
 		}
-		routeStep.Dst = GetDstFromStep(step)
-		GetPairInfoFromStep(step, &routeStep)
-		srcToken = routeStep.Dst
-		routePath[i] = routeStep
 	}
-	return routePath
+	return routePath, nil
 }
 
 func QueryRoute(db *norm.DB, token0, token1 string) []*types.TokenRoute {
-	nql := fmt.Sprintf("FIND NOLOOP PATH WITH PROP FROM \"%s\" TO \"%s\" OVER * YIELD path AS p", token0, token1)
-	result := make([]map[string]interface{}, 0)
-	res, err := db.Debug().Execute(nql)
+	return QueryRouteWithMaxJump(db, token0, token1, 0)
+}
+
+func QueryRouteWithMaxJump(db *norm.DB, token0, token1 string, op int) []*types.TokenRoute {
+	paths, err := QueryRouteWhere(db, token0, token1, op, "")
 	if err != nil {
 		log.WithField("err", err).Error("query route failed")
 		return []*types.TokenRoute{}
-	} else {
-		//log.WithField("rows", len(res.GetRows())).Info("query route")
-		err := UnmarshalResultSet(res, &result)
-		if err != nil {
-			log.WithField("err", err).Error("parse route failed")
-			return []*types.TokenRoute{}
-		}
-		paths := make([]*types.TokenRoute, 0, len(result))
+	}
+	return paths
+}
 
-		for _, vpath := range result {
-			// vpath only have one key (AS p)
-			for _, v := range vpath {
-				if path, ok := v.(*nebula.Path); ok {
-					steps := ParsePathInfo(path)
-					tokenRoute := new(types.TokenRoute)
-					tokenRoute.Steps = steps
-					paths = append(paths, tokenRoute)
-				}
-			}
-		}
-		return paths
+// MinTrackedFilter is the filter of QueryRouteWhere for the pairs with tracked liquidity above min.
+func MinTrackedFilter(min float64) string {
+	if min <= 0 {
+		return ""
 	}
+	return fmt.Sprintf("pair.%s > %s", PairProp_tracked, nqlDouble(min))
 }
 
-func QueryRouteWithMaxJump(db *norm.DB, token0, token1 string, op int) []*types.TokenRoute {
-	nql := fmt.Sprintf("FIND NOLOOP PATH WITH PROP FROM \"%s\" TO \"%s\" OVER * UPTO %d STEPS YIELD path AS p", token0, token1, op)
+// nqlDouble formats v as a double literal of nGQL. An integer literal out of the int64
+// range fails to parse, so the literal always has a decimal point.
+func nqlDouble(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if strings.ContainsRune(s, '.') {
+		return s
+	}
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
+
+// nqlString quotes s as a string literal of nGQL.
+func nqlString(s string) string {
+	return "\"" + nqlEscaper.Replace(s) + "\""
+}
+
+var nqlEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r")
+
+// QueryRouteWhere finds the routes from token0 to token1 in at most op steps, 0 for the default
+// limit of nebula, over the pairs matching the where condition of FIND PATH, like "pair.tracked > 1000".
+func QueryRouteWhere(db *norm.DB, token0, token1 string, op int, where string) ([]*types.TokenRoute, error) {
+	nql := fmt.Sprintf("FIND NOLOOP PATH WITH PROP FROM \"%s\" TO \"%s\" OVER *", token0, token1)
+	if len(where) > 0 {
+		nql += " WHERE " + where
+	}
+	if op > 0 {
+		nql += fmt.Sprintf(" UPTO %d STEPS", op)
+	}
+	nql += " YIELD path AS p"
 	result := make([]map[string]interface{}, 0)
 	res, err := db.Execute(nql)
-	//res, err := db.Debug().Execute(nql)
 	if err != nil {
-		log.WithField("err", err).Error("query route failed")
-		return []*types.TokenRoute{}
-	} else {
-		//log.WithField("rows", len(res.GetRows())).Info("query route")
-		err := UnmarshalResultSet(res, &result)
-		if err != nil {
-			log.WithField("err", err).Error("parse route failed")
-			return []*types.TokenRoute{}
-		}
-		paths := make([]*types.TokenRoute, 0, len(result))
-
-		for _, vpath := range result {
-			// vpath only have one key (AS p)
-			for _, v := range vpath {
-				if path, ok := v.(*nebula.Path); ok {
-					steps := ParsePathInfo(path)
-					tokenRoute := new(types.TokenRoute)
-					tokenRoute.Steps = steps
-					paths = append(paths, tokenRoute)
+		return nil, err
+	}
+	if err = UnmarshalResultSet(res, &result); err != nil {
+		return nil, fmt.Errorf("parse route failed: %w", err)
+	}
+	paths := make([]*types.TokenRoute, 0, len(result))
+	for _, vpath := range result {
+		// vpath only have one key (AS p)
+		for _, v := range vpath {
+			if path, ok := v.(*nebula.Path); ok {
+				steps, err := ParsePathInfo(path)
+				if err != nil {
+					log.WithField("err", err).Error("decode route path failed")
+					continue
 				}
+				tokenRoute := new(types.TokenRoute)
+				tokenRoute.Steps = steps
+				paths = append(paths, tokenRoute)
 			}
 		}
-		return paths
 	}
+	return paths, nil
 }
 
 func mergeRoute(mergedRoute *types.TokenRoute, otherRoute []*types.TokenRoute) {
@@ -0,0 +1,311 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/vesoft-inc/nebula-go/v3/nebula"
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/xueqianLu/routegen/types"
+	"github.com/zhihu/norm/constants"
+)
+
+var (
+	ErrNilValue        = errors.New("nil nebula value")
+	ErrUnsupportedType = errors.New("unsupported field type")
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	pathType  = reflect.TypeOf(models.Path{})
+	tokenType = reflect.TypeOf(models.Token{})
+	pairType  = reflect.TypeOf(models.Pair{})
+)
+
+// typeMismatch is the error for a nebula value that can not be decoded into kind.
+func typeMismatch(value *nebula.Value, typ reflect.Type) error {
+	return fmt.Errorf("can not decode nebula value (%s) into %s", getValueofValue(value), typ)
+}
+
+// decodeVid returns the vid as string, both string and int vid are supported.
+func decodeVid(value *nebula.Value) (string, error) {
+	switch {
+	case value == nil:
+		return "", ErrNilValue
+	case value.IsSetSVal():
+		return string(value.GetSVal()), nil
+	case value.IsSetIVal():
+		return strconv.FormatInt(value.GetIVal(), 10), nil
+	default:
+		return "", typeMismatch(value, reflect.TypeOf(""))
+	}
+}
+
+func decodeDateTime(dt *nebula.DateTime) time.Time {
+	return time.Date(int(dt.Year), time.Month(dt.Month), int(dt.Day), int(dt.Hour), int(dt.Minute),
+		int(dt.Sec), int(dt.Microsec)*int(time.Microsecond), time.UTC)
+}
+
+// decodeValue sets the nebula value to field, a null value resets field to its zero value.
+func decodeValue(value *nebula.Value, field reflect.Value) error {
+	if value == nil {
+		return ErrNilValue
+	}
+	if value.IsSetNVal() {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Bool:
+		if !value.IsSetBVal() {
+			return typeMismatch(value, field.Type())
+		}
+		field.SetBool(value.GetBVal())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var v int64
+		switch {
+		case value.IsSetIVal():
+			v = value.GetIVal()
+		case value.IsSetSVal():
+			// numbers stored as string by the former schema.
+			var err error
+			if v, err = strconv.ParseInt(string(value.GetSVal()), 10, 64); err != nil {
+				return typeMismatch(value, field.Type())
+			}
+		default:
+			return typeMismatch(value, field.Type())
+		}
+		// SetInt truncates, the overflow is checked on the decoded value.
+		if field.OverflowInt(v) {
+			return typeMismatch(value, field.Type())
+		}
+		field.SetInt(v)
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case value.IsSetFVal():
+			field.SetFloat(value.GetFVal())
+		case value.IsSetIVal():
+			field.SetFloat(float64(value.GetIVal()))
+		case value.IsSetSVal():
+			v, err := strconv.ParseFloat(string(value.GetSVal()), 64)
+			if err != nil {
+				return typeMismatch(value, field.Type())
+			}
+			field.SetFloat(v)
+		default:
+			return typeMismatch(value, field.Type())
+		}
+	case reflect.String:
+		switch {
+		case value.IsSetSVal():
+			field.SetString(string(value.GetSVal()))
+		case value.IsSetIVal():
+			field.SetString(strconv.FormatInt(value.GetIVal(), 10))
+		case value.IsSetFVal():
+			field.SetString(strconv.FormatFloat(value.GetFVal(), 'f', -1, 64))
+		case value.IsSetBVal():
+			field.SetString(strconv.FormatBool(value.GetBVal()))
+		default:
+			return typeMismatch(value, field.Type())
+		}
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := decodeValue(value, elem.Elem()); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Struct:
+		return decodeStruct(value, field)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, field.Type())
+	}
+	return nil
+}
+
+func decodeStruct(value *nebula.Value, field reflect.Value) error {
+	switch field.Type() {
+	case timeType:
+		switch {
+		case value.IsSetIVal():
+			field.Set(reflect.ValueOf(time.Unix(value.GetIVal(), 0)))
+		case value.IsSetDtVal():
+			field.Set(reflect.ValueOf(decodeDateTime(value.GetDtVal())))
+		case value.IsSetDVal():
+			d := value.GetDVal()
+			field.Set(reflect.ValueOf(time.Date(int(d.Year), time.Month(d.Month), int(d.Day), 0, 0, 0, 0, time.UTC)))
+		default:
+			return typeMismatch(value, field.Type())
+		}
+	case pathType:
+		if !value.IsSetPVal() {
+			return typeMismatch(value, field.Type())
+		}
+		path, err := DecodePath(value.GetPVal())
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(*path))
+	case tokenType:
+		if !value.IsSetVVal() {
+			return typeMismatch(value, field.Type())
+		}
+		token, err := DecodeToken(value.GetVVal())
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(*token))
+	case pairType:
+		if !value.IsSetEVal() {
+			return typeMismatch(value, field.Type())
+		}
+		pair, err := DecodeEdge(value.GetEVal())
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(*pair))
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, field.Type())
+	}
+	return nil
+}
+
+// decodeProps sets the props to the fields tagged with norm of the struct val points to,
+// the props without a field are ignored.
+func decodeProps(props map[string]*nebula.Value, val reflect.Value) error {
+	val = reflect.Indirect(val)
+	fieldTagMap := getStructFieldTagMap(val.Type())
+	for name, prop := range props {
+		pos, ok := fieldTagMap[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(prop, val.Field(pos)); err != nil {
+			return fmt.Errorf("decode prop %s failed: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// DecodeToken decodes the token tag of the vertex into models.Token.
+func DecodeToken(v *nebula.Vertex) (*models.Token, error) {
+	if v == nil {
+		return nil, ErrNilValue
+	}
+	vid, err := decodeVid(v.GetVid())
+	if err != nil {
+		return nil, err
+	}
+	token := &models.Token{}
+	token.Vid = vid
+	for _, tag := range v.GetTags() {
+		if string(tag.GetName()) != token.TagName() {
+			continue
+		}
+		if err = decodeProps(tag.GetProps(), reflect.ValueOf(token)); err != nil {
+			return nil, fmt.Errorf("decode token %s failed: %w", vid, err)
+		}
+	}
+	if len(token.Address) == 0 {
+		token.Address = vid
+	}
+	return token, nil
+}
+
+func newPair(src, dst string, edgeType nebula.EdgeType, rank nebula.EdgeRanking, props map[string]*nebula.Value) (*models.Pair, error) {
+	// a negative edge type is an edge walked reversely.
+	if edgeType < 0 {
+		src, dst = dst, src
+	}
+	pair := &models.Pair{}
+	pair.Src, pair.SrcPolicy = src, constants.PolicyNothing
+	pair.Dst, pair.DstPolicy = dst, constants.PolicyNothing
+	pair.Rank = int(rank)
+	if err := decodeProps(props, reflect.ValueOf(pair)); err != nil {
+		return nil, fmt.Errorf("decode pair %s -> %s@%d failed: %w", src, dst, rank, err)
+	}
+	return pair, nil
+}
+
+// DecodeEdge decodes the pair edge into models.Pair.
+func DecodeEdge(e *nebula.Edge) (*models.Pair, error) {
+	if e == nil {
+		return nil, ErrNilValue
+	}
+	src, err := decodeVid(e.GetSrc())
+	if err != nil {
+		return nil, err
+	}
+	dst, err := decodeVid(e.GetDst())
+	if err != nil {
+		return nil, err
+	}
+	return newPair(src, dst, e.GetType(), e.GetRanking(), e.GetProps())
+}
+
+// DecodeStep decodes the path step starting from src into models.Pair.
+func DecodeStep(src *nebula.Vertex, step *nebula.Step) (*models.Pair, error) {
+	if src == nil || step == nil || step.GetDst() == nil {
+		return nil, ErrNilValue
+	}
+	srcVid, err := decodeVid(src.GetVid())
+	if err != nil {
+		return nil, err
+	}
+	dstVid, err := decodeVid(step.GetDst().GetVid())
+	if err != nil {
+		return nil, err
+	}
+	return newPair(srcVid, dstVid, step.GetType(), step.GetRanking(), step.GetProps())
+}
+
+// DecodePath decodes the vertices of path into tokens and the steps into pairs.
+func DecodePath(path *nebula.Path) (*models.Path, error) {
+	if path == nil || path.GetSrc() == nil {
+		return nil, ErrNilValue
+	}
+	src := path.GetSrc()
+	token, err := DecodeToken(src)
+	if err != nil {
+		return nil, err
+	}
+	decoded := &models.Path{
+		Tokens: make([]*models.Token, 0, len(path.GetSteps())+1),
+		Pairs:  make([]*models.Pair, 0, len(path.GetSteps())),
+	}
+	decoded.Tokens = append(decoded.Tokens, token)
+	for i, step := range path.GetSteps() {
+		pair, err := DecodeStep(src, step)
+		if err != nil {
+			return nil, fmt.Errorf("decode step %d failed: %w", i, err)
+		}
+		if token, err = DecodeToken(step.GetDst()); err != nil {
+			return nil, fmt.Errorf("decode step %d failed: %w", i, err)
+		}
+		decoded.Pairs = append(decoded.Pairs, pair)
+		decoded.Tokens = append(decoded.Tokens, token)
+		src = step.GetDst()
+	}
+	return decoded, nil
+}
+
+// PairInfo converts the pair into the pair info of a route step, the tracked value is the
+// original decimal string if it is kept.
+func PairInfo(pair *models.Pair) types.RoutePairInfo {
+	tracked := pair.TrackedRaw
+	if len(tracked) == 0 {
+		tracked = strconv.FormatFloat(pair.TrackedVolume, 'f', -1, 64)
+	}
+	return types.RoutePairInfo{
+		Pair:     pair.PairAddress,
+		Fee:      strconv.FormatInt(pair.Fee, 10),
+		Dex:      pair.DexName,
+		Tracked:  tracked,
+		Token0:   pair.Token0,
+		Reserve0: pair.Reserve0,
+		Reserve1: pair.Reserve1,
+		Block:    pair.Block,
+	}
+}
@@ -0,0 +1,333 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vesoft-inc/nebula-go/v3/nebula"
+	"github.com/xueqianLu/routegen/database/models"
+)
+
+func intValue(v int64) *nebula.Value {
+	return &nebula.Value{IVal: &v}
+}
+
+func floatValue(v float64) *nebula.Value {
+	return &nebula.Value{FVal: &v}
+}
+
+func boolValue(v bool) *nebula.Value {
+	return &nebula.Value{BVal: &v}
+}
+
+func stringValue(v string) *nebula.Value {
+	return &nebula.Value{SVal: []byte(v)}
+}
+
+func nullValue() *nebula.Value {
+	null := nebula.NullType___NULL__
+	return &nebula.Value{NVal: &null}
+}
+
+func tokenVertex(address, name string) *nebula.Vertex {
+	return &nebula.Vertex{
+		Vid: stringValue(address),
+		Tags: []*nebula.Tag{{
+			Name:  []byte("token"),
+			Props: map[string]*nebula.Value{"name": stringValue(name), "address": stringValue(address)},
+		}},
+	}
+}
+
+func edgeProps(dex, pair string, tracked float64, fee int64) map[string]*nebula.Value {
+	return map[string]*nebula.Value{
+		"dex":         stringValue(dex),
+		"pairaddress": stringValue(pair),
+		"tracked":     floatValue(tracked),
+		"tracked_raw": stringValue("1000.5"),
+		"fee":         intValue(fee),
+		"token0":      stringValue("0xa"),
+		"unknown":     stringValue("ignored"),
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	var (
+		i64   int64
+		i8    int8
+		f64   float64
+		b     bool
+		s     string
+		ts    time.Time
+		ptr   *int64
+		sptr  *string
+		slice []string
+	)
+	tests := []struct {
+		name  string
+		value *nebula.Value
+		field interface{}
+		// preset is the value of field before the decode.
+		preset interface{}
+		want   interface{}
+		err    bool
+	}{
+		{name: "int", value: intValue(42), field: &i64, want: int64(42)},
+		{name: "int from string", value: stringValue("7"), field: &i64, want: int64(7)},
+		{name: "int overflow", value: intValue(300), field: &i8, err: true},
+		{name: "int from bad string", value: stringValue("x"), field: &i64, err: true},
+		{name: "int from bool", value: boolValue(true), field: &i64, err: true},
+		{name: "float", value: floatValue(1.5), field: &f64, want: 1.5},
+		{name: "float from int", value: intValue(3), field: &f64, want: float64(3)},
+		{name: "float from string", value: stringValue("2.25"), field: &f64, want: 2.25},
+		{name: "float from bool", value: boolValue(true), field: &f64, err: true},
+		{name: "bool", value: boolValue(true), field: &b, want: true},
+		{name: "bool from int", value: intValue(1), field: &b, err: true},
+		{name: "string", value: stringValue("abc"), field: &s, want: "abc"},
+		{name: "string from int", value: intValue(12), field: &s, want: "12"},
+		{name: "string from float", value: floatValue(0.5), field: &s, want: "0.5"},
+		{name: "string from bool", value: boolValue(false), field: &s, want: "false"},
+		{name: "time from int", value: intValue(1700000000), field: &ts, want: time.Unix(1700000000, 0)},
+		{
+			name:  "time from datetime",
+			value: &nebula.Value{DtVal: &nebula.DateTime{Year: 2023, Month: 5, Day: 6, Hour: 7, Minute: 8, Sec: 9, Microsec: 10}},
+			field: &ts,
+			want:  time.Date(2023, 5, 6, 7, 8, 9, 10000, time.UTC),
+		},
+		{
+			name:  "time from date",
+			value: &nebula.Value{DVal: &nebula.Date{Year: 2023, Month: 5, Day: 6}},
+			field: &ts,
+			want:  time.Date(2023, 5, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{name: "time from string", value: stringValue("now"), field: &ts, err: true},
+		{name: "null int", value: nullValue(), field: &i64, preset: int64(9), want: int64(0)},
+		{name: "null string", value: nullValue(), field: &s, preset: "stale", want: ""},
+		{name: "null pointer", value: nullValue(), field: &ptr, preset: new(int64), want: (*int64)(nil)},
+		{name: "pointer", value: intValue(5), field: &ptr, want: int64(5)},
+		{name: "string pointer", value: stringValue("x"), field: &sptr, want: "x"},
+		{name: "pointer mismatch", value: boolValue(true), field: &ptr, err: true},
+		{name: "unsupported", value: stringValue("x"), field: &slice, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := reflect.ValueOf(tt.field).Elem()
+			if tt.preset != nil {
+				field.Set(reflect.ValueOf(tt.preset))
+			}
+			err := decodeValue(tt.value, field)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("decode %s into %s, expect an error", getValueofValue(tt.value), field.Type())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			got := field.Interface()
+			if field.Kind() == reflect.Ptr && !field.IsNil() {
+				got = field.Elem().Interface()
+			}
+			if tm, ok := got.(time.Time); ok {
+				if !tm.Equal(tt.want.(time.Time)) {
+					t.Fatalf("got %v, want %v", tm, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeValueNil(t *testing.T) {
+	var s string
+	if err := decodeValue(nil, reflect.ValueOf(&s).Elem()); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+}
+
+func TestTypeMismatchMessage(t *testing.T) {
+	var b bool
+	err := decodeValue(intValue(12), reflect.ValueOf(&b).Elem())
+	if err == nil {
+		t.Fatal("expect a type mismatch")
+	}
+	if !strings.Contains(err.Error(), "value.IVal=12") {
+		t.Fatalf("the error has no decoded value: %v", err)
+	}
+	if strings.Contains(err.Error(), "0x") {
+		t.Fatalf("the error has a pointer address: %v", err)
+	}
+}
+
+func TestDecodeVid(t *testing.T) {
+	if vid, err := decodeVid(stringValue("0xabc")); err != nil || vid != "0xabc" {
+		t.Fatalf("got %q, %v", vid, err)
+	}
+	if vid, err := decodeVid(intValue(-3)); err != nil || vid != "-3" {
+		t.Fatalf("got %q, %v", vid, err)
+	}
+	if _, err := decodeVid(floatValue(1)); err == nil {
+		t.Fatal("a float vid should fail")
+	}
+	if _, err := decodeVid(nil); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+}
+
+func TestDecodeToken(t *testing.T) {
+	token, err := DecodeToken(tokenVertex("0xa", "TokenA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Vid != "0xa" || token.Address != "0xa" || token.Name != "TokenA" {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	// the other tags are skipped, the address falls back to the vid.
+	v := &nebula.Vertex{
+		Vid: intValue(7),
+		Tags: []*nebula.Tag{
+			{Name: []byte("risk"), Props: map[string]*nebula.Value{"name": boolValue(true)}},
+			{Name: []byte("token"), Props: map[string]*nebula.Value{"name": stringValue("Seven")}},
+		},
+	}
+	if token, err = DecodeToken(v); err != nil {
+		t.Fatal(err)
+	}
+	if token.Address != "7" || token.Name != "Seven" {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	v.Tags[1].Props["name"] = &nebula.Value{LVal: &nebula.NList{}}
+	if _, err = DecodeToken(v); err == nil {
+		t.Fatal("a list name should fail")
+	}
+	if _, err = DecodeToken(nil); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+}
+
+func TestDecodeEdge(t *testing.T) {
+	e := &nebula.Edge{
+		Src:     stringValue("0xa"),
+		Dst:     stringValue("0xb"),
+		Type:    1,
+		Name:    []byte("pair"),
+		Ranking: 11,
+		Props:   edgeProps("dex", "0xp", 1000.5, 30),
+	}
+	pair, err := DecodeEdge(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Pair{
+		DexName:       "dex",
+		PairAddress:   "0xp",
+		TrackedVolume: 1000.5,
+		TrackedRaw:    "1000.5",
+		Fee:           30,
+		Token0:        "0xa",
+	}
+	if pair.Src != "0xa" || pair.Dst != "0xb" || pair.Rank != 11 {
+		t.Fatalf("unexpected ends %s -> %s@%d", pair.Src, pair.Dst, pair.Rank)
+	}
+	pair.EModel = want.EModel
+	if !reflect.DeepEqual(*pair, want) {
+		t.Fatalf("got %+v, want %+v", *pair, want)
+	}
+
+	// an edge walked reversely has a negative type and swapped ends.
+	e.Type = -1
+	if pair, err = DecodeEdge(e); err != nil {
+		t.Fatal(err)
+	}
+	if pair.Src != "0xb" || pair.Dst != "0xa" {
+		t.Fatalf("reverse edge decoded as %s -> %s", pair.Src, pair.Dst)
+	}
+
+	e.Props["fee"] = boolValue(true)
+	if _, err = DecodeEdge(e); err == nil || !strings.Contains(err.Error(), "fee") {
+		t.Fatalf("a bool fee should fail with the prop name, got %v", err)
+	}
+	if _, err = DecodeEdge(&nebula.Edge{Src: stringValue("0xa")}); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+}
+
+func TestDecodeStep(t *testing.T) {
+	step := &nebula.Step{
+		Dst:     tokenVertex("0xb", "TokenB"),
+		Type:    1,
+		Name:    []byte("pair"),
+		Ranking: 3,
+		Props:   edgeProps("dex", "0xp", 10, 25),
+	}
+	pair, err := DecodeStep(tokenVertex("0xa", "TokenA"), step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Src != "0xa" || pair.Dst != "0xb" || pair.Rank != 3 || pair.Fee != 25 || pair.PairAddress != "0xp" {
+		t.Fatalf("unexpected pair %+v", pair)
+	}
+	if GetDstFromStep(step) != "0xb" {
+		t.Fatalf("got dst %q", GetDstFromStep(step))
+	}
+	if _, err = DecodeStep(nil, step); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+	if _, err = DecodeStep(tokenVertex("0xa", "TokenA"), &nebula.Step{}); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+}
+
+func TestDecodePath(t *testing.T) {
+	path := &nebula.Path{
+		Src: tokenVertex("0xa", "TokenA"),
+		Steps: []*nebula.Step{
+			{Dst: tokenVertex("0xb", "TokenB"), Type: 1, Ranking: 1, Props: edgeProps("dex1", "0xp1", 10, 30)},
+			{Dst: tokenVertex("0xc", "TokenC"), Type: -1, Ranking: 2, Props: edgeProps("dex2", "0xp2", 20, 5)},
+		},
+	}
+	decoded, err := DecodePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Tokens) != 3 || len(decoded.Pairs) != 2 {
+		t.Fatalf("got %d tokens and %d pairs", len(decoded.Tokens), len(decoded.Pairs))
+	}
+	for i, address := range []string{"0xa", "0xb", "0xc"} {
+		if decoded.Tokens[i].Address != address {
+			t.Fatalf("token %d is %s, want %s", i, decoded.Tokens[i].Address, address)
+		}
+	}
+	if p := decoded.Pairs[0]; p.Src != "0xa" || p.Dst != "0xb" || p.DexName != "dex1" {
+		t.Fatalf("unexpected first pair %+v", p)
+	}
+	// the second step walks its edge reversely, the edge is stored as 0xc -> 0xb.
+	if p := decoded.Pairs[1]; p.Src != "0xc" || p.Dst != "0xb" || p.DexName != "dex2" || p.Fee != 5 {
+		t.Fatalf("unexpected second pair %+v", p)
+	}
+
+	steps, err := ParsePathInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].Pairs[0].Pair != "0xp1" || steps[1].Pairs[0].Fee != "5" {
+		t.Fatalf("unexpected route steps %+v", steps)
+	}
+
+	path.Steps[1].Props["tracked"] = boolValue(true)
+	if _, err = DecodePath(path); err == nil || !strings.Contains(err.Error(), "step 1") {
+		t.Fatalf("a bool tracked should fail in step 1, got %v", err)
+	}
+	if _, err = DecodePath(&nebula.Path{}); !errors.Is(err, ErrNilValue) {
+		t.Fatalf("got %v, want ErrNilValue", err)
+	}
+}
@@ -0,0 +1,310 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/zhihu/norm"
+	"strconv"
+	"time"
+)
+
+const (
+	MetaSchemaVersion = "schema_version"
+
+	// nebula applies schema changes after the next heartbeat of storaged and graphd.
+	DefaultHeartbeat = 10 * time.Second
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown schema version")
+	ErrPairsMissing   = errors.New("pair edges missing from the index")
+)
+
+// Migration is one versioned schema change of the space.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(m *Migrator) error
+	Down    func(m *Migrator) error
+}
+
+// execStatements returns a migration step that executes the nGQL statements in order.
+func execStatements(stmts ...string) func(m *Migrator) error {
+	return func(m *Migrator) error {
+		return m.exec(stmts...)
+	}
+}
+
+// Migrations are the schema migrations in version order, a new migration must be
+// appended with the next version and never change the released ones.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create token and pair schema",
+		Up: execStatements(
+			"CREATE TAG IF NOT EXISTS token(name string, address string)",
+			"CREATE EDGE IF NOT EXISTS pair(dex string, tracked string, fee string, pairaddress string, token0 string, token1 string)",
+			"CREATE TAG INDEX IF NOT EXISTS token_index on token()",
+			"CREATE EDGE INDEX IF NOT EXISTS pair_index on pair()",
+		),
+		Down: execStatements(
+			"DROP EDGE INDEX IF EXISTS pair_index",
+			"DROP TAG INDEX IF EXISTS token_index",
+			"DROP EDGE IF EXISTS pair",
+			"DROP TAG IF EXISTS token",
+		),
+	},
+	{
+		Version: 2,
+		Name:    "add pair reserves",
+		Up:      execStatements("ALTER EDGE pair ADD (reserve0 string, reserve1 string, block int)"),
+		Down:    execStatements("ALTER EDGE pair DROP (reserve0, reserve1, block)"),
+	},
+	{
+		Version: 3,
+		Name:    "add pair address index",
+		Up:      execStatements("CREATE EDGE INDEX IF NOT EXISTS pair_address_index on pair(pairaddress(64))"),
+		Down:    execStatements("DROP EDGE INDEX IF EXISTS pair_address_index"),
+	},
+	{
+		Version: 4,
+		Name:    "numeric pair fee and tracked",
+		Up:      numericPairUp,
+		Down:    numericPairDown,
+	},
+	{
+		Version: 5,
+		Name:    "add token risk",
+		Up: execStatements(
+			"CREATE TAG IF NOT EXISTS risk(flag string, reason string, source string)",
+			"CREATE TAG INDEX IF NOT EXISTS risk_index on risk()",
+		),
+		Down: execStatements(
+			"DROP TAG INDEX IF EXISTS risk_index",
+			"DROP TAG IF EXISTS risk",
+		),
+	},
+	{
+		Version: 6,
+		Name:    "add token info",
+		Up: execStatements(
+			"CREATE TAG IF NOT EXISTS token_info(chain_id int, name string, symbol string, decimals int, "+
+				"logo_uri string, tags string, verified bool, source string)",
+			"CREATE TAG INDEX IF NOT EXISTS token_info_index on token_info()",
+		),
+		Down: execStatements(
+			"DROP TAG INDEX IF EXISTS token_info_index",
+			"DROP TAG IF EXISTS token_info",
+		),
+	},
+}
+
+// LatestVersion is the schema version after all migrations are applied.
+func LatestVersion() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// Migrator applies the migrations to a space, and keeps the schema version in the meta tag.
+type Migrator struct {
+	db        *norm.DB
+	heartbeat time.Duration
+}
+
+func NewMigrator(db *norm.DB, heartbeat time.Duration) *Migrator {
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	return &Migrator{db: db, heartbeat: heartbeat}
+}
+
+// waitSchema waits two heartbeats, so the schema change is visible to all services.
+func (m *Migrator) waitSchema() {
+	log.Infof("wait %s for schema change to take effect", 2*m.heartbeat)
+	time.Sleep(2 * m.heartbeat)
+}
+
+func (m *Migrator) exec(stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := m.db.Execute(stmt); err != nil {
+			return fmt.Errorf("execute (%s) failed: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// prepare creates the meta tag that stores the schema version.
+func (m *Migrator) prepare() error {
+	exist, err := m.metaTagExists()
+	if err != nil || exist {
+		return err
+	}
+	if _, err = m.db.Execute("CREATE TAG IF NOT EXISTS meta(value string)"); err != nil {
+		return err
+	}
+	m.waitSchema()
+	return nil
+}
+
+func (m *Migrator) metaTagExists() (bool, error) {
+	res, err := m.db.Execute("SHOW TAGS")
+	if err != nil {
+		return false, err
+	}
+	tags := make([]map[string]interface{}, 0)
+	if err = UnmarshalResultSet(res, &tags); err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		if name, ok := tag["Name"].([]byte); ok && string(name) == new(models.Meta).TagName() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Version returns the current schema version of the space, 0 if no migration is applied.
+func (m *Migrator) Version() (int, error) {
+	if err := m.prepare(); err != nil {
+		return 0, err
+	}
+	return m.readVersion()
+}
+
+// SchemaVersion returns the schema version of the space without creating the meta tag,
+// 0 if no migration is applied.
+func SchemaVersion(db *norm.DB) (int, error) {
+	m := &Migrator{db: db}
+	exist, err := m.metaTagExists()
+	if err != nil || !exist {
+		return 0, err
+	}
+	return m.readVersion()
+}
+
+func (m *Migrator) readVersion() (int, error) {
+	value, err := GetMeta(m.db, MetaSchemaVersion)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func (m *Migrator) setVersion(version int) error {
+	return SetMeta(m.db, MetaSchemaVersion, strconv.Itoa(version))
+}
+
+// Migrate applies the migrations after the current version up to target.
+func (m *Migrator) Migrate(target int) error {
+	if target < 0 || target > LatestVersion() {
+		return ErrUnknownVersion
+	}
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+	for _, migration := range Migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+		log.Infof("apply migration %d: %s", migration.Version, migration.Name)
+		if err = migration.Up(m); err != nil {
+			return fmt.Errorf("apply migration %d failed: %w", migration.Version, err)
+		}
+		m.waitSchema()
+		if err = m.setVersion(migration.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback reverts the last steps applied migrations.
+func (m *Migrator) Rollback(steps int) error {
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+	for i := len(Migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := Migrations[i]
+		if migration.Version > current {
+			continue
+		}
+		log.Infof("rollback migration %d: %s", migration.Version, migration.Name)
+		if err = migration.Down(m); err != nil {
+			return fmt.Errorf("rollback migration %d failed: %w", migration.Version, err)
+		}
+		m.waitSchema()
+		previous := 0
+		if i > 0 {
+			previous = Migrations[i-1].Version
+		}
+		if err = m.setVersion(previous); err != nil {
+			return err
+		}
+		current = previous
+		steps--
+	}
+	return nil
+}
+
+// schemaIndexes are the indexes of the schema, with the version of the migration that
+// creates them.
+var schemaIndexes = []struct {
+	version int
+	stmt    string
+}{
+	{1, "REBUILD TAG INDEX token_index"},
+	{1, "REBUILD EDGE INDEX pair_index"},
+	{3, "REBUILD EDGE INDEX pair_address_index"},
+	{5, "REBUILD TAG INDEX risk_index"},
+	{6, "REBUILD TAG INDEX token_info_index"},
+}
+
+// RebuildIndexes rebuilds the indexes of the schema version of the space and waits for
+// the jobs, the data inserted before an index is created is only found by LOOKUP after
+// the index is rebuilt.
+func RebuildIndexes(db *norm.DB) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version < 1 {
+		// the spaces prepared before the migrations have the token and pair indexes.
+		version = 1
+	}
+	for _, index := range schemaIndexes {
+		if index.version > version {
+			log.Infof("skip (%s), the space is at schema version %d", index.stmt, version)
+			continue
+		}
+		if err = runJob(db, index.stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMeta returns the value of the meta key, an empty string if it is not set.
+func GetMeta(db *norm.DB, key string) (string, error) {
+	meta := &models.Meta{Key: key}
+	nql := fmt.Sprintf("FETCH PROP ON %s \"%s\" YIELD %s.value AS value", meta.TagName(), meta.GetVid(), meta.TagName())
+	res, err := db.Execute(nql)
+	if err != nil {
+		return "", err
+	}
+	if res.GetRowSize() < 1 {
+		return "", nil
+	}
+	err = UnmarshalResultSet(res, meta)
+	return meta.Value, err
+}
+
+// SetMeta stores the value of the meta key.
+func SetMeta(db *norm.DB, key string, value string) error {
+	return db.InsertVertex(&models.Meta{Key: key, Value: value})
+}
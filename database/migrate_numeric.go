@@ -0,0 +1,358 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vesoft-inc/nebula-go/v3/nebula"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/zhihu/norm"
+)
+
+// pairProps are the fee and tracked props of a pair edge as strings, whatever their type is.
+type pairProps struct {
+	src, dst string
+	rank     int64
+	fee      string
+	tracked  string
+}
+
+func (p pairProps) key() string {
+	return fmt.Sprintf("%s->%s@%d", p.src, p.dst, p.rank)
+}
+
+func scanPairProps(db *norm.DB, fee, tracked string) ([]pairProps, error) {
+	nql := fmt.Sprintf("LOOKUP ON pair YIELD src(edge) AS src, dst(edge) AS dst, rank(edge) AS rank, "+
+		"properties(edge).%s AS fee, properties(edge).%s AS tracked", fee, tracked)
+	res, err := db.Execute(nql)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]pairProps, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		props := pairProps{rank: values[2].GetIVal()}
+		if props.src, err = decodeVid(values[0]); err != nil {
+			return nil, err
+		}
+		if props.dst, err = decodeVid(values[1]); err != nil {
+			return nil, err
+		}
+		props.fee = propString(values[3])
+		props.tracked = propString(values[4])
+		rows = append(rows, props)
+	}
+	return rows, nil
+}
+
+// scanAllPairProps rebuilds pair_index before the scan, LOOKUP misses the edges inserted
+// before the index was created. The scan fails unless it finds as many edges as the
+// stats of the space count.
+func scanAllPairProps(db *norm.DB, fee, tracked string) ([]pairProps, error) {
+	if err := runJob(db, "REBUILD EDGE INDEX pair_index"); err != nil {
+		return nil, err
+	}
+	counts, err := CountSpace(db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := scanPairProps(db, fee, tracked)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(rows)) != counts.Pairs {
+		return nil, fmt.Errorf("%w: lookup found %d of the %d pair edges", ErrPairsMissing, len(rows), counts.Pairs)
+	}
+	return rows, nil
+}
+
+// checkPairProps scans the fee and tracked props again, and fails unless every edge of
+// rows has the values expect returns for it.
+func checkPairProps(db *norm.DB, rows []pairProps, fee, tracked string, expect func(p pairProps) (string, string)) error {
+	scanned, err := scanPairProps(db, fee, tracked)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]pairProps, len(scanned))
+	for _, p := range scanned {
+		found[p.key()] = p
+	}
+	wrong := 0
+	for _, row := range rows {
+		wantFee, wantTracked := expect(row)
+		if p, exist := found[row.key()]; !exist || p.fee != wantFee || p.tracked != wantTracked {
+			if wrong < 10 {
+				log.Warnf("pair %s has %s (%s) and %s (%s), expect (%s) and (%s)", row.key(), fee, p.fee,
+					tracked, p.tracked, wantFee, wantTracked)
+			}
+			wrong++
+		}
+	}
+	if wrong > 0 {
+		return fmt.Errorf("%d of %d pair edges have unexpected %s or %s", wrong, len(rows), fee, tracked)
+	}
+	return nil
+}
+
+// propString returns a string, int or double prop as string, and an empty string for null.
+// A double is formatted as the nGQL literal that sets it.
+func propString(value *nebula.Value) string {
+	switch {
+	case value.IsSetSVal():
+		return string(value.GetSVal())
+	case value.IsSetIVal():
+		return strconv.FormatInt(value.GetIVal(), 10)
+	case value.IsSetFVal():
+		return nqlDouble(value.GetFVal())
+	default:
+		return ""
+	}
+}
+
+func (p pairProps) update(db *norm.DB, set string) error {
+	_, err := db.Execute(fmt.Sprintf("UPDATE EDGE ON pair \"%s\"->\"%s\"@%d SET %s", p.src, p.dst, p.rank, set))
+	return err
+}
+
+// numeric returns the nGQL literals of the fee in basis points and the tracked value of
+// the string props.
+func (p pairProps) numeric() (string, string) {
+	fee, _ := parseFee(p.fee)
+	return strconv.FormatInt(fee, 10), nqlDouble(parseTracked(p.tracked))
+}
+
+// text returns the fee and tracked as scanned.
+func (p pairProps) text() (string, string) {
+	return p.fee, p.tracked
+}
+
+// pairFields returns the types of the props of the pair edge by name.
+func pairFields(db *norm.DB) (map[string]string, error) {
+	res, err := db.Execute("DESCRIBE EDGE pair")
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0)
+	if err = UnmarshalResultSet(res, &rows); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(rows))
+	for _, row := range rows {
+		name, _ := row["Field"].([]byte)
+		kind, _ := row["Type"].([]byte)
+		fields[string(name)] = string(kind)
+	}
+	return fields, nil
+}
+
+// addPairProps adds the props, given as "name type", the pair edge does not have yet,
+// so a failed migration can run again.
+func (m *Migrator) addPairProps(props ...string) error {
+	fields, err := pairFields(m.db)
+	if err != nil {
+		return err
+	}
+	missing := make([]string, 0, len(props))
+	for _, prop := range props {
+		if _, exist := fields[strings.Fields(prop)[0]]; !exist {
+			missing = append(missing, prop)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err = m.exec(fmt.Sprintf("ALTER EDGE pair ADD (%s)", strings.Join(missing, ", "))); err != nil {
+		return err
+	}
+	m.waitSchema()
+	return nil
+}
+
+// dropPairProps drops the props the pair edge still has.
+func (m *Migrator) dropPairProps(names ...string) error {
+	fields, err := pairFields(m.db)
+	if err != nil {
+		return err
+	}
+	existing := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, exist := fields[name]; exist {
+			existing = append(existing, name)
+		}
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	if err = m.exec(fmt.Sprintf("ALTER EDGE pair DROP (%s)", strings.Join(existing, ", "))); err != nil {
+		return err
+	}
+	m.waitSchema()
+	return nil
+}
+
+// numericPairUp keeps the tracked string in tracked_raw, and changes fee to int and
+// tracked to double, so they can be compared in nGQL. A prop can not change its type,
+// so the numbers are staged in fee_num and tracked_num, and the string props are only
+// dropped after every edge is checked to hold its numbers and its tracked_raw. Every
+// stage checks the props of the edge first, so a failed migration resumes where it stopped.
+func numericPairUp(m *Migrator) error {
+	fields, err := pairFields(m.db)
+	if err != nil {
+		return err
+	}
+	var rows []pairProps
+	switch {
+	case fields["fee"] == "string":
+		if rows, err = scanAllPairProps(m.db, "fee", "tracked"); err != nil {
+			return err
+		}
+		if err = checkFees(rows); err != nil {
+			return err
+		}
+		if err = stageNumericPairProps(m, rows); err != nil {
+			return err
+		}
+	case len(fields["fee_num"]) > 0:
+		// the string props are dropped, the staged props hold the fee and the tracked string.
+		if rows, err = scanAllPairProps(m.db, "fee_num", "tracked_raw"); err != nil {
+			return err
+		}
+	default:
+		log.Info("pair fee and tracked are numeric already")
+		return nil
+	}
+
+	if err = m.addPairProps("fee int", "tracked double"); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		fee, tracked := row.numeric()
+		if err = row.update(m.db, fmt.Sprintf("fee = %s, tracked = %s", fee, tracked)); err != nil {
+			return err
+		}
+	}
+	if err = checkPairProps(m.db, rows, "fee", "tracked", pairProps.numeric); err != nil {
+		return err
+	}
+	if err = m.dropPairProps("fee_num", "tracked_num"); err != nil {
+		return err
+	}
+	log.Infof("convert %d pair edges to numeric fee and tracked", len(rows))
+	return nil
+}
+
+// checkFees refuses to migrate the edges with a fee that is not an integer, the fee
+// string is not kept once the fee is numeric.
+func checkFees(rows []pairProps) error {
+	invalid := make([]string, 0)
+	for _, row := range rows {
+		if _, err := parseFee(row.fee); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s (%s)", row.key(), row.fee))
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	count := len(invalid)
+	if count > 10 {
+		invalid = append(invalid[:10], "...")
+	}
+	return fmt.Errorf("%d pair edges have an invalid fee, fix them before the migration: %s",
+		count, strings.Join(invalid, ", "))
+}
+
+// stageNumericPairProps writes the numbers of the string props to fee_num and tracked_num,
+// and the tracked string to tracked_raw, and drops the string props once all are checked.
+func stageNumericPairProps(m *Migrator, rows []pairProps) error {
+	err := m.addPairProps("tracked_raw string", "fee_num int", "tracked_num double")
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		fee, tracked := row.numeric()
+		set := fmt.Sprintf("tracked_raw = %s, fee_num = %s, tracked_num = %s", nqlString(row.tracked), fee, tracked)
+		if err = row.update(m.db, set); err != nil {
+			return err
+		}
+	}
+	if err = checkPairProps(m.db, rows, "fee_num", "tracked_num", pairProps.numeric); err != nil {
+		return err
+	}
+	if err = checkPairProps(m.db, rows, "fee", "tracked_raw", pairProps.text); err != nil {
+		return err
+	}
+	return m.dropPairProps("fee", "tracked")
+}
+
+// numericPairDown restores fee and tracked as strings, tracked is restored from tracked_raw.
+// The fee string is staged in fee_raw, as the up migration stages the numbers, and like
+// the up migration it resumes where a failed run stopped.
+func numericPairDown(m *Migrator) error {
+	fields, err := pairFields(m.db)
+	if err != nil {
+		return err
+	}
+	var rows []pairProps
+	switch {
+	case len(fields["fee"]) > 0 && fields["fee"] != "string":
+		if rows, err = scanAllPairProps(m.db, "fee", "tracked_raw"); err != nil {
+			return err
+		}
+		if err = m.addPairProps("fee_raw string"); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err = row.update(m.db, "fee_raw = "+nqlString(row.fee)); err != nil {
+				return err
+			}
+		}
+		if err = checkPairProps(m.db, rows, "fee_raw", "tracked_raw", pairProps.text); err != nil {
+			return err
+		}
+		if err = m.dropPairProps("fee", "tracked"); err != nil {
+			return err
+		}
+	case len(fields["fee_raw"]) > 0:
+		// the numeric props are dropped, fee_raw and tracked_raw hold the strings.
+		if rows, err = scanAllPairProps(m.db, "fee_raw", "tracked_raw"); err != nil {
+			return err
+		}
+	default:
+		log.Info("pair fee and tracked are strings already")
+		return nil
+	}
+
+	if err = m.addPairProps("fee string", "tracked string"); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		set := fmt.Sprintf("fee = %s, tracked = %s", nqlString(row.fee), nqlString(row.tracked))
+		if err = row.update(m.db, set); err != nil {
+			return err
+		}
+	}
+	if err = checkPairProps(m.db, rows, "fee", "tracked", pairProps.text); err != nil {
+		return err
+	}
+	return m.dropPairProps("fee_raw", "tracked_raw")
+}
+
+// parseFee parses the fee in basis points, an empty fee is 0.
+func parseFee(fee string) (int64, error) {
+	fee = strings.TrimSpace(fee)
+	if len(fee) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(fee, 10, 64)
+}
+
+// parseTracked parses the decimal tracked value as a double, an invalid value is 0.
+func parseTracked(tracked string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(tracked), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestNqlDouble(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0.0"},
+		{30, "30.0"},
+		{0.25, "0.25"},
+		{5946414010839071887513, "5.946414010839072e+21"},
+		{1e21, "1.0e+21"},
+		{1e-7, "1.0e-07"},
+	}
+	for _, tt := range tests {
+		got := nqlDouble(tt.v)
+		if got != tt.want {
+			t.Errorf("nqlDouble(%v) = %s, want %s", tt.v, got, tt.want)
+		}
+		if back, err := strconv.ParseFloat(got, 64); err != nil || back != tt.v {
+			t.Errorf("nqlDouble(%v) = %s parses back to %v, %v", tt.v, got, back, err)
+		}
+	}
+	if got := MinTrackedFilter(5946414010839071887513); got != "pair.tracked > 5.946414010839072e+21" {
+		t.Errorf("got filter %s", got)
+	}
+}
+
+func TestNqlString(t *testing.T) {
+	tests := map[string]string{
+		"1000.5":    `"1000.5"`,
+		`a"b`:       `"a\"b"`,
+		`a\b`:       `"a\\b"`,
+		"a\nb":      `"a\nb"`,
+		`\" OR 1 #`: `"\\\" OR 1 #"`,
+	}
+	for s, want := range tests {
+		if got := nqlString(s); got != want {
+			t.Errorf("nqlString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestPairPropsNumeric(t *testing.T) {
+	fee, tracked := pairProps{fee: " 30 ", tracked: "5946414010839071887513"}.numeric()
+	if fee != "30" || tracked != "5.946414010839072e+21" {
+		t.Fatalf("got %s, %s", fee, tracked)
+	}
+	if _, tracked = (pairProps{tracked: "NaN"}).numeric(); tracked != "0.0" {
+		t.Fatalf("got tracked %s for NaN", tracked)
+	}
+}
+
+func TestCheckFees(t *testing.T) {
+	rows := []pairProps{{src: "a", dst: "b", fee: "30"}, {src: "b", dst: "a", fee: ""}}
+	if err := checkFees(rows); err != nil {
+		t.Fatal(err)
+	}
+	rows = append(rows, pairProps{src: "a", dst: "c", fee: "0.3"})
+	if err := checkFees(rows); err == nil {
+		t.Fatal("an invalid fee should refuse the migration")
+	}
+}
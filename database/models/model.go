@@ -12,15 +12,60 @@ type Token struct {
 
 type Pair struct {
 	norm.EModel
-	DexName       string `norm:"dex"`
-	PairAddress   string `norm:"pairaddress"`
-	TrackedVolume string `norm:"tracked"`
-	Fee           string `norm:"fee"`
-	Token0        string `norm:"token0"`
-	Token1        string `norm:"token1"`
+	DexName       string  `norm:"dex"`
+	PairAddress   string  `norm:"pairaddress"`
+	TrackedVolume float64 `norm:"tracked"`
+	TrackedRaw    string  `norm:"tracked_raw"`
+	Fee           int64   `norm:"fee"`
+	Token0        string  `norm:"token0"`
+	Token1        string  `norm:"token1"`
+	Reserve0      string  `norm:"reserve0"`
+	Reserve1      string  `norm:"reserve1"`
+	Block         int64   `norm:"block"`
+}
+
+// Meta is a key value record of the space, like the schema version.
+type Meta struct {
+	norm.VModel
+	Key   string `norm:"-"`
+	Value string `norm:"value"`
+}
+
+// TokenRisk is the risk flag of a token, a tag of its own on the token vertex, so the
+// token can be imported again without losing it.
+type TokenRisk struct {
+	norm.VModel
+	Address string `norm:"-"`
+	Flag    string `norm:"flag"`
+	Reason  string `norm:"reason"`
+	Source  string `norm:"source"`
+}
+
+// TokenInfo is the metadata of a token from a token list, a tag of its own on the token
+// vertex like TokenRisk, the tags are comma separated.
+type TokenInfo struct {
+	norm.VModel
+	Address  string `norm:"-"`
+	ChainID  int64  `norm:"chain_id"`
+	Name     string `norm:"name"`
+	Symbol   string `norm:"symbol"`
+	Decimals int64  `norm:"decimals"`
+	LogoURI  string `norm:"logo_uri"`
+	Tags     string `norm:"tags"`
+	Verified bool   `norm:"verified"`
+	Source   string `norm:"source"`
+}
+
+// Path is a route in the graph, Pairs[i] connects Tokens[i] and Tokens[i+1].
+type Path struct {
+	Tokens []*Token
+	Pairs  []*Pair
 }
 
 var _ norm.IVertex = new(Token)
+var _ norm.IVertex = new(Meta)
+var _ norm.IVertex = new(TokenRisk)
+var _ norm.IVertex = new(TokenInfo)
 var _ norm.IEdge = new(Pair)
 
 func (*Token) TagName() string {
@@ -35,3 +80,27 @@ func (p *Pair) EdgeName() string {
 	return "pair"
 	//return fmt.Sprintf("%s", p.PairAddress)
 }
+
+func (*Meta) TagName() string {
+	return "meta"
+}
+
+func (m *Meta) GetVid() interface{} {
+	return "__meta_" + m.Key
+}
+
+func (*TokenRisk) TagName() string {
+	return "risk"
+}
+
+func (r *TokenRisk) GetVid() interface{} {
+	return r.Address
+}
+
+func (*TokenInfo) TagName() string {
+	return "token_info"
+}
+
+func (i *TokenInfo) GetVid() interface{} {
+	return i.Address
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/zhihu/norm"
+)
+
+var (
+	ErrPairNotFound = errors.New("pair not found")
+)
+
+// PairState is the mutable state of a pair, the nil fields are kept unchanged.
+type PairState struct {
+	Fee     *string
+	Tracked *string
+	// Reserves are the reserves of Token0 and the other token.
+	Reserves *contracts.PairReserves
+	Token0   string
+}
+
+// ensureToken inserts the token vertex with an empty name if it does not exist.
+func ensureToken(db *norm.DB, address string) error {
+	token := &models.Token{Address: address}
+	nql := fmt.Sprintf("INSERT VERTEX IF NOT EXISTS %s(name, address) VALUES \"%s\":(\"\", \"%s\")",
+		token.TagName(), address, address)
+	_, err := db.Execute(nql)
+	return err
+}
+
+// UpsertPair inserts or overwrites the pair edges in both directions, reserves are the
+// reserves of token0 and token1. The token vertices are created if they do not exist.
+// If the reverse edge fails, the edge from token0 is restored, so the pair never goes
+// one way only.
+func UpsertPair(db *norm.DB, dexname string, pairaddr string, fee string, tracked string, token0, token1 string, reserves *contracts.PairReserves) error {
+	for _, token := range []string{token0, token1} {
+		if err := ensureToken(db, token); err != nil {
+			return err
+		}
+	}
+	previous, err := FindPair(db, pairaddr)
+	if err != nil {
+		return err
+	}
+	// token0 -> token1
+	if err = InsertPair(db, dexname, pairaddr, fee, tracked, token0, token1, reserves); err != nil {
+		return err
+	}
+	// and support token1 -> token0
+	if err = InsertPair(db, dexname, pairaddr, fee, tracked, token1, token0, reserves.Reverse()); err != nil {
+		forward := &models.Pair{EModel: norm.EModel{Src: token0, Dst: token1, Rank: PairRank(dexname, pairaddr)}}
+		restorePairEdges(db, []*models.Pair{forward}, previous)
+		return err
+	}
+	return nil
+}
+
+// edgeKey identifies the edge by its ends and its rank.
+func edgeKey(pair *models.Pair) string {
+	return strings.ToLower(fmt.Sprintf("%v->%v@%d", pair.Src, pair.Dst, pair.Rank))
+}
+
+// restorePairEdges undoes the writes of the edges in written, the edges that were in
+// previous are written back, the others are deleted. The restore is best effort, its
+// failures are logged.
+func restorePairEdges(db *norm.DB, written []*models.Pair, previous []*models.Pair) {
+	before := make(map[string]*models.Pair, len(previous))
+	for _, pair := range previous {
+		before[edgeKey(pair)] = pair
+	}
+	for _, pair := range written {
+		var err error
+		if old, exist := before[edgeKey(pair)]; exist {
+			err = db.InsertEdge(old)
+		} else {
+			err = deletePairEdge(db, pair)
+		}
+		if err != nil {
+			log.WithField("err", err).Errorf("restore pair edge %s failed", edgeKey(pair))
+		}
+	}
+}
+
+// FindPair returns the edges of the pair address, both directions of a pair are returned.
+func FindPair(db *norm.DB, pairaddr string) ([]*models.Pair, error) {
+	nql := fmt.Sprintf("LOOKUP ON pair WHERE pair.pairaddress == \"%s\" YIELD edge AS e", pairaddr)
+	res, err := db.Execute(nql)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]*models.Pair, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		if len(values) < 1 || !values[0].IsSetEVal() {
+			continue
+		}
+		pair, err := DecodeEdge(values[0].GetEVal())
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// FindTokenPairs returns the pair edges from the token.
+func FindTokenPairs(db *norm.DB, token string) ([]*models.Pair, error) {
+	res, err := db.Execute(fmt.Sprintf("GO FROM \"%s\" OVER pair YIELD edge AS e", token))
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]*models.Pair, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		if len(values) < 1 || !values[0].IsSetEVal() {
+			continue
+		}
+		pair, err := DecodeEdge(values[0].GetEVal())
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// DeletePair deletes all the edges of the pair address in one statement, and returns
+// the count of deleted edges.
+func DeletePair(db *norm.DB, pairaddr string) (int, error) {
+	pairs, err := FindPair(db, pairaddr)
+	if err != nil {
+		return 0, err
+	}
+	if len(pairs) == 0 {
+		return 0, ErrPairNotFound
+	}
+	edges := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		edges = append(edges, fmt.Sprintf("\"%v\"->\"%v\"@%d", pair.Src, pair.Dst, pair.Rank))
+	}
+	if _, err = db.Execute(fmt.Sprintf("DELETE EDGE %s %s", pairs[0].EdgeName(), strings.Join(edges, ", "))); err != nil {
+		return 0, err
+	}
+	log.WithField("pair", pairaddr).Infof("delete %d pair edges", len(pairs))
+	return len(pairs), nil
+}
+
+// DeleteToken deletes the token and all the pair edges from and to it.
+func DeleteToken(db *norm.DB, address string) error {
+	_, err := db.Execute(fmt.Sprintf("DELETE VERTEX \"%s\" WITH EDGE", address))
+	return err
+}
+
+// UpdatePairState updates the state of all the edges of the pair address, the reserves
+// are swapped for the edges from the other token. If an edge fails, the edges updated
+// before it are restored. It returns the count of updated edges.
+func UpdatePairState(db *norm.DB, pairaddr string, state PairState) (int, error) {
+	if state.Reserves != nil && len(state.Token0) == 0 {
+		return 0, errors.New("token0 of the reserves is required")
+	}
+	var fee int64
+	if state.Fee != nil {
+		var err error
+		if fee, err = parseFee(*state.Fee); err != nil {
+			return 0, err
+		}
+	}
+	pairs, err := FindPair(db, pairaddr)
+	if err != nil {
+		return 0, err
+	}
+	if len(pairs) == 0 {
+		return 0, ErrPairNotFound
+	}
+	updated := make([]*models.Pair, 0, len(pairs))
+	for _, pair := range pairs {
+		next := *pair
+		if state.Fee != nil {
+			next.Fee = fee
+		}
+		if state.Tracked != nil {
+			next.TrackedVolume, next.TrackedRaw = parseTracked(*state.Tracked), *state.Tracked
+		}
+		if state.Reserves != nil {
+			reserves := state.Reserves
+			if !strings.EqualFold(fmt.Sprint(next.Src), state.Token0) {
+				reserves = reserves.Reverse()
+			}
+			next.Reserve0 = reserves.Reserve0.String()
+			next.Reserve1 = reserves.Reserve1.String()
+			next.Block = int64(reserves.Block)
+		}
+		if err = db.InsertEdge(&next); err != nil {
+			restorePairEdges(db, updated, pairs)
+			return 0, err
+		}
+		updated = append(updated, &next)
+	}
+	return len(pairs), nil
+}
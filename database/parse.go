@@ -17,6 +17,11 @@ const (
 	PairProp_paircontract = "pairaddress"
 	PairProp_fee          = "fee"
 	PairProp_tracked      = "tracked"
+	PairProp_trackedRaw   = "tracked_raw"
+	PairProp_token0       = "token0"
+	PairProp_reserve0     = "reserve0"
+	PairProp_reserve1     = "reserve1"
+	PairProp_block        = "block"
 )
 
 // UnmarshalResultSet 解组 ResultSet 为传入的结构体
@@ -101,7 +106,9 @@ func toStruct(val reflect.Value, resultSet *dialectors.ResultSet) (err error) {
 		}
 		value := row.GetValues()[j]
 		field := val.Field(fieldPos)
-		err = setFieldValue(col, field, value)
+		if err = setFieldValue(col, field, value); err != nil {
+			return err
+		}
 	}
 
 	return
@@ -136,7 +143,9 @@ func toStructSlice(val reflect.Value, resultSet *dialectors.ResultSet) (err erro
 			}
 			nValue := row.GetValues()[j]
 			field := val.Index(i).Field(fieldPos)
-			err = setFieldValue(col, field, nValue)
+			if err = setFieldValue(col, field, nValue); err != nil {
+				return err
+			}
 		}
 	}
 	return
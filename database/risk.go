@@ -0,0 +1,144 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/xueqianLu/routegen/types"
+	"github.com/zhihu/norm"
+)
+
+const (
+	// RiskAllowed is a token of the allowlist, it is never flagged by the detection.
+	RiskAllowed = "allowed"
+	// RiskBlocked is a token of the blocklist.
+	RiskBlocked = "blocked"
+	// RiskHoneypot is a token that can be bought but not sold back to its pool.
+	RiskHoneypot = "honeypot"
+	// RiskFeeOnTransfer is a token that takes a fee from the transferred amount.
+	RiskFeeOnTransfer = "fee-on-transfer"
+)
+
+// RiskFlags are the valid flags of a token risk.
+var RiskFlags = []string{RiskAllowed, RiskBlocked, RiskHoneypot, RiskFeeOnTransfer}
+
+// TokenRisk is the risk flag of a token, Source is where the flag comes from, like the
+// list file or the detection.
+type TokenRisk struct {
+	Address string `json:"address"`
+	Flag    string `json:"flag"`
+	Reason  string `json:"reason,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Flagged tells whether the routes through the token are excluded.
+func (r *TokenRisk) Flagged() bool {
+	return len(r.Flag) > 0 && r.Flag != RiskAllowed
+}
+
+// ValidRiskFlag returns an error if flag is not one of RiskFlags.
+func ValidRiskFlag(flag string) error {
+	for _, valid := range RiskFlags {
+		if flag == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown risk flag (%s), want one of %s", flag, strings.Join(RiskFlags, ", "))
+}
+
+// RiskSet is the token risks keyed by the lower case address.
+type RiskSet map[string]TokenRisk
+
+// LoadRiskSet reads the token risks of the store.
+func LoadRiskSet(store Store) (RiskSet, error) {
+	risks, err := store.TokenRisks()
+	if err != nil {
+		return nil, err
+	}
+	set := make(RiskSet, len(risks))
+	for _, risk := range risks {
+		set[strings.ToLower(risk.Address)] = risk
+	}
+	return set, nil
+}
+
+// Get returns the risk of token, and whether it has one.
+func (s RiskSet) Get(token string) (TokenRisk, bool) {
+	risk, exist := s[strings.ToLower(token)]
+	return risk, exist
+}
+
+// Flagged tells whether the token has a flag that excludes it from the routes.
+func (s RiskSet) Flagged(token string) bool {
+	risk, exist := s.Get(token)
+	return exist && risk.Flagged()
+}
+
+// RouteFlagged tells whether the route goes through a flagged token, the source and
+// the destination included.
+func (s RiskSet) RouteFlagged(route *types.TokenRoute) bool {
+	for _, step := range route.Steps {
+		if s.Flagged(step.Src) || s.Flagged(step.Dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterRoutes returns the routes without a flagged token.
+func (s RiskSet) FilterRoutes(routes []*types.TokenRoute) []*types.TokenRoute {
+	if len(s) == 0 {
+		return routes
+	}
+	filtered := make([]*types.TokenRoute, 0, len(routes))
+	for _, route := range routes {
+		if !s.RouteFlagged(route) {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
+}
+
+// sortRisks orders the risks by the lower case address.
+func sortRisks(risks []TokenRisk) {
+	sort.Slice(risks, func(i, j int) bool {
+		return strings.ToLower(risks[i].Address) < strings.ToLower(risks[j].Address)
+	})
+}
+
+// ScanTokenRisks returns the risk tags in the space.
+func ScanTokenRisks(db *norm.DB) ([]TokenRisk, error) {
+	res, err := db.Execute("LOOKUP ON risk YIELD id(vertex) AS address, properties(vertex).flag AS flag, " +
+		"properties(vertex).reason AS reason, properties(vertex).source AS source")
+	if err != nil {
+		return nil, err
+	}
+	risks := make([]TokenRisk, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		address, err := decodeVid(values[0])
+		if err != nil {
+			return nil, err
+		}
+		risks = append(risks, TokenRisk{
+			Address: address,
+			Flag:    propString(values[1]),
+			Reason:  propString(values[2]),
+			Source:  propString(values[3]),
+		})
+	}
+	sortRisks(risks)
+	return risks, nil
+}
+
+// SetTokenRisk inserts or overwrites the risk tag of the token, an empty flag deletes it.
+func SetTokenRisk(db *norm.DB, risk TokenRisk) error {
+	tag := &models.TokenRisk{Address: risk.Address, Flag: risk.Flag, Reason: risk.Reason, Source: risk.Source}
+	if len(risk.Flag) == 0 {
+		_, err := db.Execute(fmt.Sprintf("DELETE TAG %s FROM \"%s\"", tag.TagName(), risk.Address))
+		return err
+	}
+	return db.InsertVertex(tag)
+}
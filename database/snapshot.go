@@ -0,0 +1,271 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SnapshotFormat is the version of the snapshot file layout, it is bumped on
+	// incompatible changes of the header or the records.
+	SnapshotFormat = 1
+
+	// MetaGraphVersion is the version of the graph data, it changes on every import.
+	MetaGraphVersion = "graph_version"
+	// MetaGraphSources is the json list of the files imported into the graph.
+	MetaGraphSources = "graph_sources"
+)
+
+var (
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
+
+// GraphSource is a data file imported into the graph.
+type GraphSource struct {
+	File   string `json:"file"`
+	Sha256 string `json:"sha256"`
+}
+
+// SnapshotHeader describes the graph in a snapshot, Checksum is the sha256 of the
+// graph record that follows the header.
+type SnapshotHeader struct {
+	Format       int           `json:"format"`
+	Created      time.Time     `json:"created"`
+	GraphVersion string        `json:"graph_version"`
+	Sources      []GraphSource `json:"sources"`
+	Tokens       int           `json:"tokens"`
+	Pairs        int           `json:"pairs"`
+	Checksum     string        `json:"checksum"`
+}
+
+// SnapshotGraph is all the tokens and pair edges of the graph.
+type SnapshotGraph struct {
+	Tokens []TokenRecord `json:"tokens"`
+	Pairs  []PairRecord  `json:"pairs"`
+	Risks  []TokenRisk   `json:"risks,omitempty"`
+	Infos  []TokenInfo   `json:"token_infos,omitempty"`
+}
+
+// Snapshot is a backup of the graph independent of the store. The file is gzip
+// compressed, with the header json on the first line and the graph json on the second.
+type Snapshot struct {
+	Header SnapshotHeader
+	Graph  SnapshotGraph
+}
+
+// NewGraphVersion returns a graph version for an import finished now.
+func NewGraphVersion() string {
+	return time.Now().UTC().Format("20060102T150405Z")
+}
+
+// FileSource returns the source record of the data file.
+func FileSource(path string) (GraphSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return GraphSource{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return GraphSource{}, err
+	}
+	return GraphSource{File: path, Sha256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// GraphSources returns the files imported into the store.
+func GraphSources(store Store) ([]GraphSource, error) {
+	value, err := store.GetMeta(MetaGraphSources)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	sources := make([]GraphSource, 0)
+	if err = json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, fmt.Errorf("invalid %s meta: %w", MetaGraphSources, err)
+	}
+	return sources, nil
+}
+
+// RecordImport adds the imported files to the sources of the store, and sets a new graph version.
+func RecordImport(store Store, imported []GraphSource) error {
+	sources, err := GraphSources(store)
+	if err != nil {
+		return err
+	}
+	for _, source := range imported {
+		if !containsSource(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return setGraphMeta(store, NewGraphVersion(), sources)
+}
+
+func containsSource(sources []GraphSource, source GraphSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+func setGraphMeta(store Store, version string, sources []GraphSource) error {
+	if sources == nil {
+		sources = []GraphSource{}
+	}
+	data, err := json.Marshal(sources)
+	if err != nil {
+		return err
+	}
+	if err = store.SetMeta(MetaGraphSources, string(data)); err != nil {
+		return err
+	}
+	return store.SetMeta(MetaGraphVersion, version)
+}
+
+// ReadSnapshot reads the graph of the store, the records are sorted so the snapshots of
+// the same graph have the same checksum on all the stores.
+func ReadSnapshot(store Store) (*Snapshot, error) {
+	version, err := store.GetMeta(MetaGraphVersion)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := GraphSources(store)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := store.Tokens()
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := store.Pairs()
+	if err != nil {
+		return nil, err
+	}
+	risks, err := store.TokenRisks()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := store.TokenInfos()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return strings.ToLower(tokens[i].Address) < strings.ToLower(tokens[j].Address)
+	})
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairKey(pairs[i].Src, pairs[i].Dst, pairs[i].Dex, pairs[i].Pair) <
+			pairKey(pairs[j].Src, pairs[j].Dst, pairs[j].Dex, pairs[j].Pair)
+	})
+	return &Snapshot{
+		Header: SnapshotHeader{
+			Format:       SnapshotFormat,
+			Created:      time.Now().UTC(),
+			GraphVersion: version,
+			Sources:      sources,
+			Tokens:       len(tokens),
+			Pairs:        len(pairs),
+		},
+		Graph: SnapshotGraph{Tokens: tokens, Pairs: pairs, Risks: risks, Infos: infos},
+	}, nil
+}
+
+// Write writes the compressed snapshot to w, the checksum of the header is set.
+func (s *Snapshot) Write(w io.Writer) error {
+	graph, err := json.Marshal(s.Graph)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(graph)
+	s.Header.Checksum = hex.EncodeToString(sum[:])
+	header, err := json.Marshal(s.Header)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	for _, data := range [][]byte{header, []byte("\n"), graph, []byte("\n")} {
+		if _, err = zw.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// LoadSnapshot reads the compressed snapshot from r and verifies its checksum.
+func LoadSnapshot(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot header failed: %w", err)
+	}
+	s := &Snapshot{}
+	if err = json.Unmarshal(line, &s.Header); err != nil {
+		return nil, fmt.Errorf("invalid snapshot header: %w", err)
+	}
+	if s.Header.Format < 1 || s.Header.Format > SnapshotFormat {
+		return nil, fmt.Errorf("unsupported snapshot format %d", s.Header.Format)
+	}
+	graph, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	graph = bytes.TrimRight(graph, "\n")
+	sum := sha256.Sum256(graph)
+	if hex.EncodeToString(sum[:]) != s.Header.Checksum {
+		return nil, ErrSnapshotChecksum
+	}
+	if err = json.Unmarshal(graph, &s.Graph); err != nil {
+		return nil, fmt.Errorf("invalid snapshot graph: %w", err)
+	}
+	if len(s.Graph.Tokens) != s.Header.Tokens || len(s.Graph.Pairs) != s.Header.Pairs {
+		return nil, fmt.Errorf("snapshot has %d tokens and %d pairs, the header has %d and %d",
+			len(s.Graph.Tokens), len(s.Graph.Pairs), s.Header.Tokens, s.Header.Pairs)
+	}
+	return s, nil
+}
+
+// Restore writes the graph into the prepared store, the graph version and the sources
+// of the snapshot are kept.
+func (s *Snapshot) Restore(store Store) error {
+	return Batch(store, s.restore)
+}
+
+func (s *Snapshot) restore(store Store) error {
+	for _, token := range s.Graph.Tokens {
+		if err := store.InsertToken(token.Name, token.Address); err != nil {
+			return fmt.Errorf("insert token %s failed: %w", token.Address, err)
+		}
+	}
+	for i := range s.Graph.Pairs {
+		pair := &s.Graph.Pairs[i]
+		if err := pair.InsertInto(store); err != nil {
+			return fmt.Errorf("insert pair %s (%s -> %s) failed: %w", pair.Pair, pair.Src, pair.Dst, err)
+		}
+	}
+	for _, risk := range s.Graph.Risks {
+		if err := store.SetTokenRisk(risk); err != nil {
+			return fmt.Errorf("set risk of token %s failed: %w", risk.Address, err)
+		}
+	}
+	for _, info := range s.Graph.Infos {
+		if err := store.SetTokenInfo(info); err != nil {
+			return fmt.Errorf("set info of token %s failed: %w", info.Address, err)
+		}
+	}
+	return setGraphMeta(store, s.Header.GraphVersion, s.Header.Sources)
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nebula "github.com/vesoft-inc/nebula-go/v3"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/zhihu/norm"
+	"github.com/zhihu/norm/dialectors"
+)
+
+const (
+	DefaultPartitions = 10
+	DefaultReplicas   = 1
+	DefaultVidLength  = 64
+)
+
+var (
+	ErrJobFailed = errors.New("job failed")
+)
+
+// spaceDialector executes the statements without a space, the dialector of norm
+// always uses the configured space, which does not exist before it is created.
+type spaceDialector struct {
+	pool     *nebula.ConnectionPool
+	username string
+	password string
+}
+
+var _ dialectors.IDialector = new(spaceDialector)
+
+func (d *spaceDialector) Execute(stmt string) (*dialectors.ResultSet, error) {
+	session, err := d.pool.GetSession(d.username, d.password)
+	if err != nil {
+		return &dialectors.ResultSet{}, err
+	}
+	defer session.Release()
+	result, err := session.Execute(stmt)
+	if err != nil {
+		return &dialectors.ResultSet{}, err
+	}
+	if result.GetErrorCode() != nebula.ErrorCode_SUCCEEDED {
+		return &dialectors.ResultSet{}, fmt.Errorf("code: %d, msg: %s", result.GetErrorCode(), result.GetErrorMsg())
+	}
+	return &dialectors.ResultSet{ResultSet: result}, nil
+}
+
+func (d *spaceDialector) Close() {
+	d.pool.Close()
+}
+
+// NewSpaceDb connects to nebula without using a space, for the statements on spaces.
+func NewSpaceDb(conf *config.Config) (*norm.DB, error) {
+	host, portStr, found := strings.Cut(conf.DbHost, ":")
+	if !found {
+		return nil, fmt.Errorf("address %s invalid", conf.DbHost)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("address %s invalid", conf.DbHost)
+	}
+	poolConf := nebula.GetDefaultConf()
+	poolConf.TimeOut = time.Second * 5
+	pool, err := nebula.NewConnectionPool([]nebula.HostAddress{{Host: host, Port: port}}, poolConf, nebula.DefaultLogger{})
+	if err != nil {
+		return nil, err
+	}
+	return norm.Open(&spaceDialector{pool: pool, username: conf.DbUser, password: conf.DbPasswd}, norm.Config{})
+}
+
+// SpaceOptions are the options to create a space.
+type SpaceOptions struct {
+	Partitions int
+	Replicas   int
+	VidLength  int
+}
+
+// SpaceOptionsFromConfig returns the space options in conf, with defaults for the missing ones.
+func SpaceOptionsFromConfig(conf *config.Config) SpaceOptions {
+	opts := SpaceOptions{Partitions: conf.DbPartitions, Replicas: conf.DbReplicas, VidLength: conf.DbVidLength}
+	if opts.Partitions <= 0 {
+		opts.Partitions = DefaultPartitions
+	}
+	if opts.Replicas <= 0 {
+		opts.Replicas = DefaultReplicas
+	}
+	if opts.VidLength <= 0 {
+		opts.VidLength = DefaultVidLength
+	}
+	return opts
+}
+
+// CreateSpace creates the space, and waits until it can be used.
+func CreateSpace(db *norm.DB, name string, opts SpaceOptions, heartbeat time.Duration) error {
+	nql := fmt.Sprintf("CREATE SPACE IF NOT EXISTS %s (partition_num = %d, replica_factor = %d, vid_type = FIXED_STRING(%d))",
+		name, opts.Partitions, opts.Replicas, opts.VidLength)
+	if _, err := db.Execute(nql); err != nil {
+		return err
+	}
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	log.Infof("wait %s for space %s to take effect", 2*heartbeat, name)
+	time.Sleep(2 * heartbeat)
+	return nil
+}
+
+func DropSpace(db *norm.DB, name string) error {
+	_, err := db.Execute(fmt.Sprintf("DROP SPACE IF EXISTS %s", name))
+	return err
+}
+
+// DescribeSpace returns the DESCRIBE SPACE result as a table, the first row is the column names.
+func DescribeSpace(db *norm.DB, name string) ([][]string, error) {
+	res, err := db.Execute(fmt.Sprintf("DESCRIBE SPACE %s", name))
+	if err != nil {
+		return nil, err
+	}
+	return res.AsStringTable(), nil
+}
+
+// SpaceStats returns the statistics of the space db uses as a table, with refresh it
+// runs a new stats job and waits for it, otherwise the result of the last job is returned.
+func SpaceStats(db *norm.DB, refresh bool) ([][]string, error) {
+	if refresh {
+		if err := runStatsJob(db); err != nil {
+			return nil, err
+		}
+	}
+	res, err := db.Execute("SHOW STATS")
+	if err != nil {
+		return nil, err
+	}
+	return res.AsStringTable(), nil
+}
+
+func runStatsJob(db *norm.DB) error {
+	return runJob(db, "SUBMIT JOB STATS")
+}
+
+// runJob submits the job statement, and waits until the job finishes.
+func runJob(db *norm.DB, stmt string) error {
+	res, err := db.Execute(stmt)
+	if err != nil {
+		return err
+	}
+	if res.GetRowSize() < 1 {
+		return fmt.Errorf("%w: %s", ErrJobFailed, stmt)
+	}
+	jobId := res.GetRows()[0].GetValues()[0].GetIVal()
+	for {
+		res, err = db.Execute(fmt.Sprintf("SHOW JOB %d", jobId))
+		if err != nil {
+			return err
+		}
+		table := res.AsStringTable()
+		status := ""
+		if len(table) > 1 {
+			for i, col := range table[0] {
+				if col == "Status" {
+					status = strings.Trim(table[1][i], "\"")
+				}
+			}
+		}
+		switch status {
+		case "FINISHED":
+			return nil
+		case "FAILED", "STOPPED":
+			return fmt.Errorf("%w: %s", ErrJobFailed, stmt)
+		}
+		log.Infof("wait job %d, status %s", jobId, status)
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,388 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/types"
+)
+
+const (
+	// DefaultMaxSteps is the hop limit of the sql route search when none is given, same as nebula.
+	DefaultMaxSteps = 5
+	// maxSQLArgs keeps the IN lists under the variable limit of sqlite.
+	maxSQLArgs = 500
+)
+
+// sqlSchema is valid on both sqlite and postgres, all the strings are TEXT so the
+// columns of the recursive query have the same type in both terms.
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS tokens (
+		address TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS pairs (
+		src TEXT NOT NULL,
+		dst TEXT NOT NULL,
+		dex TEXT NOT NULL,
+		pairaddress TEXT NOT NULL,
+		fee BIGINT NOT NULL DEFAULT 0,
+		tracked DOUBLE PRECISION NOT NULL DEFAULT 0,
+		tracked_raw TEXT NOT NULL DEFAULT '',
+		token0 TEXT NOT NULL DEFAULT '',
+		token1 TEXT NOT NULL DEFAULT '',
+		reserve0 TEXT NOT NULL DEFAULT '',
+		reserve1 TEXT NOT NULL DEFAULT '',
+		block BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (src, dst, dex, pairaddress)
+	)`,
+	`CREATE TABLE IF NOT EXISTS meta (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS token_risks (
+		address TEXT PRIMARY KEY,
+		flag TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS token_infos (
+		address TEXT PRIMARY KEY,
+		chain_id BIGINT NOT NULL DEFAULT 0,
+		name TEXT NOT NULL DEFAULT '',
+		symbol TEXT NOT NULL DEFAULT '',
+		decimals INTEGER NOT NULL DEFAULT 0,
+		logo_uri TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '',
+		verified BOOLEAN NOT NULL DEFAULT FALSE,
+		source TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS pairs_src_index ON pairs (src)`,
+	`CREATE INDEX IF NOT EXISTS pairs_address_index ON pairs (pairaddress)`,
+	// the addresses are matched case insensitively, as on the nebula and bolt stores.
+	`CREATE INDEX IF NOT EXISTS pairs_src_lower_index ON pairs (LOWER(src))`,
+	`CREATE INDEX IF NOT EXISTS pairs_address_lower_index ON pairs (LOWER(pairaddress))`,
+}
+
+// sqlRouteQuery walks the pairs from the source token with a recursive CTE, the visited
+// tokens are kept in lower case in a comma separated list to skip the loops, and the walk
+// stops at the destination or the hop limit. The tokens are matched case insensitively,
+// and the route keeps the source token of every pair as stored.
+const sqlRouteQuery = `WITH RECURSIVE walk (node, hops, visited, tokens, pairs) AS (
+	SELECT CAST(? AS TEXT), 0, CAST(',' || LOWER(?) || ',' AS TEXT), CAST('' AS TEXT), CAST('' AS TEXT)
+	UNION ALL
+	SELECT p.dst, w.hops + 1, w.visited || LOWER(p.dst) || ',', w.tokens || p.src || ',', w.pairs || p.pairaddress || ','
+	FROM walk w JOIN pairs p ON LOWER(p.src) = LOWER(w.node)
+	WHERE w.hops < ? AND LOWER(w.node) <> LOWER(?) AND (CAST(? AS DOUBLE PRECISION) <= 0 OR p.tracked > ?)
+		AND w.visited NOT LIKE '%,' || LOWER(p.dst) || ',%'
+)
+SELECT tokens || node, pairs FROM walk WHERE LOWER(node) = LOWER(?) AND hops > 0 ORDER BY hops`
+
+// SQLStore is the Store on sqlite or postgres.
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+}
+
+// OpenSQLStore opens the database of driver, dsn is a file name for sqlite and a connection string for postgres.
+func OpenSQLStore(driver string, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if driver == DriverSQLite {
+		// sqlite allows one writer, and the queries in the other connections see SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	}
+	return &SQLStore{db: db, driver: driver}, nil
+}
+
+// rebind changes the ? placeholders to $n for postgres.
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func (s *SQLStore) exec(query string, args ...interface{}) error {
+	_, err := s.db.Exec(s.rebind(query), args...)
+	return err
+}
+
+func (s *SQLStore) Prepare() error {
+	for _, stmt := range sqlSchema {
+		if err := s.exec(stmt); err != nil {
+			return fmt.Errorf("execute (%s) failed: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) InsertToken(name string, address string) error {
+	return s.exec(`INSERT INTO tokens (address, name) VALUES (?, ?)
+		ON CONFLICT (address) DO UPDATE SET name = excluded.name`, address, name)
+}
+
+func (s *SQLStore) InsertPair(dexname string, pairaddr string, fee string, tracked string, token0, token1 string, reserves *contracts.PairReserves) error {
+	feeBps, err := parseFee(fee)
+	if err != nil {
+		return err
+	}
+	var reserve0, reserve1 string
+	var block int64
+	if reserves != nil {
+		reserve0, reserve1, block = reserves.Reserve0.String(), reserves.Reserve1.String(), int64(reserves.Block)
+	}
+	err = s.exec(`INSERT INTO pairs (src, dst, dex, pairaddress, fee, tracked, tracked_raw, token0, token1, reserve0, reserve1, block)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (src, dst, dex, pairaddress) DO UPDATE SET fee = excluded.fee, tracked = excluded.tracked,
+		tracked_raw = excluded.tracked_raw, token0 = excluded.token0, token1 = excluded.token1,
+		reserve0 = excluded.reserve0, reserve1 = excluded.reserve1, block = excluded.block`,
+		token0, token1, dexname, pairaddr, feeBps, parseTracked(tracked), tracked, token0, token1, reserve0, reserve1, block)
+	if err != nil {
+		log.WithField("err", err).WithField("pair", pairaddr).Error("insert pair failed")
+	}
+	return err
+}
+
+// RebuildIndexes updates the statistics of the query planner, the sql indexes are always up to date.
+func (s *SQLStore) RebuildIndexes() error {
+	return s.exec("ANALYZE")
+}
+
+func (s *SQLStore) QueryRoutes(token0, token1 string, maxSteps int, minTracked float64) ([]*types.TokenRoute, error) {
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	rows, err := s.db.Query(s.rebind(sqlRouteQuery), token0, token0, maxSteps, token1, minTracked, minTracked, token1)
+	if err != nil {
+		return nil, err
+	}
+	type walk struct {
+		tokens []string
+		pairs  []string
+	}
+	walks := make([]walk, 0)
+	pairSet := make(map[string]bool)
+	for rows.Next() {
+		var tokens, pairs string
+		if err = rows.Scan(&tokens, &pairs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w := walk{tokens: strings.Split(strings.Trim(tokens, ","), ","), pairs: strings.Split(strings.Trim(pairs, ","), ",")}
+		for _, pair := range w.pairs {
+			pairSet[pair] = true
+		}
+		walks = append(walks, w)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	infos, err := s.pairInfos(pairSet)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]*types.TokenRoute, 0, len(walks))
+	for _, w := range walks {
+		route := &types.TokenRoute{Steps: make([]types.RouteStep, len(w.pairs))}
+		for i, pair := range w.pairs {
+			route.Steps[i] = types.RouteStep{
+				Src:   w.tokens[i],
+				Dst:   w.tokens[i+1],
+				Pairs: []types.RoutePairInfo{infos[pairKey(w.tokens[i], w.tokens[i+1], "", pair)]},
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// pairInfos loads the pairs of the addresses, keyed by pairKey without the dex.
+func (s *SQLStore) pairInfos(addresses map[string]bool) (map[string]types.RoutePairInfo, error) {
+	infos := make(map[string]types.RoutePairInfo)
+	args := make([]interface{}, 0, len(addresses))
+	for address := range addresses {
+		args = append(args, address)
+	}
+	for start := 0; start < len(args); start += maxSQLArgs {
+		end := start + maxSQLArgs
+		if end > len(args) {
+			end = len(args)
+		}
+		if err := s.loadPairInfos(args[start:end], infos); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (s *SQLStore) loadPairInfos(args []interface{}, infos map[string]types.RoutePairInfo) error {
+	query := `SELECT src, dst, dex, pairaddress, fee, tracked_raw, token0, reserve0, reserve1, block
+		FROM pairs WHERE pairaddress IN (?` + strings.Repeat(", ?", len(args)-1) + `)`
+	rows, err := s.db.Query(s.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var src, dst string
+		var fee int64
+		info := types.RoutePairInfo{}
+		if err = rows.Scan(&src, &dst, &info.Dex, &info.Pair, &fee, &info.Tracked, &info.Token0,
+			&info.Reserve0, &info.Reserve1, &info.Block); err != nil {
+			return err
+		}
+		info.Fee = strconv.FormatInt(fee, 10)
+		infos[pairKey(src, dst, "", info.Pair)] = info
+	}
+	return rows.Err()
+}
+
+func (s *SQLStore) Tokens() ([]TokenRecord, error) {
+	rows, err := s.db.Query("SELECT address, name FROM tokens ORDER BY address")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]TokenRecord, 0)
+	for rows.Next() {
+		var token TokenRecord
+		if err = rows.Scan(&token.Address, &token.Name); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLStore) Pairs() ([]PairRecord, error) {
+	return s.queryPairs("")
+}
+
+func (s *SQLStore) TokenPairs(token string) ([]PairRecord, error) {
+	return s.queryPairs("WHERE LOWER(src) = LOWER(?)", token)
+}
+
+func (s *SQLStore) PairEdges(pair string) ([]PairRecord, error) {
+	return s.queryPairs("WHERE LOWER(pairaddress) = LOWER(?)", pair)
+}
+
+// queryPairs returns the pair edges matching where, ordered by the source token.
+func (s *SQLStore) queryPairs(where string, args ...interface{}) ([]PairRecord, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT src, dst, dex, pairaddress, fee, tracked, tracked_raw, token0, token1, reserve0, reserve1, block
+		FROM pairs `+where+` ORDER BY src, dst, dex, pairaddress`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pairs := make([]PairRecord, 0)
+	for rows.Next() {
+		var p PairRecord
+		if err = rows.Scan(&p.Src, &p.Dst, &p.Dex, &p.Pair, &p.Fee, &p.Tracked, &p.TrackedRaw, &p.Token0, &p.Token1,
+			&p.Reserve0, &p.Reserve1, &p.Block); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+func (s *SQLStore) GetMeta(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(s.rebind("SELECT value FROM meta WHERE name = ?"), key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *SQLStore) SetMeta(key string, value string) error {
+	return s.exec(`INSERT INTO meta (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`, key, value)
+}
+
+func (s *SQLStore) TokenRisks() ([]TokenRisk, error) {
+	rows, err := s.db.Query("SELECT address, flag, reason, source FROM token_risks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	risks := make([]TokenRisk, 0)
+	for rows.Next() {
+		var risk TokenRisk
+		if err = rows.Scan(&risk.Address, &risk.Flag, &risk.Reason, &risk.Source); err != nil {
+			return nil, err
+		}
+		risks = append(risks, risk)
+	}
+	sortRisks(risks)
+	return risks, rows.Err()
+}
+
+func (s *SQLStore) SetTokenRisk(risk TokenRisk) error {
+	address := strings.ToLower(risk.Address)
+	if len(risk.Flag) == 0 {
+		return s.exec("DELETE FROM token_risks WHERE address = ?", address)
+	}
+	return s.exec(`INSERT INTO token_risks (address, flag, reason, source) VALUES (?, ?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET flag = excluded.flag, reason = excluded.reason, source = excluded.source`,
+		address, risk.Flag, risk.Reason, risk.Source)
+}
+
+func (s *SQLStore) TokenInfos() ([]TokenInfo, error) {
+	rows, err := s.db.Query("SELECT address, chain_id, name, symbol, decimals, logo_uri, tags, verified, source FROM token_infos")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	infos := make([]TokenInfo, 0)
+	for rows.Next() {
+		var info TokenInfo
+		var tags string
+		if err = rows.Scan(&info.Address, &info.ChainID, &info.Name, &info.Symbol, &info.Decimals,
+			&info.LogoURI, &tags, &info.Verified, &info.Source); err != nil {
+			return nil, err
+		}
+		info.Tags = splitTags(tags)
+		infos = append(infos, info)
+	}
+	sortInfos(infos)
+	return infos, rows.Err()
+}
+
+func (s *SQLStore) SetTokenInfo(info TokenInfo) error {
+	return s.exec(`INSERT INTO token_infos (address, chain_id, name, symbol, decimals, logo_uri, tags, verified, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (address) DO UPDATE SET chain_id = excluded.chain_id, name = excluded.name,
+			symbol = excluded.symbol, decimals = excluded.decimals, logo_uri = excluded.logo_uri,
+			tags = excluded.tags, verified = excluded.verified, source = excluded.source`,
+		strings.ToLower(info.Address), info.ChainID, info.Name, info.Symbol, info.Decimals,
+		info.LogoURI, joinTags(info.Tags), info.Verified, info.Source)
+}
+
+func (s *SQLStore) Close() {
+	s.db.Close()
+}
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/xueqianLu/routegen/graph"
+	"github.com/xueqianLu/routegen/types"
+	"github.com/zhihu/norm"
+)
+
+const (
+	DriverNebula   = "nebula"
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+	DriverBolt     = "bolt"
+)
+
+// Store is the storage of the token graph, the import, query, dump and the service
+// run on any of the implementations.
+type Store interface {
+	// Prepare creates or migrates the schema to the latest version.
+	Prepare() error
+	InsertToken(name string, address string) error
+	// InsertPair inserts or overwrites the pair edge from token0 to token1.
+	InsertPair(dexname string, pairaddr string, fee string, tracked string, token0, token1 string, reserves *contracts.PairReserves) error
+	// RebuildIndexes makes the imported data visible to the lookups.
+	RebuildIndexes() error
+	// QueryRoutes finds the cycle free routes from token0 to token1 in at most maxSteps steps,
+	// 0 for the default limit, over the pairs with tracked liquidity above minTracked.
+	QueryRoutes(token0, token1 string, maxSteps int, minTracked float64) ([]*types.TokenRoute, error)
+	// Tokens returns all the tokens.
+	Tokens() ([]TokenRecord, error)
+	// Pairs returns all the pair edges, a pool has an edge in each direction.
+	Pairs() ([]PairRecord, error)
+	// TokenPairs returns the pair edges from the token.
+	TokenPairs(token string) ([]PairRecord, error)
+	// PairEdges returns the edges of the pair address, both directions of a pool.
+	PairEdges(pair string) ([]PairRecord, error)
+	// GetMeta returns the value of the meta key, an empty string if it is not set.
+	GetMeta(key string) (string, error)
+	SetMeta(key string, value string) error
+	// TokenRisks returns the risk flags of the tokens.
+	TokenRisks() ([]TokenRisk, error)
+	// SetTokenRisk sets the risk flag of the token, an empty flag clears it.
+	SetTokenRisk(risk TokenRisk) error
+	// TokenInfos returns the token list metadata of the tokens.
+	TokenInfos() ([]TokenInfo, error)
+	// SetTokenInfo inserts or overwrites the token list metadata of the token.
+	SetTokenInfo(info TokenInfo) error
+	Close()
+}
+
+// TokenRecord is a token with all its props.
+type TokenRecord struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+// PairRecord is a pair edge from Src to Dst with all its props.
+type PairRecord struct {
+	Src        string  `json:"src"`
+	Dst        string  `json:"dst"`
+	Dex        string  `json:"dex"`
+	Pair       string  `json:"pair"`
+	Fee        int64   `json:"fee"`
+	Tracked    float64 `json:"tracked"`
+	TrackedRaw string  `json:"tracked_raw"`
+	Token0     string  `json:"token0"`
+	Token1     string  `json:"token1"`
+	Reserve0   string  `json:"reserve0,omitempty"`
+	Reserve1   string  `json:"reserve1,omitempty"`
+	Block      int64   `json:"block,omitempty"`
+}
+
+// Reserves returns the reserves of the edge, nil if the pair has no reserves.
+func (p *PairRecord) Reserves() (*contracts.PairReserves, error) {
+	return contracts.ParsePairReserves(p.Reserve0, p.Reserve1, uint64(p.Block))
+}
+
+// TrackedString returns the tracked value as it was imported.
+func (p *PairRecord) TrackedString() string {
+	if len(p.TrackedRaw) > 0 {
+		return p.TrackedRaw
+	}
+	return strconv.FormatFloat(p.Tracked, 'f', -1, 64)
+}
+
+// Edge returns the pair edge for the in memory graph.
+func (p *PairRecord) Edge() *graph.Edge {
+	return &graph.Edge{
+		Src:     p.Src,
+		Dst:     p.Dst,
+		Tracked: p.Tracked,
+		Pair: types.RoutePairInfo{
+			Pair:     p.Pair,
+			Fee:      strconv.FormatInt(p.Fee, 10),
+			Dex:      p.Dex,
+			Tracked:  p.TrackedString(),
+			Token0:   p.Token0,
+			Reserve0: p.Reserve0,
+			Reserve1: p.Reserve1,
+			Block:    p.Block,
+		},
+	}
+}
+
+// InsertInto writes the pair edge to the store.
+func (p *PairRecord) InsertInto(store Store) error {
+	reserves, err := p.Reserves()
+	if err != nil {
+		return err
+	}
+	return store.InsertPair(p.Dex, p.Pair, strconv.FormatInt(p.Fee, 10), p.TrackedString(), p.Src, p.Dst, reserves)
+}
+
+// pairRecordOf converts the nebula pair edge to a PairRecord.
+func pairRecordOf(pair *models.Pair) PairRecord {
+	return PairRecord{
+		Src:        fmt.Sprint(pair.Src),
+		Dst:        fmt.Sprint(pair.Dst),
+		Dex:        pair.DexName,
+		Pair:       pair.PairAddress,
+		Fee:        pair.Fee,
+		Tracked:    pair.TrackedVolume,
+		TrackedRaw: pair.TrackedRaw,
+		Token0:     pair.Token0,
+		Token1:     pair.Token1,
+		Reserve0:   pair.Reserve0,
+		Reserve1:   pair.Reserve1,
+		Block:      pair.Block,
+	}
+}
+
+func pairRecordsOf(pairs []*models.Pair) []PairRecord {
+	records := make([]PairRecord, 0, len(pairs))
+	for _, pair := range pairs {
+		records = append(records, pairRecordOf(pair))
+	}
+	return records
+}
+
+// Batch runs fn with a store whose writes are committed together, a bolt store writes
+// them in one transaction, the other stores write each record on its own.
+func Batch(store Store, fn func(store Store) error) error {
+	if bolt, ok := store.(*BoltStore); ok {
+		return bolt.Batch(fn)
+	}
+	return fn(store)
+}
+
+// LoadGraph reads all the tokens and pairs of the store into an in memory graph.
+func LoadGraph(store Store) (*graph.Graph, error) {
+	if bolt, ok := store.(*BoltStore); ok {
+		return bolt.Graph()
+	}
+	tokens, err := store.Tokens()
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := store.Pairs()
+	if err != nil {
+		return nil, err
+	}
+	g := graph.New()
+	for _, token := range tokens {
+		g.AddToken(token.Address, token.Name)
+	}
+	for i := range pairs {
+		g.AddEdge(pairs[i].Edge())
+	}
+	return g, nil
+}
+
+// OpenStore opens the store of db_driver, nebula is the default.
+func OpenStore(conf *config.Config) (Store, error) {
+	switch conf.DbDriver {
+	case "", DriverNebula:
+		space, err := ActiveSpace(conf)
+		if err != nil {
+			return nil, err
+		}
+		return OpenNebulaStore(conf, space)
+	case DriverSQLite, DriverPostgres:
+		return OpenSQLStore(conf.DbDriver, conf.DbDSN)
+	case DriverBolt:
+		return OpenBoltStore(conf.DbDSN)
+	default:
+		return nil, fmt.Errorf("unknown db driver (%s)", conf.DbDriver)
+	}
+}
+
+// IsNebula tells whether the configured store is nebula, the space and schema commands only work on it.
+func IsNebula(conf *config.Config) bool {
+	return len(conf.DbDriver) == 0 || conf.DbDriver == DriverNebula
+}
+
+// NebulaStore is the Store on a nebula space.
+type NebulaStore struct {
+	db        *norm.DB
+	heartbeat time.Duration
+}
+
+// NewNebulaStore wraps db into a Store.
+func NewNebulaStore(db *norm.DB, heartbeat time.Duration) *NebulaStore {
+	return &NebulaStore{db: db, heartbeat: heartbeat}
+}
+
+// OpenNebulaStore connects to the space.
+func OpenNebulaStore(conf *config.Config, space string) (*NebulaStore, error) {
+	db, err := NewDbForSpace(conf, space)
+	if err != nil {
+		return nil, err
+	}
+	return NewNebulaStore(db, time.Duration(conf.DbHeartbeat)*time.Second), nil
+}
+
+// DB returns the nebula connection, for the nebula only features.
+func (s *NebulaStore) DB() *norm.DB {
+	return s.db
+}
+
+func (s *NebulaStore) Prepare() error {
+	return NewMigrator(s.db, s.heartbeat).Migrate(LatestVersion())
+}
+
+func (s *NebulaStore) InsertToken(name string, address string) error {
+	return InsertToken(s.db, name, address)
+}
+
+func (s *NebulaStore) InsertPair(dexname string, pairaddr string, fee string, tracked string, token0, token1 string, reserves *contracts.PairReserves) error {
+	return InsertPair(s.db, dexname, pairaddr, fee, tracked, token0, token1, reserves)
+}
+
+func (s *NebulaStore) RebuildIndexes() error {
+	return RebuildIndexes(s.db)
+}
+
+func (s *NebulaStore) QueryRoutes(token0, token1 string, maxSteps int, minTracked float64) ([]*types.TokenRoute, error) {
+	return QueryRouteWhere(s.db, token0, token1, maxSteps, MinTrackedFilter(minTracked))
+}
+
+func (s *NebulaStore) Tokens() ([]TokenRecord, error) {
+	tokens, err := ScanTokens(s.db)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]TokenRecord, 0, len(tokens))
+	for _, token := range tokens {
+		records = append(records, TokenRecord{Address: token.Address, Name: token.Name})
+	}
+	return records, nil
+}
+
+func (s *NebulaStore) Pairs() ([]PairRecord, error) {
+	pairs, err := ScanPairs(s.db)
+	if err != nil {
+		return nil, err
+	}
+	return pairRecordsOf(pairs), nil
+}
+
+func (s *NebulaStore) TokenPairs(token string) ([]PairRecord, error) {
+	pairs, err := FindTokenPairs(s.db, token)
+	if err != nil {
+		return nil, err
+	}
+	return pairRecordsOf(pairs), nil
+}
+
+func (s *NebulaStore) PairEdges(pair string) ([]PairRecord, error) {
+	pairs, err := FindPair(s.db, pair)
+	if err != nil {
+		return nil, err
+	}
+	return pairRecordsOf(pairs), nil
+}
+
+func (s *NebulaStore) GetMeta(key string) (string, error) {
+	return GetMeta(s.db, key)
+}
+
+func (s *NebulaStore) SetMeta(key string, value string) error {
+	return SetMeta(s.db, key, value)
+}
+
+func (s *NebulaStore) TokenRisks() ([]TokenRisk, error) {
+	return ScanTokenRisks(s.db)
+}
+
+func (s *NebulaStore) SetTokenRisk(risk TokenRisk) error {
+	return SetTokenRisk(s.db, risk)
+}
+
+func (s *NebulaStore) TokenInfos() ([]TokenInfo, error) {
+	return ScanTokenInfos(s.db)
+}
+
+func (s *NebulaStore) SetTokenInfo(info TokenInfo) error {
+	return SetTokenInfo(s.db, info)
+}
+
+func (s *NebulaStore) Close() {
+	s.db.Close()
+}
@@ -0,0 +1,434 @@
+package database
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/types"
+)
+
+const (
+	tokenA = "0x000000000000000000000000000000000000000a"
+	// tokenB is stored in upper case, the lookups have to match it in any case.
+	tokenB = "0x000000000000000000000000000000000000000B"
+	tokenC = "0x000000000000000000000000000000000000000c"
+	tokenD = "0x000000000000000000000000000000000000000d"
+
+	pairAB = "0x00000000000000000000000000000000000000F1"
+	pairBC = "0x00000000000000000000000000000000000000f2"
+	pairAC = "0x00000000000000000000000000000000000000f3"
+	pairCD = "0x00000000000000000000000000000000000000f4"
+)
+
+type testPool struct {
+	dex, pair, fee, tracked string
+	token0, token1          string
+	reserves                *contracts.PairReserves
+}
+
+var testPools = []testPool{
+	{dex: "dex1", pair: pairAB, fee: "30", tracked: "100", token0: tokenA, token1: tokenB,
+		reserves: &contracts.PairReserves{Reserve0: big.NewInt(1000), Reserve1: big.NewInt(2000), Block: 7}},
+	{dex: "dex1", pair: pairBC, fee: "30", tracked: "200", token0: tokenB, token1: tokenC},
+	{dex: "dex2", pair: pairAC, fee: "5", tracked: "5", token0: tokenA, token1: tokenC},
+	{dex: "dex1", pair: pairCD, fee: "30", tracked: "50.5", token0: tokenC, token1: tokenD},
+}
+
+// storeFactory opens an empty store of one implementation.
+type storeFactory struct {
+	open func(t *testing.T) Store
+	// exactCase is set for the stores that match the addresses in the case they are
+	// stored, like the vertex ids of nebula.
+	exactCase bool
+}
+
+// storeFactories are the stores the conformance tests run on, the stores that need a
+// server are added by store_server_test.go when the server is given.
+var storeFactories = map[string]storeFactory{
+	"sqlite": {open: func(t *testing.T) Store {
+		store, err := OpenSQLStore(DriverSQLite, filepath.Join(t.TempDir(), "routes.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}},
+	"bolt": {open: func(t *testing.T) Store {
+		store, err := OpenBoltStore(filepath.Join(t.TempDir(), "routes.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}},
+}
+
+// openTestStore opens the store and imports the test pools in both directions, as the
+// import command does.
+func openTestStore(t *testing.T, open func(t *testing.T) Store) Store {
+	store := open(t)
+	t.Cleanup(store.Close)
+	if err := store.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	for i, token := range []string{tokenA, tokenB, tokenC, tokenD} {
+		if err := store.InsertToken("token"+string(rune('A'+i)), token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range testPools {
+		if err := store.InsertPair(p.dex, p.pair, p.fee, p.tracked, p.token0, p.token1, p.reserves); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.InsertPair(p.dex, p.pair, p.fee, p.tracked, p.token1, p.token0, p.reserves.Reverse()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.RebuildIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// upper changes the hex digits of the address to upper case.
+func upper(address string) string {
+	return "0x" + strings.ToUpper(address[2:])
+}
+
+// routeSignature is the tokens and the pairs of the route, like "a>b>c|p1,p2".
+func routeSignature(route *types.TokenRoute) string {
+	tokens := []string{route.Steps[0].Src}
+	pairs := make([]string, 0, len(route.Steps))
+	for _, step := range route.Steps {
+		tokens = append(tokens, step.Dst)
+		for _, pair := range step.Pairs {
+			pairs = append(pairs, pair.Pair)
+		}
+	}
+	return strings.Join(tokens, ">") + "|" + strings.Join(pairs, ",")
+}
+
+func signatures(routes []*types.TokenRoute) []string {
+	sigs := make([]string, 0, len(routes))
+	for _, route := range routes {
+		sigs = append(sigs, routeSignature(route))
+	}
+	sort.Strings(sigs)
+	return sigs
+}
+
+func sortRecords(pairs []PairRecord) {
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairKey(pairs[i].Src, pairs[i].Dst, pairs[i].Dex, pairs[i].Pair) <
+			pairKey(pairs[j].Src, pairs[j].Dst, pairs[j].Dex, pairs[j].Pair)
+	})
+}
+
+// expectedRecords are the pair edges of the test pools from src, all of them if src is empty.
+func expectedRecords(src string) []PairRecord {
+	records := make([]PairRecord, 0)
+	for _, p := range testPools {
+		for _, reverse := range []bool{false, true} {
+			token0, token1, reserves := p.token0, p.token1, p.reserves
+			if reverse {
+				token0, token1, reserves = p.token1, p.token0, reserves.Reverse()
+			}
+			if len(src) > 0 && !strings.EqualFold(src, token0) {
+				continue
+			}
+			record := PairRecord{Src: token0, Dst: token1, Dex: p.dex, Pair: p.pair, Fee: mustParseFee(p.fee),
+				Tracked: parseTracked(p.tracked), TrackedRaw: p.tracked, Token0: token0, Token1: token1}
+			if reserves != nil {
+				record.Reserve0, record.Reserve1, record.Block = reserves.Reserve0.String(), reserves.Reserve1.String(), int64(reserves.Block)
+			}
+			records = append(records, record)
+		}
+	}
+	sortRecords(records)
+	return records
+}
+
+func mustParseFee(fee string) int64 {
+	v, err := parseFee(fee)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestStoreQueryRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		src, dst   string
+		maxSteps   int
+		minTracked float64
+		// anyCase queries the tokens in another case than they are stored.
+		anyCase bool
+		want    []string
+	}{
+		{
+			name: "all hops",
+			src:  tokenA, dst: tokenC,
+			want: []string{
+				tokenA + ">" + tokenB + ">" + tokenC + "|" + pairAB + "," + pairBC,
+				tokenA + ">" + tokenC + "|" + pairAC,
+			},
+		},
+		{
+			name: "any case",
+			src:  upper(tokenA), dst: strings.ToLower(tokenC), anyCase: true,
+			want: []string{
+				tokenA + ">" + tokenB + ">" + tokenC + "|" + pairAB + "," + pairBC,
+				tokenA + ">" + tokenC + "|" + pairAC,
+			},
+		},
+		{
+			name: "to the upper case token",
+			src:  tokenC, dst: strings.ToLower(tokenB), anyCase: true,
+			want: []string{
+				tokenC + ">" + tokenA + ">" + tokenB + "|" + pairAC + "," + pairAB,
+				tokenC + ">" + tokenB + "|" + pairBC,
+			},
+		},
+		{
+			name: "three hops",
+			src:  tokenA, dst: tokenD,
+			want: []string{
+				tokenA + ">" + tokenB + ">" + tokenC + ">" + tokenD + "|" + pairAB + "," + pairBC + "," + pairCD,
+				tokenA + ">" + tokenC + ">" + tokenD + "|" + pairAC + "," + pairCD,
+			},
+		},
+		{
+			name: "hop bound",
+			src:  tokenA, dst: tokenD, maxSteps: 2,
+			want: []string{tokenA + ">" + tokenC + ">" + tokenD + "|" + pairAC + "," + pairCD},
+		},
+		{
+			name: "one hop",
+			src:  tokenD, dst: tokenA, maxSteps: 1,
+			want: []string{},
+		},
+		{
+			name: "min tracked",
+			src:  tokenA, dst: tokenD, minTracked: 10,
+			want: []string{tokenA + ">" + tokenB + ">" + tokenC + ">" + tokenD + "|" + pairAB + "," + pairBC + "," + pairCD},
+		},
+		{
+			name: "min tracked and hop bound",
+			src:  tokenA, dst: tokenD, maxSteps: 2, minTracked: 10,
+			want: []string{},
+		},
+		{
+			name: "unknown token",
+			src:  tokenA, dst: "0x00000000000000000000000000000000000000ee",
+			want: []string{},
+		},
+	}
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			store := openTestStore(t, factory.open)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					if tt.anyCase && factory.exactCase {
+						t.Skip("the store matches the addresses in their stored case")
+					}
+					routes, err := store.QueryRoutes(tt.src, tt.dst, tt.maxSteps, tt.minTracked)
+					if err != nil {
+						t.Fatal(err)
+					}
+					sort.Strings(tt.want)
+					if got := signatures(routes); !reflect.DeepEqual(got, tt.want) {
+						t.Fatalf("got routes %v, want %v", got, tt.want)
+					}
+					for _, route := range routes {
+						// the walk never visits a token twice, the pools go both ways.
+						seen := map[string]bool{strings.ToLower(route.Steps[0].Src): true}
+						for i, step := range route.Steps {
+							if i > 0 && step.Src != route.Steps[i-1].Dst {
+								t.Fatalf("route %s is not connected", routeSignature(route))
+							}
+							if seen[strings.ToLower(step.Dst)] {
+								t.Fatalf("route %s has a cycle", routeSignature(route))
+							}
+							seen[strings.ToLower(step.Dst)] = true
+						}
+					}
+				})
+			}
+
+			routes, err := store.QueryRoutes(tokenA, tokenB, 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(routes) != 1 {
+				t.Fatalf("got %d routes from A to B in one hop", len(routes))
+			}
+			info := routes[0].Steps[0].Pairs[0]
+			want := types.RoutePairInfo{Pair: pairAB, Fee: "30", Dex: "dex1", Tracked: "100", Token0: tokenA,
+				Reserve0: "1000", Reserve1: "2000", Block: 7}
+			if info != want {
+				t.Fatalf("got pair info %+v, want %+v", info, want)
+			}
+		})
+	}
+}
+
+func TestStoreRecords(t *testing.T) {
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			store := openTestStore(t, factory.open)
+
+			tokens, err := store.Tokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(tokens, func(i, j int) bool {
+				return strings.ToLower(tokens[i].Address) < strings.ToLower(tokens[j].Address)
+			})
+			wantTokens := []TokenRecord{{tokenA, "tokenA"}, {tokenB, "tokenB"}, {tokenC, "tokenC"}, {tokenD, "tokenD"}}
+			if !reflect.DeepEqual(tokens, wantTokens) {
+				t.Fatalf("got tokens %+v, want %+v", tokens, wantTokens)
+			}
+			// a token inserted again keeps one record with the new name.
+			if err = store.InsertToken("renamed", tokenD); err != nil {
+				t.Fatal(err)
+			}
+			if tokens, err = store.Tokens(); err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != 4 {
+				t.Fatalf("got %d tokens after the update", len(tokens))
+			}
+
+			pairs, err := store.Pairs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sortRecords(pairs)
+			if want := expectedRecords(""); !reflect.DeepEqual(pairs, want) {
+				t.Fatalf("got pairs %+v, want %+v", pairs, want)
+			}
+
+			// the lookups match the addresses in any case, unless the store is exact case.
+			lookupTokens, lookupPairs := []string{tokenB, tokenC}, []string{pairAB, pairBC}
+			if !factory.exactCase {
+				lookupTokens = append(lookupTokens, strings.ToLower(tokenB), upper(tokenC))
+				lookupPairs = append(lookupPairs, strings.ToLower(pairAB), upper(pairBC))
+			}
+			for _, token := range lookupTokens {
+				pairs, err = store.TokenPairs(token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sortRecords(pairs)
+				if want := expectedRecords(token); !reflect.DeepEqual(pairs, want) {
+					t.Fatalf("got pairs of %s %+v, want %+v", token, pairs, want)
+				}
+			}
+			if pairs, err = store.TokenPairs("0x00000000000000000000000000000000000000ee"); err != nil || len(pairs) != 0 {
+				t.Fatalf("got %d pairs of an unknown token, err %v", len(pairs), err)
+			}
+
+			for _, pair := range lookupPairs {
+				pairs, err = store.PairEdges(pair)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(pairs) != 2 || !strings.EqualFold(pairs[0].Pair, pair) || !strings.EqualFold(pairs[1].Pair, pair) ||
+					pairs[0].Src != pairs[1].Dst || pairs[0].Dst != pairs[1].Src {
+					t.Fatalf("got edges of %s %+v, want both directions", pair, pairs)
+				}
+			}
+
+			// an edge inserted again is overwritten.
+			if err = store.InsertPair("dex1", pairCD, "25", "60", tokenC, tokenD, nil); err != nil {
+				t.Fatal(err)
+			}
+			if pairs, err = store.PairEdges(pairCD); err != nil {
+				t.Fatal(err)
+			}
+			sortRecords(pairs)
+			if len(pairs) != 2 || pairs[0].Fee != 25 || pairs[0].Tracked != 60 || pairs[0].TrackedRaw != "60" {
+				t.Fatalf("got edges %+v after the update", pairs)
+			}
+		})
+	}
+}
+
+func TestStoreMeta(t *testing.T) {
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			store := openTestStore(t, factory.open)
+			if value, err := store.GetMeta("conformance"); err != nil || value != "" {
+				t.Fatalf("got %q, %v for an unset key", value, err)
+			}
+			for _, value := range []string{"v1", "v2"} {
+				if err := store.SetMeta("conformance", value); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := store.GetMeta("conformance"); err != nil || got != value {
+					t.Fatalf("got %q, %v, want %q", got, err, value)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreBatch(t *testing.T) {
+	const pairAD = "0x00000000000000000000000000000000000000f5"
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			store := openTestStore(t, factory.open)
+			// load the graph of the bolt store before the batch.
+			if _, err := store.QueryRoutes(tokenA, tokenD, 2, 0); err != nil {
+				t.Fatal(err)
+			}
+			err := Batch(store, func(store Store) error {
+				if err := store.InsertPair("dex1", pairAD, "30", "10", tokenA, tokenD, nil); err != nil {
+					return err
+				}
+				if err := store.InsertPair("dex1", pairAD, "30", "10", tokenD, tokenA, nil); err != nil {
+					return err
+				}
+				if pairs, err := store.PairEdges(pairAD); err != nil || len(pairs) != 2 {
+					t.Fatalf("got edges %+v, %v in the batch", pairs, err)
+				}
+				return store.SetMeta("conformance", "batch")
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = store.RebuildIndexes(); err != nil {
+				t.Fatal(err)
+			}
+			routes, err := store.QueryRoutes(tokenA, tokenD, 1, 0)
+			if err != nil || len(routes) != 1 {
+				t.Fatalf("got routes %v, %v after the batch", signatures(routes), err)
+			}
+			if value, err := store.GetMeta("conformance"); err != nil || value != "batch" {
+				t.Fatalf("got %q, %v after the batch", value, err)
+			}
+		})
+	}
+}
+
+func TestBoltStoreBatchRollback(t *testing.T) {
+	store := openTestStore(t, storeFactories["bolt"].open)
+	failed := errors.New("failed")
+	err := Batch(store, func(store Store) error {
+		if err := store.InsertToken("tokenE", "0x000000000000000000000000000000000000000e"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("got %v, want the error of the batch", err)
+	}
+	if tokens, err := store.Tokens(); err != nil || len(tokens) != 4 {
+		t.Fatalf("got tokens %v, %v, want the batch rolled back", tokens, err)
+	}
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/xueqianLu/routegen/graph"
+)
+
+// maxCandidates is the count of the tokens listed in the error of an ambiguous symbol.
+const maxCandidates = 5
+
+var (
+	ErrUnknownToken    = errors.New("unknown token")
+	ErrAmbiguousSymbol = errors.New("ambiguous token symbol")
+)
+
+// TokenEntry is a token of the index, with its metadata and its place in the graph.
+type TokenEntry struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+	Verified bool   `json:"verified,omitempty"`
+	// Degree is the count of the tokens the token has a pool with.
+	Degree int `json:"degree"`
+	Pools  int `json:"pools"`
+	// Liquidity is the sum of the tracked liquidity of the pools of the token.
+	Liquidity float64 `json:"liquidity"`
+}
+
+// TokenIndex finds the tokens by address, symbol or name. The symbols come from the
+// imported token lists, the names from the token vertices.
+type TokenIndex struct {
+	entries   []TokenEntry // by liquidity, degree and address
+	byAddress map[string]int
+	bySymbol  map[string][]int
+	infos     map[string]TokenInfo
+}
+
+// LoadTokenIndex reads the tokens, the graph and the token infos of the store into an index.
+func LoadTokenIndex(store Store) (*TokenIndex, error) {
+	tokens, err := store.Tokens()
+	if err != nil {
+		return nil, err
+	}
+	g, err := LoadGraph(store)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := store.TokenInfos()
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenIndex(tokens, g, infos), nil
+}
+
+// NewTokenIndex indexes the tokens with their pools in g and their infos, the addresses
+// are kept as stored, and the infos of the unknown tokens are left out.
+func NewTokenIndex(tokens []TokenRecord, g *graph.Graph, infos []TokenInfo) *TokenIndex {
+	entries := make([]TokenEntry, 0, len(tokens))
+	position := make(map[string]int, len(tokens))
+	add := func(address, name string) int {
+		i, exist := position[strings.ToLower(address)]
+		if !exist {
+			i = len(entries)
+			position[strings.ToLower(address)] = i
+			entries = append(entries, TokenEntry{Address: address, Name: name})
+		}
+		return i
+	}
+	for _, token := range tokens {
+		add(token.Address, token.Name)
+	}
+	// a pool counts for both tokens, even if one of its edges is missing.
+	pools := make(map[int]map[string]float64)
+	neighbours := make(map[int]map[int]bool)
+	for _, token := range g.Tokens() {
+		for _, e := range g.Edges(token) {
+			src, dst := add(e.Src, ""), add(e.Dst, "")
+			id := strings.ToLower(e.Pair.Dex + "|" + e.Pair.Pair)
+			for _, end := range [][2]int{{src, dst}, {dst, src}} {
+				if pools[end[0]] == nil {
+					pools[end[0]], neighbours[end[0]] = make(map[string]float64), make(map[int]bool)
+				}
+				if tracked, exist := pools[end[0]][id]; !exist || e.Tracked > tracked {
+					pools[end[0]][id] = e.Tracked
+				}
+				if end[0] != end[1] {
+					neighbours[end[0]][end[1]] = true
+				}
+			}
+		}
+	}
+	for i := range entries {
+		entries[i].Degree = len(neighbours[i])
+		entries[i].Pools = len(pools[i])
+		for _, tracked := range pools[i] {
+			entries[i].Liquidity += tracked
+		}
+	}
+	for _, info := range infos {
+		i, exist := position[strings.ToLower(info.Address)]
+		if !exist {
+			continue
+		}
+		decimals := info.Decimals
+		entries[i].Symbol, entries[i].Decimals, entries[i].Verified = info.Symbol, &decimals, info.Verified
+		if len(entries[i].Name) == 0 {
+			entries[i].Name = info.Name
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		if a.Liquidity != b.Liquidity {
+			return a.Liquidity > b.Liquidity
+		}
+		if a.Degree != b.Degree {
+			return a.Degree > b.Degree
+		}
+		return strings.ToLower(a.Address) < strings.ToLower(b.Address)
+	})
+
+	index := &TokenIndex{
+		entries:   entries,
+		byAddress: make(map[string]int, len(entries)),
+		bySymbol:  make(map[string][]int),
+		infos:     make(map[string]TokenInfo, len(infos)),
+	}
+	for _, info := range infos {
+		if _, exist := position[strings.ToLower(info.Address)]; exist {
+			index.infos[strings.ToLower(info.Address)] = info
+		}
+	}
+	for i, entry := range entries {
+		index.byAddress[strings.ToLower(entry.Address)] = i
+		if len(entry.Symbol) > 0 {
+			symbol := strings.ToLower(entry.Symbol)
+			index.bySymbol[symbol] = append(index.bySymbol[symbol], i)
+		}
+	}
+	return index
+}
+
+// Len returns the count of the tokens.
+func (x *TokenIndex) Len() int {
+	return len(x.entries)
+}
+
+// Get returns the token of the address, and whether it is in the index.
+func (x *TokenIndex) Get(address string) (TokenEntry, bool) {
+	i, exist := x.byAddress[strings.ToLower(address)]
+	if !exist {
+		return TokenEntry{}, false
+	}
+	return x.entries[i], true
+}
+
+// Info returns the token list metadata of the token, and whether it has one.
+func (x *TokenIndex) Info(address string) (TokenInfo, bool) {
+	info, exist := x.infos[strings.ToLower(address)]
+	return info, exist
+}
+
+// Search returns at most limit tokens matching q. An address matches its token, else the
+// tokens with q as symbol come first, then the symbols and names containing q, then the
+// symbols and names close to q, each by liquidity and degree.
+func (x *TokenIndex) Search(q string, limit int) []TokenEntry {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if len(q) == 0 {
+		return []TokenEntry{}
+	}
+	if common.IsHexAddress(q) {
+		if entry, exist := x.Get(q); exist {
+			return []TokenEntry{entry}
+		}
+		return []TokenEntry{}
+	}
+	tiers := make([][]TokenEntry, 3)
+	for _, entry := range x.entries {
+		if rank := matchRank(q, entry); rank >= 0 {
+			tiers[rank] = append(tiers[rank], entry)
+		}
+	}
+	found := make([]TokenEntry, 0, limit)
+	for _, tier := range tiers {
+		for _, entry := range tier {
+			if len(found) == limit {
+				return found
+			}
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// matchRank is the tier of the token in the search of the lower case q, -1 if it does
+// not match.
+func matchRank(q string, entry TokenEntry) int {
+	symbol, name := strings.ToLower(entry.Symbol), strings.ToLower(entry.Name)
+	switch {
+	case symbol == q:
+		return 0
+	case strings.Contains(symbol, q) || strings.Contains(name, q):
+		return 1
+	case fuzzyMatch(q, symbol) || fuzzyMatch(q, name):
+		return 2
+	default:
+		return -1
+	}
+}
+
+// fuzzyMatch tells whether s is close to q: q is a subsequence of s, or q is one edit
+// away from s for the queries of 3 letters or more.
+func fuzzyMatch(q, s string) bool {
+	if len(s) == 0 || len(q) < 2 {
+		return false
+	}
+	j := 0
+	for i := 0; i < len(s) && j < len(q); i++ {
+		if s[i] == q[j] {
+			j++
+		}
+	}
+	if j == len(q) {
+		return true
+	}
+	return len(q) >= 3 && editDistance(q, s, 1) <= 1
+}
+
+// editDistance is the Levenshtein distance of a and b, or max+1 once it is above max.
+func editDistance(a, b string, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j-1]+cost, minInt(prev[j]+1, cur[j-1]+1))
+			best = minInt(best, cur[j])
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Resolve returns the address of token, which is an address or a symbol. An indexed
+// address is returned in its stored case, as the vertex ids of nebula are case sensitive.
+// A symbol resolves if one token has it, or if one of the tokens with it is verified.
+func (x *TokenIndex) Resolve(token string) (string, error) {
+	token = strings.TrimSpace(token)
+	if common.IsHexAddress(token) {
+		if entry, exist := x.Get(token); exist {
+			return entry.Address, nil
+		}
+		return token, nil
+	}
+	matches := x.bySymbol[strings.ToLower(token)]
+	if len(matches) == 0 {
+		return "", fmt.Errorf("%w (%s)", ErrUnknownToken, token)
+	}
+	if len(matches) == 1 {
+		return x.entries[matches[0]].Address, nil
+	}
+	verified := make([]int, 0, 1)
+	for _, i := range matches {
+		if x.entries[i].Verified {
+			verified = append(verified, i)
+		}
+	}
+	if len(verified) == 1 {
+		return x.entries[verified[0]].Address, nil
+	}
+	candidates := make([]string, 0, maxCandidates)
+	for _, i := range matches {
+		if len(candidates) == maxCandidates {
+			break
+		}
+		candidates = append(candidates, x.entries[i].Address)
+	}
+	return "", fmt.Errorf("%w (%s), %d tokens have it: %s", ErrAmbiguousSymbol, token, len(matches),
+		strings.Join(candidates, ", "))
+}
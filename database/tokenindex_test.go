@@ -0,0 +1,124 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xueqianLu/routegen/graph"
+	"github.com/xueqianLu/routegen/types"
+)
+
+const (
+	indexWBNB = "0x0000000000000000000000000000000000000001"
+	// indexUSDT is stored in mixed case.
+	indexUSDT   = "0x00000000000000000000000000000000000000aB"
+	indexUSDT2  = "0x0000000000000000000000000000000000000003"
+	indexCake   = "0x0000000000000000000000000000000000000004"
+	indexCake2  = "0x0000000000000000000000000000000000000005"
+	indexCaker  = "0x0000000000000000000000000000000000000006"
+	indexPie    = "0x0000000000000000000000000000000000000007"
+	indexCamke  = "0x0000000000000000000000000000000000000008"
+	indexAbsent = "0x00000000000000000000000000000000000000ee"
+)
+
+// testIndex has a unique symbol, a symbol of two tokens with one verified, an ambiguous
+// symbol, and tokens matching "cake" by symbol, name and subsequence.
+func testIndex() *TokenIndex {
+	tokens := []TokenRecord{
+		{indexWBNB, "Wrapped BNB"}, {indexUSDT, "Tether USD"}, {indexUSDT2, "Fake Tether"},
+		{indexCake, "PancakeSwap Token"}, {indexCake2, "Cake Fork"}, {indexCaker, "Caker"},
+		{indexPie, "Cakepie"}, {indexCamke, "Camke"},
+	}
+	infos := []TokenInfo{
+		{Address: indexWBNB, Symbol: "WBNB", Verified: true},
+		{Address: indexUSDT, Symbol: "USDT", Verified: true},
+		{Address: indexUSDT2, Symbol: "USDT"},
+		{Address: indexCake, Symbol: "CAKE"},
+		{Address: indexCake2, Symbol: "CAKE"},
+		{Address: indexCaker, Symbol: "CAKER"},
+		{Address: indexCamke, Symbol: "CAMKE"},
+	}
+	g := graph.New()
+	pools := []struct {
+		a, b, pair string
+		tracked    float64
+	}{
+		{indexCake, indexWBNB, "0x00000000000000000000000000000000000000f1", 10},
+		{indexCake2, indexWBNB, "0x00000000000000000000000000000000000000f2", 100},
+	}
+	for _, p := range pools {
+		for _, e := range [][2]string{{p.a, p.b}, {p.b, p.a}} {
+			g.AddEdge(&graph.Edge{Src: e[0], Dst: e[1], Tracked: p.tracked,
+				Pair: types.RoutePairInfo{Dex: "dex", Pair: p.pair}})
+		}
+	}
+	return NewTokenIndex(tokens, g, infos)
+}
+
+func TestTokenIndexResolve(t *testing.T) {
+	index := testIndex()
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{name: "unique symbol", token: "WBNB", want: indexWBNB},
+		{name: "symbol in any case", token: " wbnb ", want: indexWBNB},
+		{name: "verified among duplicates", token: "usdt", want: indexUSDT},
+		{name: "ambiguous symbol", token: "CAKE", wantErr: ErrAmbiguousSymbol},
+		{name: "unknown symbol", token: "NOPE", wantErr: ErrUnknownToken},
+		{name: "address", token: indexCake, want: indexCake},
+		{name: "address in stored case", token: strings.ToLower(indexUSDT), want: indexUSDT},
+		{name: "unindexed address", token: indexAbsent, want: indexAbsent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := index.Resolve(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	_, err := index.Resolve("cake")
+	if err == nil || !strings.Contains(err.Error(), indexCake) || !strings.Contains(err.Error(), indexCake2) {
+		t.Fatalf("the ambiguous symbol error should list the candidates, got %v", err)
+	}
+}
+
+func TestTokenIndexSearch(t *testing.T) {
+	index := testIndex()
+	tests := []struct {
+		name  string
+		q     string
+		limit int
+		want  []string
+	}{
+		// the exact symbols by liquidity, then the symbols and names containing q by
+		// address, then the subsequences.
+		{name: "tiers", q: "cake", limit: 10, want: []string{indexCake2, indexCake, indexCaker, indexPie, indexCamke}},
+		{name: "limit", q: "CAKE", limit: 3, want: []string{indexCake2, indexCake, indexCaker}},
+		{name: "name", q: "tether", limit: 10, want: []string{indexUSDT2, indexUSDT}},
+		{name: "one edit", q: "wbnc", limit: 10, want: []string{indexWBNB}},
+		{name: "address", q: strings.ToLower(indexUSDT), limit: 10, want: []string{indexUSDT}},
+		{name: "unindexed address", q: indexAbsent, limit: 10, want: []string{}},
+		{name: "empty", q: "  ", limit: 10, want: []string{}},
+		{name: "no match", q: "zzzz", limit: 10, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, entry := range index.Search(tt.q, tt.limit) {
+				got = append(got, entry.Address)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/xueqianLu/routegen/database/models"
+	"github.com/xueqianLu/routegen/types"
+	"github.com/zhihu/norm"
+)
+
+// TokenInfo is the metadata of a token from a token list, Source is the name of the list.
+// A verified token is one of a list imported as trusted, the verified only routes go
+// through these tokens only.
+type TokenInfo struct {
+	Address  string   `json:"address"`
+	ChainID  int64    `json:"chain_id,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Symbol   string   `json:"symbol,omitempty"`
+	Decimals int      `json:"decimals"`
+	LogoURI  string   `json:"logo_uri,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Verified bool     `json:"verified,omitempty"`
+	Source   string   `json:"source,omitempty"`
+}
+
+// VerifiedSet is the lower case addresses of the verified tokens.
+type VerifiedSet map[string]bool
+
+// LoadVerifiedSet reads the verified tokens of the store.
+func LoadVerifiedSet(store Store) (VerifiedSet, error) {
+	infos, err := store.TokenInfos()
+	if err != nil {
+		return nil, err
+	}
+	set := make(VerifiedSet)
+	for _, info := range infos {
+		if info.Verified {
+			set[strings.ToLower(info.Address)] = true
+		}
+	}
+	return set, nil
+}
+
+// Verified tells whether the token is verified.
+func (s VerifiedSet) Verified(token string) bool {
+	return s[strings.ToLower(token)]
+}
+
+// RouteVerified tells whether all the tokens of the route are verified, the source and
+// the destination included.
+func (s VerifiedSet) RouteVerified(route *types.TokenRoute) bool {
+	for _, step := range route.Steps {
+		if !s.Verified(step.Src) || !s.Verified(step.Dst) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterRoutes returns the routes through the verified tokens only.
+func (s VerifiedSet) FilterRoutes(routes []*types.TokenRoute) []*types.TokenRoute {
+	filtered := make([]*types.TokenRoute, 0, len(routes))
+	for _, route := range routes {
+		if s.RouteVerified(route) {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
+}
+
+// sortInfos orders the token infos by the lower case address.
+func sortInfos(infos []TokenInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return strings.ToLower(infos[i].Address) < strings.ToLower(infos[j].Address)
+	})
+}
+
+// joinTags keeps the tags in one string prop or column.
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+func splitTags(tags string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// ScanTokenInfos returns the token_info tags in the space.
+func ScanTokenInfos(db *norm.DB) ([]TokenInfo, error) {
+	res, err := db.Execute("LOOKUP ON token_info YIELD id(vertex) AS address, " +
+		"properties(vertex).chain_id AS chain_id, properties(vertex).name AS name, " +
+		"properties(vertex).symbol AS symbol, properties(vertex).decimals AS decimals, " +
+		"properties(vertex).logo_uri AS logo_uri, properties(vertex).tags AS tags, " +
+		"properties(vertex).verified AS verified, properties(vertex).source AS source")
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]TokenInfo, 0, res.GetRowSize())
+	for _, row := range res.GetRows() {
+		values := row.GetValues()
+		address, err := decodeVid(values[0])
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, TokenInfo{
+			Address:  address,
+			ChainID:  values[1].GetIVal(),
+			Name:     propString(values[2]),
+			Symbol:   propString(values[3]),
+			Decimals: int(values[4].GetIVal()),
+			LogoURI:  propString(values[5]),
+			Tags:     splitTags(propString(values[6])),
+			Verified: values[7].GetBVal(),
+			Source:   propString(values[8]),
+		})
+	}
+	sortInfos(infos)
+	return infos, nil
+}
+
+// SetTokenInfo inserts or overwrites the token_info tag of the token.
+func SetTokenInfo(db *norm.DB, info TokenInfo) error {
+	return db.InsertVertex(&models.TokenInfo{
+		Address:  info.Address,
+		ChainID:  info.ChainID,
+		Name:     info.Name,
+		Symbol:   info.Symbol,
+		Decimals: int64(info.Decimals),
+		LogoURI:  info.LogoURI,
+		Tags:     joinTags(info.Tags),
+		Verified: info.Verified,
+		Source:   info.Source,
+	})
+}
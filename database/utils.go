@@ -1,8 +1,8 @@
 package database
 
 import (
+	"fmt"
 	"reflect"
-	"time"
 
 	nebula_type "github.com/vesoft-inc/nebula-go/v3/nebula"
 	"github.com/zhihu/norm/constants"
@@ -23,26 +23,8 @@ func getStructFieldTagMap(typ reflect.Type) map[string]int {
 
 // setFieldValue 将 nvalue 的值设置到 struct.field 上, 并自动转换类型
 func setFieldValue(tag string, field reflect.Value, nValue *nebula_type.Value) error {
-	switch field.Kind() {
-	case reflect.Bool:
-		field.SetBool(nValue.GetBVal())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		field.SetInt(nValue.GetIVal())
-	case reflect.Float32, reflect.Float64:
-		field.SetFloat(nValue.GetFVal())
-	case reflect.String:
-		field.SetString(string(nValue.GetSVal()))
-	case reflect.Struct:
-		switch field.Type().String() {
-		case "time.Time":
-			ts := nValue.GetIVal()
-			field.Set(reflect.ValueOf(time.Unix(ts, 0)))
-		default:
-			//fmt.Printf("debug: type[%v] mapping not implement\n", field.Type().String())
-		}
-	default:
-		//fmt.Printf("debug: type[%v] mapping not implement\n", field.Type().String())
-		return nil
+	if err := decodeValue(nValue, field); err != nil {
+		return fmt.Errorf("set field %s failed: %w", tag, err)
 	}
 	return nil
 }
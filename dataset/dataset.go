@@ -0,0 +1,42 @@
+package dataset
+
+// ImportToken is a token of a pair in a pair file.
+type ImportToken struct {
+	Address string `json:"id"`
+	Name    string `json:"name"`
+}
+
+// ImportPairInfo is a pair in a pair file, as exported from the dex subgraph.
+type ImportPairInfo struct {
+	Address      string      `json:"id"`
+	Name         string      `json:"name"`
+	TrackedValue string      `json:"trackedReserveBNB"`
+	Token0       ImportToken `json:"token0"`
+	Token1       ImportToken `json:"token1"`
+}
+
+type ImportPairs struct {
+	Pairs []ImportPairInfo `json:"pairs"`
+}
+
+// ImportData is a pair file, the pairs of one dex with its fee in basis points.
+type ImportData struct {
+	Name string      `json:"name"`
+	Fee  string      `json:"fee"`
+	Data ImportPairs `json:"data"`
+}
+
+// DexListPair is a pair of a dex list file.
+type DexListPair struct {
+	Contract string `json:"contract"`
+	Token0   string `json:"token0"`
+	Token1   string `json:"token1"`
+}
+
+// DexListEntry is an entry of a dex list file, like data/dexlist.json.
+type DexListEntry struct {
+	Dex     string        `json:"dex"`
+	Factory string        `json:"factory"`
+	Fee     string        `json:"fee"`
+	Pairs   []DexListPair `json:"pairs"`
+}
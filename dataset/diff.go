@@ -0,0 +1,314 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/service/param"
+)
+
+const (
+	PlanUpsert = "upsert"
+	PlanDelete = "delete"
+)
+
+// Pool is a pair of a dataset, Token0 is the lower token address and the reserves are
+// the reserves of Token0 and Token1.
+type Pool struct {
+	Dex        string  `json:"dex"`
+	Pair       string  `json:"pair"`
+	Token0     string  `json:"token0"`
+	Token1     string  `json:"token1"`
+	Fee        int64   `json:"fee"`
+	Tracked    float64 `json:"tracked"`
+	TrackedRaw string  `json:"tracked_raw"`
+	Reserve0   string  `json:"reserve0,omitempty"`
+	Reserve1   string  `json:"reserve1,omitempty"`
+	Block      int64   `json:"block,omitempty"`
+}
+
+func (p *Pool) id() string {
+	return strings.ToLower(p.Dex + "|" + p.Pair)
+}
+
+// sameState tells whether the pools have the same tokens, fee, liquidity and reserves.
+func (p *Pool) sameState(o *Pool) bool {
+	return p.Token0 == o.Token0 && p.Token1 == o.Token1 && p.Fee == o.Fee && p.Tracked == o.Tracked &&
+		p.Reserve0 == o.Reserve0 && p.Reserve1 == o.Reserve1
+}
+
+// Dataset is the tokens and pools of pair files, a snapshot or a store.
+type Dataset struct {
+	Tokens map[string]string // lower case address to name
+	Pools  map[string]*Pool  // keyed by the lower case dex and pair address
+}
+
+func NewDataset() *Dataset {
+	return &Dataset{Tokens: make(map[string]string), Pools: make(map[string]*Pool)}
+}
+
+// AddToken adds the token, a known name is not overwritten by an empty one.
+func (d *Dataset) AddToken(address, name string) {
+	address = strings.ToLower(address)
+	if _, exist := d.Tokens[address]; !exist || len(name) > 0 {
+		d.Tokens[address] = name
+	}
+}
+
+// AddPool adds the pool, the tokens are sorted and the reserves are swapped with them.
+func (d *Dataset) AddPool(p *Pool) {
+	p.Token0, p.Token1 = strings.ToLower(p.Token0), strings.ToLower(p.Token1)
+	if p.Token0 > p.Token1 {
+		p.Token0, p.Token1 = p.Token1, p.Token0
+		p.Reserve0, p.Reserve1 = p.Reserve1, p.Reserve0
+	}
+	d.AddToken(p.Token0, "")
+	d.AddToken(p.Token1, "")
+	d.Pools[p.id()] = p
+}
+
+// AddPairFile adds the pools of the pair file.
+func (d *Dataset) AddPairFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file ImportData
+	if err = json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	fee, _ := strconv.ParseInt(strings.TrimSpace(file.Fee), 10, 64)
+	for _, pair := range file.Data.Pairs {
+		tracked, _ := strconv.ParseFloat(strings.TrimSpace(pair.TrackedValue), 64)
+		d.AddToken(pair.Token0.Address, pair.Token0.Name)
+		d.AddToken(pair.Token1.Address, pair.Token1.Name)
+		d.AddPool(&Pool{
+			Dex:        file.Name,
+			Pair:       pair.Address,
+			Token0:     pair.Token0.Address,
+			Token1:     pair.Token1.Address,
+			Fee:        fee,
+			Tracked:    tracked,
+			TrackedRaw: pair.TrackedValue,
+		})
+	}
+	return nil
+}
+
+// AddRecords adds the tokens and the pair edges of a snapshot or a store, a pool is
+// taken from the edge of its lower token, or the reverse edge if that one is missing.
+func (d *Dataset) AddRecords(tokens []database.TokenRecord, pairs []database.PairRecord) {
+	for _, token := range tokens {
+		d.AddToken(token.Address, token.Name)
+	}
+	for _, pair := range pairs {
+		pool := &Pool{
+			Dex:        pair.Dex,
+			Pair:       pair.Pair,
+			Token0:     pair.Src,
+			Token1:     pair.Dst,
+			Fee:        pair.Fee,
+			Tracked:    pair.Tracked,
+			TrackedRaw: pair.TrackedString(),
+			Reserve0:   pair.Reserve0,
+			Reserve1:   pair.Reserve1,
+			Block:      pair.Block,
+		}
+		if _, exist := d.Pools[pool.id()]; exist && strings.ToLower(pair.Src) > strings.ToLower(pair.Dst) {
+			continue
+		}
+		d.AddPool(pool)
+	}
+}
+
+// AddFile adds a gzip snapshot or a pair file.
+func (d *Dataset) AddFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return d.AddPairFile(path)
+	}
+	snapshot, err := database.LoadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	d.AddRecords(snapshot.Graph.Tokens, snapshot.Graph.Pairs)
+	return nil
+}
+
+// AddStore adds all the tokens and pairs of the store.
+func (d *Dataset) AddStore(store database.Store) error {
+	tokens, err := store.Tokens()
+	if err != nil {
+		return err
+	}
+	pairs, err := store.Pairs()
+	if err != nil {
+		return err
+	}
+	d.AddRecords(tokens, pairs)
+	return nil
+}
+
+// PoolChange is a pool in both datasets with a different state.
+type PoolChange struct {
+	Old *Pool `json:"old"`
+	New *Pool `json:"new"`
+	// Ratio is the relative change of the tracked liquidity, +Inf from zero.
+	Ratio float64 `json:"-"`
+}
+
+// TokenRename is a token with different names in both datasets.
+type TokenRename struct {
+	Token string `json:"token"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DexSummary is the change of the pools of a dex.
+type DexSummary struct {
+	Dex        string  `json:"dex"`
+	Added      int     `json:"added"`
+	Removed    int     `json:"removed"`
+	Changed    int     `json:"changed"`
+	Liquidity  int     `json:"liquidity_changed"`
+	OldTracked float64 `json:"old_tracked"`
+	NewTracked float64 `json:"new_tracked"`
+}
+
+// Diff is the change from an old dataset to a new one.
+type Diff struct {
+	Added   []*Pool      `json:"added"`
+	Removed []*Pool      `json:"removed"`
+	Changed []PoolChange `json:"changed"`
+	// Liquidity are the changed pools with a tracked change at least the threshold.
+	Liquidity []PoolChange  `json:"liquidity_changed"`
+	Renamed   []TokenRename `json:"renamed"`
+	Dexes     []DexSummary  `json:"dexes"`
+
+	newTokens map[string]string
+}
+
+// trackedRatio is the relative change from old to new, +Inf from zero.
+func trackedRatio(old, new float64) float64 {
+	if old == new {
+		return 0
+	}
+	if old == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(new-old) / math.Abs(old)
+}
+
+func sortPools(pools []*Pool) {
+	sort.Slice(pools, func(i, j int) bool { return pools[i].id() < pools[j].id() })
+}
+
+// Compare returns the change from old to new, the tracked changes of at least threshold,
+// relative to the old value, are listed in Liquidity.
+func Compare(old, new *Dataset, threshold float64) *Diff {
+	diff := &Diff{
+		Added: make([]*Pool, 0), Removed: make([]*Pool, 0), Changed: make([]PoolChange, 0),
+		Liquidity: make([]PoolChange, 0), Renamed: make([]TokenRename, 0), newTokens: new.Tokens,
+	}
+	dexes := make(map[string]*DexSummary)
+	dex := func(name string) *DexSummary {
+		if dexes[name] == nil {
+			dexes[name] = &DexSummary{Dex: name}
+		}
+		return dexes[name]
+	}
+	for id, o := range old.Pools {
+		dex(o.Dex).OldTracked += o.Tracked
+		n, exist := new.Pools[id]
+		if !exist {
+			diff.Removed = append(diff.Removed, o)
+			dex(o.Dex).Removed++
+			continue
+		}
+		if o.sameState(n) {
+			continue
+		}
+		change := PoolChange{Old: o, New: n, Ratio: trackedRatio(o.Tracked, n.Tracked)}
+		diff.Changed = append(diff.Changed, change)
+		dex(n.Dex).Changed++
+		if o.Tracked != n.Tracked && change.Ratio >= threshold {
+			diff.Liquidity = append(diff.Liquidity, change)
+			dex(n.Dex).Liquidity++
+		}
+	}
+	for id, n := range new.Pools {
+		dex(n.Dex).NewTracked += n.Tracked
+		if _, exist := old.Pools[id]; !exist {
+			diff.Added = append(diff.Added, n)
+			dex(n.Dex).Added++
+		}
+	}
+	for token, name := range old.Tokens {
+		if newName, exist := new.Tokens[token]; exist && len(name) > 0 && len(newName) > 0 && name != newName {
+			diff.Renamed = append(diff.Renamed, TokenRename{Token: token, Old: name, New: newName})
+		}
+	}
+
+	sortPools(diff.Added)
+	sortPools(diff.Removed)
+	for _, changes := range [][]PoolChange{diff.Changed, diff.Liquidity} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].New.id() < changes[j].New.id() })
+	}
+	sort.Slice(diff.Renamed, func(i, j int) bool { return diff.Renamed[i].Token < diff.Renamed[j].Token })
+	for _, summary := range dexes {
+		diff.Dexes = append(diff.Dexes, *summary)
+	}
+	sort.Slice(diff.Dexes, func(i, j int) bool { return diff.Dexes[i].Dex < diff.Dexes[j].Dex })
+	return diff
+}
+
+// PlanStep is a call of the admin api, the body of an upsert is the body of
+// /admin/pair/upsert and the body of a delete is the body of /admin/pair/delete.
+type PlanStep struct {
+	Op     string                 `json:"op"`
+	Upsert *param.UpsertPairParam `json:"upsert,omitempty"`
+	Delete *param.DeletePairParam `json:"delete,omitempty"`
+}
+
+// Plan returns the minimal steps that change the old dataset into the new one: a delete
+// for every removed pool and every pool moved to other tokens, and an upsert for every
+// added or changed pool.
+func (d *Diff) Plan() []PlanStep {
+	steps := make([]PlanStep, 0, len(d.Removed)+len(d.Added)+len(d.Changed))
+	deletes := append([]*Pool{}, d.Removed...)
+	upserts := append([]*Pool{}, d.Added...)
+	for _, change := range d.Changed {
+		if change.Old.Token0 != change.New.Token0 || change.Old.Token1 != change.New.Token1 {
+			deletes = append(deletes, change.Old)
+		}
+		upserts = append(upserts, change.New)
+	}
+	for _, pool := range deletes {
+		steps = append(steps, PlanStep{Op: PlanDelete, Delete: &param.DeletePairParam{Pair: pool.Pair}})
+	}
+	for _, pool := range upserts {
+		steps = append(steps, PlanStep{Op: PlanUpsert, Upsert: &param.UpsertPairParam{
+			Dex:        pool.Dex,
+			Pair:       pool.Pair,
+			Fee:        strconv.FormatInt(pool.Fee, 10),
+			Tracked:    pool.TrackedRaw,
+			Token0:     pool.Token0,
+			Token1:     pool.Token1,
+			Token0Name: d.newTokens[pool.Token0],
+			Token1Name: d.newTokens[pool.Token1],
+			Reserve0:   pool.Reserve0,
+			Reserve1:   pool.Reserve1,
+			Block:      uint64(pool.Block),
+		}})
+	}
+	return steps
+}
@@ -0,0 +1,167 @@
+package dataset
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/service/param"
+)
+
+const (
+	addrP3 = "0x00000000000000000000000000000000000000f3"
+	addrP4 = "0x00000000000000000000000000000000000000f4"
+	addrP5 = "0x00000000000000000000000000000000000000f5"
+	addrP6 = "0x00000000000000000000000000000000000000f6"
+)
+
+func pool(dex, pair, token0, token1 string, fee int64, tracked float64) *Pool {
+	return &Pool{Dex: dex, Pair: pair, Token0: token0, Token1: token1, Fee: fee, Tracked: tracked}
+}
+
+// diffDatasets returns an old and a new dataset with a pool of every kind of change.
+func diffDatasets() (*Dataset, *Dataset) {
+	old, new := NewDataset(), NewDataset()
+	old.AddToken(addrA, "Token A")
+	old.AddToken(addrB, "Token B")
+	new.AddToken(addrA, "Token A2")
+	new.AddToken(addrB, "")
+	for _, d := range []*Dataset{old, new} {
+		// unchanged
+		d.AddPool(pool("dex1", addrPair, addrA, addrB, 30, 100))
+	}
+	// removed
+	old.AddPool(pool("dex1", addrP2, addrA, addrC, 30, 10))
+	// added
+	new.AddPool(pool("dex2", addrP3, addrB, addrC, 25, 40))
+	// fee changed, tracked within the threshold
+	old.AddPool(pool("dex1", addrP4, addrB, addrC, 30, 100))
+	new.AddPool(pool("dex1", addrP4, addrB, addrC, 25, 105))
+	// tracked over the threshold
+	old.AddPool(pool("dex2", addrP5, addrA, addrB, 25, 100))
+	new.AddPool(pool("dex2", addrP5, addrA, addrB, 25, 300))
+	// moved to other tokens, with liquidity from zero
+	old.AddPool(pool("dex2", addrP6, addrA, addrB, 25, 0))
+	new.AddPool(pool("dex2", addrP6, addrA, addrC, 25, 1))
+	return old, new
+}
+
+func poolPairs(pools []*Pool) []string {
+	pairs := make([]string, 0, len(pools))
+	for _, p := range pools {
+		pairs = append(pairs, p.Pair)
+	}
+	return pairs
+}
+
+func changePairs(changes []PoolChange) []string {
+	pairs := make([]string, 0, len(changes))
+	for _, c := range changes {
+		pairs = append(pairs, c.New.Pair)
+	}
+	return pairs
+}
+
+func TestCompare(t *testing.T) {
+	old, new := diffDatasets()
+	diff := Compare(old, new, 0.1)
+	if got := poolPairs(diff.Added); !reflect.DeepEqual(got, []string{addrP3}) {
+		t.Fatalf("got added %v", got)
+	}
+	if got := poolPairs(diff.Removed); !reflect.DeepEqual(got, []string{addrP2}) {
+		t.Fatalf("got removed %v", got)
+	}
+	if got := changePairs(diff.Changed); !reflect.DeepEqual(got, []string{addrP4, addrP5, addrP6}) {
+		t.Fatalf("got changed %v", got)
+	}
+	if got := changePairs(diff.Liquidity); !reflect.DeepEqual(got, []string{addrP5, addrP6}) {
+		t.Fatalf("got liquidity changed %v", got)
+	}
+	if ratio := diff.Liquidity[0].Ratio; ratio != 2 {
+		t.Fatalf("got ratio %v for 100 to 300", ratio)
+	}
+	if ratio := diff.Liquidity[1].Ratio; !math.IsInf(ratio, 1) {
+		t.Fatalf("got ratio %v from zero", ratio)
+	}
+	// an empty new name is not a rename.
+	if want := []TokenRename{{Token: addrA, Old: "Token A", New: "Token A2"}}; !reflect.DeepEqual(diff.Renamed, want) {
+		t.Fatalf("got renamed %+v", diff.Renamed)
+	}
+	want := []DexSummary{
+		{Dex: "dex1", Removed: 1, Changed: 1, OldTracked: 210, NewTracked: 205},
+		{Dex: "dex2", Added: 1, Changed: 2, Liquidity: 2, OldTracked: 100, NewTracked: 341},
+	}
+	if !reflect.DeepEqual(diff.Dexes, want) {
+		t.Fatalf("got dexes %+v, want %+v", diff.Dexes, want)
+	}
+
+	// a threshold of 0 lists every tracked change.
+	if got := changePairs(Compare(old, new, 0).Liquidity); !reflect.DeepEqual(got, []string{addrP4, addrP5, addrP6}) {
+		t.Fatalf("got liquidity changed %v with threshold 0", got)
+	}
+	if diff := Compare(new, new, 0); len(diff.Added)+len(diff.Removed)+len(diff.Changed)+len(diff.Plan()) != 0 {
+		t.Fatalf("got changes %+v between the same datasets", diff)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	old, new := diffDatasets()
+	new.Pools["dex2|"+addrP5].TrackedRaw = "300"
+	steps := Compare(old, new, 0.1).Plan()
+	ops := make([]string, 0, len(steps))
+	for _, step := range steps {
+		switch step.Op {
+		case PlanDelete:
+			ops = append(ops, "delete "+step.Delete.Pair)
+		case PlanUpsert:
+			ops = append(ops, "upsert "+step.Upsert.Pair)
+		}
+	}
+	// the removed and moved pools are deleted first, then the added and changed pools upserted.
+	want := []string{"delete " + addrP2, "delete " + addrP6, "upsert " + addrP3, "upsert " + addrP4,
+		"upsert " + addrP5, "upsert " + addrP6}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("got plan %v, want %v", ops, want)
+	}
+	upsert := steps[4].Upsert
+	wantUpsert := &param.UpsertPairParam{Dex: "dex2", Pair: addrP5, Fee: "25", Tracked: "300", Token0: addrA,
+		Token1: addrB, Token0Name: "Token A2"}
+	if !reflect.DeepEqual(upsert, wantUpsert) {
+		t.Fatalf("got upsert %+v, want %+v", upsert, wantUpsert)
+	}
+}
+
+func TestDatasetAddPool(t *testing.T) {
+	d := NewDataset()
+	d.AddToken(addrB, "Token B")
+	p := &Pool{Dex: "Dex", Pair: addrPair, Token0: "0x" + "00000000000000000000000000000000000000" + "0B",
+		Token1: addrA, Reserve0: "2", Reserve1: "1"}
+	d.AddPool(p)
+	if p.Token0 != addrA || p.Token1 != addrB || p.Reserve0 != "1" || p.Reserve1 != "2" {
+		t.Fatalf("got pool %+v, want the tokens and reserves sorted", p)
+	}
+	if d.Tokens[addrB] != "Token B" || d.Tokens[addrA] != "" {
+		t.Fatalf("got tokens %v", d.Tokens)
+	}
+}
+
+func TestDatasetAddRecords(t *testing.T) {
+	d := NewDataset()
+	// the edge of the lower token wins over its reverse edge.
+	d.AddRecords(nil, []database.PairRecord{
+		{Src: addrB, Dst: addrA, Dex: "Dex", Pair: addrPair, Fee: 30, Tracked: 1, TrackedRaw: "1", Reserve0: "20", Reserve1: "10"},
+		{Src: addrA, Dst: addrB, Dex: "Dex", Pair: addrPair, Fee: 30, Tracked: 1, TrackedRaw: "1", Reserve0: "11", Reserve1: "21"},
+		{Src: addrC, Dst: addrB, Dex: "Dex", Pair: addrP2, Fee: 30, Tracked: 2, TrackedRaw: "2", Reserve0: "30", Reserve1: "40"},
+	})
+	if len(d.Pools) != 2 {
+		t.Fatalf("got %d pools", len(d.Pools))
+	}
+	if p := d.Pools["dex|"+addrPair]; p.Reserve0 != "11" || p.Reserve1 != "21" {
+		t.Fatalf("got pool %+v, want the edge of the lower token", p)
+	}
+	// the only edge is the one from the higher token, its reserves are swapped.
+	if p := d.Pools["dex|"+addrP2]; p.Token0 != addrB || p.Reserve0 != "40" || p.Reserve1 != "30" {
+		t.Fatalf("got pool %+v", p)
+	}
+}
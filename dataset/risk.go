@@ -0,0 +1,89 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/xueqianLu/routegen/database"
+)
+
+// RiskEntry is a token of a risk list, Flag defaults to blocked in the blocklist.
+type RiskEntry struct {
+	Address string `json:"address"`
+	Flag    string `json:"flag,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RiskList is the risk list file, the allowlisted tokens are kept out of the detection.
+//
+//	{
+//	  "blocklist": [{"address": "0x...", "flag": "honeypot", "reason": "sell reverts"}],
+//	  "allowlist": [{"address": "0x...", "reason": "audited"}]
+//	}
+type RiskList struct {
+	Blocklist []RiskEntry `json:"blocklist"`
+	Allowlist []RiskEntry `json:"allowlist"`
+}
+
+// ReadRiskList reads the risk list file.
+func ReadRiskList(path string) (*RiskList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list := new(RiskList)
+	if err = json.Unmarshal(data, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Risks returns the token risks of the list with source, it returns an error for an
+// invalid address or flag, and for a token in both lists.
+func (l *RiskList) Risks(source string) ([]database.TokenRisk, error) {
+	risks := make([]database.TokenRisk, 0, len(l.Blocklist)+len(l.Allowlist))
+	seen := make(map[string]string)
+	add := func(entry RiskEntry, flag string) error {
+		if !isAddress(entry.Address) {
+			return fmt.Errorf("malformed token address (%s)", entry.Address)
+		}
+		if err := database.ValidRiskFlag(flag); err != nil {
+			return fmt.Errorf("token %s: %w", entry.Address, err)
+		}
+		address := strings.ToLower(entry.Address)
+		if former, exist := seen[address]; exist && former != flag {
+			return fmt.Errorf("token %s is both %s and %s", entry.Address, former, flag)
+		}
+		seen[address] = flag
+		risks = append(risks, database.TokenRisk{
+			Address: entry.Address,
+			Flag:    flag,
+			Reason:  entry.Reason,
+			Source:  source,
+		})
+		return nil
+	}
+	for _, entry := range l.Blocklist {
+		flag := entry.Flag
+		if len(flag) == 0 {
+			flag = database.RiskBlocked
+		}
+		if flag == database.RiskAllowed {
+			return nil, fmt.Errorf("token %s of the blocklist is %s", entry.Address, flag)
+		}
+		if err := add(entry, flag); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range l.Allowlist {
+		if len(entry.Flag) > 0 && entry.Flag != database.RiskAllowed {
+			return nil, fmt.Errorf("token %s of the allowlist is %s", entry.Address, entry.Flag)
+		}
+		if err := add(entry, database.RiskAllowed); err != nil {
+			return nil, err
+		}
+	}
+	return risks, nil
+}
@@ -0,0 +1,123 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/xueqianLu/routegen/database"
+)
+
+// TokenListVersion is the semantic version of a token list.
+type TokenListVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// TokenListTag describes a tag id used by the tokens of the list.
+type TokenListTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TokenListEntry is a token of a token list.
+type TokenListEntry struct {
+	ChainID  int64    `json:"chainId"`
+	Address  string   `json:"address"`
+	Name     string   `json:"name"`
+	Symbol   string   `json:"symbol"`
+	Decimals int      `json:"decimals"`
+	LogoURI  string   `json:"logoURI,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// TokenList is a token list file of the Uniswap standard.
+//
+//	{
+//	  "name": "My List",
+//	  "timestamp": "2022-01-01T00:00:00Z",
+//	  "version": {"major": 1, "minor": 0, "patch": 0},
+//	  "tokens": [{"chainId": 56, "address": "0x...", "name": "Wrapped BNB", "symbol": "WBNB", "decimals": 18}]
+//	}
+type TokenList struct {
+	Name      string                  `json:"name"`
+	Timestamp string                  `json:"timestamp"`
+	Version   TokenListVersion        `json:"version"`
+	LogoURI   string                  `json:"logoURI,omitempty"`
+	Keywords  []string                `json:"keywords,omitempty"`
+	Tags      map[string]TokenListTag `json:"tags,omitempty"`
+	Tokens    []TokenListEntry        `json:"tokens"`
+}
+
+// NewTokenList returns the list of the tokens at version 1.0.0, stamped now.
+func NewTokenList(name string, tokens []TokenListEntry) *TokenList {
+	return &TokenList{
+		Name:      name,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Version:   TokenListVersion{Major: 1},
+		Tokens:    tokens,
+	}
+}
+
+// ReadTokenList reads the token list file.
+func ReadTokenList(path string) (*TokenList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	list := new(TokenList)
+	if err = json.Unmarshal(data, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Write writes the list as indented json.
+func (l *TokenList) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// Infos returns the token infos of the tokens on chainID, the tokens of the other chains
+// are left out. It returns an error for an invalid address, symbol or decimals, and for a
+// token listed twice.
+func (l *TokenList) Infos(chainID int64, verified bool) ([]database.TokenInfo, error) {
+	infos := make([]database.TokenInfo, 0, len(l.Tokens))
+	seen := make(map[string]bool)
+	for _, token := range l.Tokens {
+		if token.ChainID != chainID {
+			continue
+		}
+		if !isAddress(token.Address) {
+			return nil, fmt.Errorf("malformed token address (%s)", token.Address)
+		}
+		if len(token.Symbol) == 0 {
+			return nil, fmt.Errorf("token %s has no symbol", token.Address)
+		}
+		if token.Decimals < 0 || token.Decimals > 255 {
+			return nil, fmt.Errorf("token %s has invalid decimals %d", token.Address, token.Decimals)
+		}
+		address := strings.ToLower(token.Address)
+		if seen[address] {
+			return nil, fmt.Errorf("token %s is listed twice", token.Address)
+		}
+		seen[address] = true
+		infos = append(infos, database.TokenInfo{
+			Address:  token.Address,
+			ChainID:  token.ChainID,
+			Name:     token.Name,
+			Symbol:   token.Symbol,
+			Decimals: token.Decimals,
+			LogoURI:  token.LogoURI,
+			Tags:     token.Tags,
+			Verified: verified,
+			Source:   l.Name,
+		})
+	}
+	return infos, nil
+}
@@ -0,0 +1,339 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	IssueSyntax    = "syntax"
+	IssueFormat    = "format"
+	IssueDexName   = "dex-name"
+	IssueFee       = "fee"
+	IssueAddress   = "address"
+	IssueSameToken = "same-token"
+	IssueOrder     = "token-order"
+	IssueDuplicate = "duplicate"
+	IssueTracked   = "tracked"
+	IssueCreate2   = "create2"
+
+	// maxFeeBps is the exclusive upper bound of a fee in basis points.
+	maxFeeBps = 10000
+)
+
+// Issue is a problem found in a data file, Line is 1 based and 0 for the whole file.
+type Issue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: [%s] %s", i.File, i.Line, i.Code, i.Message)
+}
+
+// Validator checks the data files, the duplicated pairs are found across all the files
+// of the same format it has checked.
+type Validator struct {
+	seen     map[string]string // format and lower case pair address to the position it was first seen
+	verifier *PairVerifier
+}
+
+// NewValidator returns a validator, the pair addresses of the dexes known by verifier
+// are checked too. verifier may be nil.
+func NewValidator(verifier *PairVerifier) *Validator {
+	return &Validator{seen: make(map[string]string), verifier: verifier}
+}
+
+// fileCheck is the state of checking one file.
+type fileCheck struct {
+	v      *Validator
+	file   string
+	format string
+	data   []byte
+	lines  []int // offsets of the line breaks
+	issues []Issue
+}
+
+func (c *fileCheck) line(offset int64) int {
+	return sort.SearchInts(c.lines, int(offset)) + 1
+}
+
+func (c *fileCheck) add(offset int64, code string, format string, args ...interface{}) {
+	line := 0
+	if offset >= 0 {
+		line = c.line(offset)
+	}
+	c.issues = append(c.issues, Issue{File: c.file, Line: line, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// start returns the offset of the next value after the offset of the decoder.
+func (c *fileCheck) start(offset int64) int64 {
+	for int(offset) < len(c.data) && strings.IndexByte(" \t\r\n,:", c.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// syntax adds the decode error with its position, the offset of a type error is
+// relative to the value decoded from start.
+func (c *fileCheck) syntax(dec *json.Decoder, err error, start int64) {
+	offset := dec.InputOffset()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = start + typeErr.Offset
+	}
+	c.add(offset, IssueSyntax, "%s", err)
+}
+
+// File checks the data file, a pair file or a dex list file. The error is only for a
+// file that can not be read, the problems of its content are returned as issues.
+func (v *Validator) File(path string) ([]Issue, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &fileCheck{v: v, file: path, data: data}
+	for i, b := range data {
+		if b == '\n' {
+			c.lines = append(c.lines, i)
+		}
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		c.add(-1, IssueFormat, "empty file")
+	case trimmed[0] == '{':
+		c.format = "pair file"
+		c.pairFile()
+	case trimmed[0] == '[':
+		c.format = "dex list"
+		c.dexList()
+	default:
+		c.add(c.start(0), IssueFormat, "unknown format, want a pair file or a dex list")
+	}
+	return c.issues, nil
+}
+
+// expectDelim reads the delimiter token, and adds an issue if the token is another one.
+func (c *fileCheck) expectDelim(dec *json.Decoder, delim json.Delim, what string) bool {
+	offset := c.start(dec.InputOffset())
+	token, err := dec.Token()
+	if err != nil {
+		c.syntax(dec, err, 0)
+		return false
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		c.add(offset, IssueFormat, "%s must start with %s", what, delim)
+		return false
+	}
+	return true
+}
+
+// object reads the keys of an object, fn decodes the value of each key and returns false to stop.
+func (c *fileCheck) object(dec *json.Decoder, what string, fn func(key string, offset int64) bool) bool {
+	if !c.expectDelim(dec, '{', what) {
+		return false
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			c.syntax(dec, err, 0)
+			return false
+		}
+		if !fn(token.(string), c.start(dec.InputOffset())) {
+			return false
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		c.syntax(dec, err, 0)
+		return false
+	}
+	return true
+}
+
+// array decodes the elements of an array, fn returns false to stop.
+func (c *fileCheck) array(dec *json.Decoder, what string, fn func(offset int64) bool) bool {
+	if !c.expectDelim(dec, '[', what) {
+		return false
+	}
+	for dec.More() {
+		if !fn(c.start(dec.InputOffset())) {
+			return false
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		c.syntax(dec, err, 0)
+		return false
+	}
+	return true
+}
+
+// decode decodes the next value, which starts at offset, into v, and adds an issue on error.
+func (c *fileCheck) decode(dec *json.Decoder, offset int64, v interface{}) bool {
+	if err := dec.Decode(v); err != nil {
+		c.syntax(dec, err, offset)
+		return false
+	}
+	return true
+}
+
+func (c *fileCheck) pairFile() {
+	dec := json.NewDecoder(bytes.NewReader(c.data))
+	var name, fee string
+	nameAt, feeAt := int64(-1), int64(-1)
+	pairs := 0
+	// the name may follow the pairs, so the pair addresses are verified at the end.
+	type pending struct {
+		offset int64
+		pair   ImportPairInfo
+	}
+	verify := make([]pending, 0)
+	parsed := c.object(dec, "pair file", func(key string, offset int64) bool {
+		switch key {
+		case "name":
+			nameAt = offset
+			return c.decode(dec, offset, &name)
+		case "fee":
+			feeAt = offset
+			return c.decode(dec, offset, &fee)
+		case "data":
+			return c.object(dec, "data", func(key string, offset int64) bool {
+				if key != "pairs" {
+					return c.decode(dec, offset, new(json.RawMessage))
+				}
+				return c.array(dec, "pairs", func(offset int64) bool {
+					var pair ImportPairInfo
+					if !c.decode(dec, offset, &pair) {
+						return false
+					}
+					pairs++
+					if c.pair(offset, pair.Address, pair.Token0.Address, pair.Token1.Address) {
+						verify = append(verify, pending{offset: offset, pair: pair})
+					}
+					c.tracked(offset, pair.TrackedValue)
+					return true
+				})
+			})
+		default:
+			return c.decode(dec, offset, new(json.RawMessage))
+		}
+	})
+	if !parsed {
+		return
+	}
+	if len(strings.TrimSpace(name)) == 0 {
+		c.add(nameAt, IssueDexName, "missing dex name")
+	}
+	c.fee(feeAt, fee)
+	if pairs == 0 {
+		c.add(-1, IssueFormat, "no pairs in data.pairs")
+	}
+	for _, p := range verify {
+		c.create2(p.offset, name, "", p.pair.Address, p.pair.Token0.Address, p.pair.Token1.Address)
+	}
+}
+
+// create2 adds the CREATE2 mismatch of the pair, the token order is checked by pair.
+func (c *fileCheck) create2(offset int64, dex, factory, pair, token0, token1 string) {
+	err := c.v.verifier.VerifyFactory(dex, factory, pair, token0, token1)
+	if err != nil && !errors.Is(err, ErrTokenOrder) {
+		c.add(offset, IssueCreate2, "pair %s of %s: %s", pair, dex, err)
+	}
+}
+
+func (c *fileCheck) dexList() {
+	dec := json.NewDecoder(bytes.NewReader(c.data))
+	c.array(dec, "dex list", func(offset int64) bool {
+		var entry DexListEntry
+		if !c.decode(dec, offset, &entry) {
+			return false
+		}
+		if len(strings.TrimSpace(entry.Dex)) == 0 {
+			c.add(offset, IssueDexName, "missing dex name")
+		}
+		c.fee(offset, entry.Fee)
+		if !isAddress(entry.Factory) {
+			c.add(offset, IssueAddress, "malformed factory address (%s)", entry.Factory)
+		}
+		for _, pair := range entry.Pairs {
+			if c.pair(offset, pair.Contract, pair.Token0, pair.Token1) && isAddress(entry.Factory) {
+				c.create2(offset, entry.Dex, entry.Factory, pair.Contract, pair.Token0, pair.Token1)
+			}
+		}
+		return true
+	})
+}
+
+// isAddress tells whether s is a hex address, a mixed case address must have a valid EIP-55 checksum.
+func isAddress(s string) bool {
+	if !common.IsHexAddress(s) || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	hex := s[2:]
+	if hex == strings.ToLower(hex) || hex == strings.ToUpper(hex) {
+		return true
+	}
+	return common.HexToAddress(s).Hex() == s
+}
+
+func (c *fileCheck) fee(offset int64, fee string) {
+	bps, err := strconv.ParseInt(strings.TrimSpace(fee), 10, 64)
+	if err != nil || bps < 0 || bps >= maxFeeBps {
+		c.add(offset, IssueFee, "unknown fee (%s), want basis points in [0, %d)", fee, maxFeeBps)
+	}
+}
+
+func (c *fileCheck) tracked(offset int64, tracked string) {
+	if len(strings.TrimSpace(tracked)) == 0 {
+		c.add(offset, IssueTracked, "empty trackedReserveBNB")
+		return
+	}
+	if _, ok := new(big.Float).SetString(strings.TrimSpace(tracked)); !ok {
+		c.add(offset, IssueTracked, "trackedReserveBNB (%s) is not a decimal number", tracked)
+	}
+}
+
+// pair checks the addresses and the tokens of the pair, it returns whether the addresses are valid.
+func (c *fileCheck) pair(offset int64, address, token0, token1 string) bool {
+	valid := true
+	for _, a := range [][2]string{{"pair", address}, {"token0", token0}, {"token1", token1}} {
+		if !isAddress(a[1]) {
+			c.add(offset, IssueAddress, "malformed %s address (%s)", a[0], a[1])
+			valid = false
+		}
+	}
+	if len(address) > 0 {
+		position := fmt.Sprintf("%s:%d", c.file, c.line(offset))
+		id := c.format + "|" + strings.ToLower(address)
+		if first, exist := c.v.seen[id]; exist {
+			c.add(offset, IssueDuplicate, "pair %s is already at %s", address, first)
+		} else {
+			c.v.seen[id] = position
+		}
+	}
+	if !valid {
+		return false
+	}
+	switch cmp := strings.Compare(strings.ToLower(token0), strings.ToLower(token1)); {
+	case cmp == 0:
+		c.add(offset, IssueSameToken, "pair %s has token0 == token1 (%s)", address, token0)
+	case cmp > 0:
+		c.add(offset, IssueOrder, "pair %s has token0 %s after token1 %s, the tokens of a pair are sorted", address, token0, token1)
+	}
+	return true
+}
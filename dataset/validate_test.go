@@ -0,0 +1,183 @@
+package dataset
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	addrA    = "0x000000000000000000000000000000000000000a"
+	addrB    = "0x000000000000000000000000000000000000000b"
+	addrC    = "0x000000000000000000000000000000000000000c"
+	addrPair = "0x00000000000000000000000000000000000000f1"
+	addrP2   = "0x00000000000000000000000000000000000000f2"
+	// badChecksum is a mixed case address with a wrong EIP-55 checksum.
+	badChecksum = "0x00000000000000000000000000000000000000aB"
+)
+
+// pairLine is a pair of a pair file on one line.
+func pairLine(pair, token0, token1, tracked string) string {
+	return fmt.Sprintf(`{"id": "%s", "trackedReserveBNB": "%s", "token0": {"id": "%s"}, "token1": {"id": "%s"}}`,
+		pair, tracked, token0, token1)
+}
+
+// pairFile is a pair file with the fee on line 3 and one pair per line from line 5.
+func pairFile(name, fee string, pairs ...string) string {
+	return fmt.Sprintf("{\n\"name\": \"%s\",\n\"fee\": \"%s\",\n\"data\": {\"pairs\": [\n%s\n]}\n}\n",
+		name, fee, strings.Join(pairs, ",\n"))
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issueCodes are the issues as "line:code".
+func issueCodes(issues []Issue) []string {
+	codes := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		codes = append(codes, fmt.Sprintf("%d:%s", issue.Line, issue.Code))
+	}
+	return codes
+}
+
+func TestValidateFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "valid pair file",
+			content: pairFile("Dex", "30", pairLine(addrPair, addrA, addrB, "1.5"), pairLine(addrP2, addrB, addrC, "2")),
+			want:    []string{},
+		},
+		{name: "empty", content: " \n", want: []string{"0:" + IssueFormat}},
+		{name: "unknown format", content: "\n\"pairs\"", want: []string{"2:" + IssueFormat}},
+		{name: "syntax", content: "{\n\"name\": \"Dex\",\n\"fee\": 30\n}", want: []string{"3:" + IssueSyntax}},
+		{name: "truncated", content: "{\n\"name\": \"Dex\",\n\"data\": {\"pairs\": [\n" + pairLine(addrPair, addrA, addrB, "1"),
+			want: []string{"4:" + IssueSyntax}},
+		{name: "pairs not an array", content: "{\"name\": \"Dex\", \"fee\": \"30\", \"data\": {\"pairs\": {}}}",
+			want: []string{"1:" + IssueFormat}},
+		{
+			name:    "missing name and no pairs",
+			content: "{\"fee\": \"30\", \"data\": {\"pairs\": []}}",
+			want:    []string{"0:" + IssueDexName, "0:" + IssueFormat},
+		},
+		{
+			name:    "fee",
+			content: pairFile("Dex", "0.3", pairLine(addrPair, addrA, addrB, "1")),
+			want:    []string{"3:" + IssueFee},
+		},
+		{
+			name:    "fee out of range",
+			content: pairFile("Dex", "10000", pairLine(addrPair, addrA, addrB, "1")),
+			want:    []string{"3:" + IssueFee},
+		},
+		{
+			name: "addresses",
+			content: pairFile("Dex", "30", pairLine("0xf1", addrA, addrB, "1"),
+				pairLine(addrP2, badChecksum, addrC, "1")),
+			want: []string{"5:" + IssueAddress, "6:" + IssueAddress},
+		},
+		{
+			name: "tokens",
+			content: pairFile("Dex", "30", pairLine(addrPair, addrA, strings.ToUpper(addrA[2:]), "1"),
+				pairLine(addrP2, addrC, addrB, "1")),
+			want: []string{"5:" + IssueAddress, "6:" + IssueOrder},
+		},
+		{
+			name:    "same token",
+			content: pairFile("Dex", "30", pairLine(addrPair, addrA, "0x"+strings.ToUpper(addrA[2:]), "1")),
+			want:    []string{"5:" + IssueSameToken},
+		},
+		{
+			name: "duplicate",
+			content: pairFile("Dex", "30", pairLine(addrPair, addrA, addrB, "1"),
+				pairLine("0x"+strings.ToUpper(addrPair[2:]), addrB, addrC, "1")),
+			want: []string{"6:" + IssueDuplicate},
+		},
+		{
+			name: "tracked",
+			content: pairFile("Dex", "30", pairLine(addrPair, addrA, addrB, ""),
+				pairLine(addrP2, addrB, addrC, "1e3x")),
+			want: []string{"5:" + IssueTracked, "6:" + IssueTracked},
+		},
+		{
+			name: "dex list",
+			content: "[\n" +
+				`{"dex": "Dex", "factory": "` + addrC + `", "fee": "25", "pairs": [{"contract": "` + addrPair + `", "token0": "` + addrA + `", "token1": "` + addrB + `"}]},` + "\n" +
+				`{"dex": "", "factory": "0x12", "fee": "-1", "pairs": [{"contract": "` + addrPair + `", "token0": "` + addrB + `", "token1": "` + addrA + `"}]}` + "\n]",
+			want: []string{"3:" + IssueDexName, "3:" + IssueFee, "3:" + IssueAddress, "3:" + IssueDuplicate, "3:" + IssueOrder},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "pairs.json", tt.content)
+			issues, err := NewValidator(nil).File(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := issueCodes(issues); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got issues %v, want %v", issues, tt.want)
+			}
+			for _, issue := range issues {
+				if issue.File != path || len(issue.Message) == 0 {
+					t.Fatalf("issue %+v has no file or message", issue)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDuplicateAcrossFiles(t *testing.T) {
+	v := NewValidator(nil)
+	first := writeTestFile(t, "first.json", pairFile("Dex", "30", pairLine(addrPair, addrA, addrB, "1")))
+	second := writeTestFile(t, "second.json", pairFile("Other", "30", pairLine(addrP2, addrB, addrC, "1"),
+		pairLine(addrPair, addrA, addrB, "1")))
+	if issues, err := v.File(first); err != nil || len(issues) != 0 {
+		t.Fatalf("got %v, %v", issues, err)
+	}
+	issues, err := v.File(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issueCodes(issues); !reflect.DeepEqual(got, []string{"6:" + IssueDuplicate}) {
+		t.Fatalf("got issues %v", issues)
+	}
+	if !strings.Contains(issues[0].Message, first+":5") {
+		t.Fatalf("the duplicate should point to the first pair, got %s", issues[0].Message)
+	}
+	if _, err = v.File(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("a missing file should fail")
+	}
+}
+
+func TestValidateCreate2(t *testing.T) {
+	spoofed := "0x00000000000000000000000000000000000000f1"
+	content := pairFile("PancakeSwap", "25", pairLine(wbnbBusd, wbnb, busd, "1"), pairLine(spoofed, wbnb, busd, "1"))
+	issues, err := NewValidator(testVerifier(t)).File(writeTestFile(t, "pancake.json", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issueCodes(issues); !reflect.DeepEqual(got, []string{"6:" + IssueCreate2}) {
+		t.Fatalf("got issues %v", issues)
+	}
+
+	list := "[\n" + `{"dex": "PancakeSwap", "factory": "` + addrC + `", "fee": "25", "pairs": [{"contract": "` +
+		wbnbBusd + `", "token0": "` + wbnb + `", "token1": "` + busd + `"}]}` + "\n]"
+	issues, err = NewValidator(testVerifier(t)).File(writeTestFile(t, "list.json", list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := issueCodes(issues); !reflect.DeepEqual(got, []string{"2:" + IssueCreate2}) {
+		t.Fatalf("got issues %v for another factory", issues)
+	}
+}
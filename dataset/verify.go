@@ -0,0 +1,94 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/contracts"
+)
+
+var (
+	ErrTokenOrder   = errors.New("token0 must be lower than token1")
+	ErrPairMismatch = errors.New("pair is not the CREATE2 address of the factory")
+)
+
+type verifiedDex struct {
+	factory      common.Address
+	initCodeHash common.Hash
+}
+
+// PairVerifier checks that the pairs of the configured dexes are at the CREATE2 address
+// of the factory, so a spoofed pool contract can not be imported as a pair of the dex.
+type PairVerifier struct {
+	dexes map[string]verifiedDex // lower case dex name
+}
+
+// NewPairVerifier returns the verifier of the dexes.
+func NewPairVerifier(dexes []config.DexConfig) (*PairVerifier, error) {
+	v := &PairVerifier{dexes: make(map[string]verifiedDex)}
+	for _, dex := range dexes {
+		if !common.IsHexAddress(dex.Factory) {
+			return nil, fmt.Errorf("dex %s has an invalid factory (%s)", dex.Name, dex.Factory)
+		}
+		hash := strings.TrimPrefix(dex.InitCodeHash, "0x")
+		if len(hash) != 2*common.HashLength || !isHex(hash) {
+			return nil, fmt.Errorf("dex %s has an invalid init code hash (%s)", dex.Name, dex.InitCodeHash)
+		}
+		v.dexes[strings.ToLower(dex.Name)] = verifiedDex{
+			factory:      common.HexToAddress(dex.Factory),
+			initCodeHash: common.HexToHash(dex.InitCodeHash),
+		}
+	}
+	return v, nil
+}
+
+func isHex(s string) bool {
+	for _, c := range strings.ToLower(s) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Knows tells whether the dex is configured, the pairs of the other dexes are not verified.
+func (v *PairVerifier) Knows(dex string) bool {
+	if v == nil {
+		return false
+	}
+	_, exist := v.dexes[strings.ToLower(dex)]
+	return exist
+}
+
+// Verify checks the token order of every pair, and the address of the pairs of the
+// configured dexes, the pairs of an unknown dex are not checked against a factory.
+func (v *PairVerifier) Verify(dex, pair, token0, token1 string) error {
+	return v.VerifyFactory(dex, "", pair, token0, token1)
+}
+
+// VerifyFactory is Verify with the factory of the pair, the configured factory is used
+// if factory is empty, and a different factory is a mismatch.
+func (v *PairVerifier) VerifyFactory(dex, factory, pair, token0, token1 string) error {
+	if v == nil {
+		return nil
+	}
+	t0, t1 := common.HexToAddress(token0), common.HexToAddress(token1)
+	if strings.Compare(strings.ToLower(t0.Hex()), strings.ToLower(t1.Hex())) >= 0 {
+		return ErrTokenOrder
+	}
+	if !v.Knows(dex) {
+		return nil
+	}
+	d := v.dexes[strings.ToLower(dex)]
+	if len(factory) > 0 && common.HexToAddress(factory) != d.factory {
+		return fmt.Errorf("%w: factory %s is not the %s factory %s", ErrPairMismatch, factory, dex, d.factory.Hex())
+	}
+	expected := contracts.ComputePairAddress(d.factory, t0, t1, d.initCodeHash)
+	if expected != common.HexToAddress(pair) {
+		return fmt.Errorf("%w: want %s", ErrPairMismatch, expected.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package dataset
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/xueqianLu/routegen/config"
+)
+
+const (
+	pancakeFactory = "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73"
+	wbnb           = "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"
+	busd           = "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56"
+	// wbnbBusd is the PancakeSwap v2 pair of WBNB and BUSD.
+	wbnbBusd = "0x58F876857a02D6762E0101bb5C46A8c1ED44Dc16"
+)
+
+func testVerifier(t *testing.T) *PairVerifier {
+	v, err := NewPairVerifier([]config.DexConfig{{
+		Name:         "PancakeSwap",
+		Factory:      pancakeFactory,
+		InitCodeHash: "0x00fb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerifyFactory(t *testing.T) {
+	v := testVerifier(t)
+	tests := []struct {
+		name           string
+		dex, factory   string
+		pair           string
+		token0, token1 string
+		want           error
+	}{
+		{name: "real pair", dex: "PancakeSwap", pair: wbnbBusd, token0: wbnb, token1: busd},
+		{name: "dex in any case", dex: "pancakeswap", pair: wbnbBusd, token0: wbnb, token1: busd},
+		{name: "given factory", dex: "PancakeSwap", factory: pancakeFactory, pair: wbnbBusd, token0: wbnb, token1: busd},
+		{name: "other factory", dex: "PancakeSwap", factory: "0x0000000000000000000000000000000000000001",
+			pair: wbnbBusd, token0: wbnb, token1: busd, want: ErrPairMismatch},
+		{name: "spoofed pair", dex: "PancakeSwap", pair: "0x00000000000000000000000000000000000000f1",
+			token0: wbnb, token1: busd, want: ErrPairMismatch},
+		{name: "tokens swapped", dex: "PancakeSwap", pair: wbnbBusd, token0: busd, token1: wbnb, want: ErrTokenOrder},
+		{name: "unknown dex", dex: "Other", pair: "0x00000000000000000000000000000000000000f1", token0: wbnb, token1: busd},
+		{name: "unknown dex tokens swapped", dex: "Other", pair: "0x00000000000000000000000000000000000000f1",
+			token0: busd, token1: wbnb, want: ErrTokenOrder},
+		{name: "same token", dex: "Other", pair: wbnbBusd, token0: wbnb, token1: wbnb, want: ErrTokenOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.VerifyFactory(tt.dex, tt.factory, tt.pair, tt.token0, tt.token1); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	var off *PairVerifier
+	if err := off.Verify("PancakeSwap", wbnbBusd, busd, wbnb); err != nil {
+		t.Fatalf("a nil verifier checks nothing, got %v", err)
+	}
+}
+
+func TestNewPairVerifier(t *testing.T) {
+	for _, dex := range []config.DexConfig{
+		{Name: "bad factory", Factory: "0x1234", InitCodeHash: "0x00fb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5"},
+		{Name: "short hash", Factory: pancakeFactory, InitCodeHash: "0x00fb7f63"},
+		{Name: "not hex", Factory: pancakeFactory, InitCodeHash: "0xzzfb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5"},
+	} {
+		if _, err := NewPairVerifier([]config.DexConfig{dex}); err == nil {
+			t.Errorf("%s: want an error", dex.Name)
+		}
+	}
+}
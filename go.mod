@@ -6,7 +6,11 @@ require (
 	github.com/astaxie/beego v1.12.3
 	github.com/ethereum/go-ethereum v1.10.26
 	github.com/fsnotify/fsnotify v1.6.0
+	github.com/hashicorp/golang-lru v0.5.5-0.20210104140557-80c98217689d
+	github.com/klauspost/compress v1.15.15
 	github.com/lestrrat-go/file-rotatelogs v2.4.0+incompatible
+	github.com/lib/pq v1.10.7
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/naoina/toml v0.1.2-0.20170918210437-9fafd6967416
 	github.com/rifflock/lfshook v0.0.0-20180920164130-b9218ef580f5
 	github.com/sirupsen/logrus v1.9.0
@@ -14,6 +18,7 @@ require (
 	github.com/spf13/viper v1.15.0
 	github.com/vesoft-inc/nebula-go/v3 v3.4.0
 	github.com/zhihu/norm v0.1.11
+	go.etcd.io/bbolt v1.3.7
 )
 
 require (
@@ -29,7 +34,6 @@ require (
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/uuid v1.2.0 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
-	github.com/hashicorp/golang-lru v0.5.5-0.20210104140557-80c98217689d // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
 	github.com/jonboulle/clockwork v0.3.0 // indirect
@@ -0,0 +1,144 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatGEXF    = "gexf"
+)
+
+// Formats are the supported export formats.
+var Formats = []string{FormatDOT, FormatGraphML, FormatGEXF}
+
+// Export writes the graph in format, the tokens are labelled with their symbols and every
+// pool is an undirected edge with the dex, pair, fee, tracked liquidity and reserves.
+func Export(w io.Writer, g *Graph, format string) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatDOT:
+		writeDOT(bw, g)
+	case FormatGraphML:
+		writeGraphML(bw, g)
+	case FormatGEXF:
+		writeGEXF(bw, g)
+	default:
+		return fmt.Errorf("unknown graph format (%s), want one of %s", format, strings.Join(Formats, ", "))
+	}
+	return bw.Flush()
+}
+
+// label is the symbol of the token, else its name, else its address.
+func (g *Graph) label(token string) string {
+	if symbol := g.symbols[key(token)]; len(symbol) > 0 {
+		return symbol
+	}
+	if name := g.names[key(token)]; len(name) > 0 {
+		return name
+	}
+	return key(token)
+}
+
+// edgeAttrs are the name and value of the non empty attributes of the pool edge.
+func edgeAttrs(e *Edge) [][2]string {
+	attrs := make([][2]string, 0, 6)
+	for _, attr := range [][2]string{
+		{"dex", e.Pair.Dex}, {"pair", e.Pair.Pair}, {"fee", e.Pair.Fee},
+		{"tracked", strconv.FormatFloat(e.Tracked, 'f', -1, 64)},
+		{"reserve0", e.Pair.Reserve0}, {"reserve1", e.Pair.Reserve1},
+	} {
+		if len(attr[1]) > 0 {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func writeDOT(w *bufio.Writer, g *Graph) {
+	w.WriteString("graph tokens {\n")
+	for _, token := range g.Tokens() {
+		fmt.Fprintf(w, "  %s [label=%s];\n", dotQuote(token), dotQuote(g.label(token)))
+	}
+	for _, e := range g.Pools() {
+		attrs := []string{"label=" + dotQuote(e.Pair.Dex)}
+		for _, attr := range edgeAttrs(e) {
+			attrs = append(attrs, attr[0]+"="+dotQuote(attr[1]))
+		}
+		fmt.Fprintf(w, "  %s -- %s [%s];\n", dotQuote(key(e.Src)), dotQuote(key(e.Dst)), strings.Join(attrs, ", "))
+	}
+	w.WriteString("}\n")
+}
+
+// xmlEscape escapes s for an xml attribute or text.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeGraphML(w *bufio.Writer, g *Graph) {
+	w.WriteString(xml.Header)
+	w.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	keys := [][4]string{
+		{"label", "node", "label", "string"},
+		{"dex", "edge", "dex", "string"},
+		{"pair", "edge", "pair", "string"},
+		{"fee", "edge", "fee", "long"},
+		{"tracked", "edge", "tracked", "double"},
+		{"reserve0", "edge", "reserve0", "string"},
+		{"reserve1", "edge", "reserve1", "string"},
+	}
+	for _, k := range keys {
+		fmt.Fprintf(w, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", k[0], k[1], k[2], k[3])
+	}
+	w.WriteString(`  <graph id="tokens" edgedefault="undirected">` + "\n")
+	for _, token := range g.Tokens() {
+		fmt.Fprintf(w, `    <node id="%s"><data key="label">%s</data></node>`+"\n", xmlEscape(token), xmlEscape(g.label(token)))
+	}
+	for i, e := range g.Pools() {
+		fmt.Fprintf(w, `    <edge id="e%d" source="%s" target="%s">`, i, xmlEscape(key(e.Src)), xmlEscape(key(e.Dst)))
+		for _, data := range edgeAttrs(e) {
+			fmt.Fprintf(w, `<data key="%s">%s</data>`, data[0], xmlEscape(data[1]))
+		}
+		w.WriteString("</edge>\n")
+	}
+	w.WriteString("  </graph>\n</graphml>\n")
+}
+
+func writeGEXF(w *bufio.Writer, g *Graph) {
+	w.WriteString(xml.Header)
+	w.WriteString(`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n")
+	w.WriteString(`  <graph defaultedgetype="undirected">` + "\n")
+	w.WriteString(`    <attributes class="edge">` + "\n")
+	attrs := [][2]string{{"dex", "string"}, {"pair", "string"}, {"fee", "long"}, {"tracked", "double"},
+		{"reserve0", "string"}, {"reserve1", "string"}}
+	for _, attr := range attrs {
+		fmt.Fprintf(w, `      <attribute id="%s" title="%s" type="%s"/>`+"\n", attr[0], attr[0], attr[1])
+	}
+	w.WriteString("    </attributes>\n    <nodes>\n")
+	for _, token := range g.Tokens() {
+		fmt.Fprintf(w, `      <node id="%s" label="%s"/>`+"\n", xmlEscape(token), xmlEscape(g.label(token)))
+	}
+	w.WriteString("    </nodes>\n    <edges>\n")
+	for i, e := range g.Pools() {
+		fmt.Fprintf(w, `      <edge id="%d" source="%s" target="%s" label="%s"><attvalues>`,
+			i, xmlEscape(key(e.Src)), xmlEscape(key(e.Dst)), xmlEscape(e.Pair.Dex))
+		for _, value := range edgeAttrs(e) {
+			fmt.Fprintf(w, `<attvalue for="%s" value="%s"/>`, value[0], xmlEscape(value[1]))
+		}
+		w.WriteString("</attvalues></edge>\n")
+	}
+	w.WriteString("    </edges>\n  </graph>\n</gexf>\n")
+}
@@ -0,0 +1,222 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xueqianLu/routegen/types"
+)
+
+// DefaultMaxSteps is the hop limit of FindRoutes when none is given, same as nebula.
+const DefaultMaxSteps = 5
+
+// Edge is a pair between two tokens in one direction.
+type Edge struct {
+	Src     string
+	Dst     string
+	Tracked float64
+	Pair    types.RoutePairInfo
+}
+
+// Graph is an in memory token graph, the tokens are matched case insensitively.
+type Graph struct {
+	names   map[string]string
+	symbols map[string]string
+	adj     map[string][]*Edge
+	edges   int
+}
+
+func New() *Graph {
+	return &Graph{
+		names:   make(map[string]string),
+		symbols: make(map[string]string),
+		adj:     make(map[string][]*Edge),
+	}
+}
+
+func key(token string) string {
+	return strings.ToLower(token)
+}
+
+// AddToken adds the token with its name, the tokens of the edges are added without a name.
+func (g *Graph) AddToken(address string, name string) {
+	g.names[key(address)] = name
+}
+
+// AddEdge adds the directed edge, the reverse edge must be added by itself.
+func (g *Graph) AddEdge(e *Edge) {
+	for _, token := range []string{e.Src, e.Dst} {
+		if _, exist := g.names[key(token)]; !exist {
+			g.names[key(token)] = ""
+		}
+	}
+	g.adj[key(e.Src)] = append(g.adj[key(e.Src)], e)
+	g.edges++
+}
+
+// SetSymbol sets the symbol of the token, the tokens not in the graph are ignored.
+func (g *Graph) SetSymbol(address string, symbol string) {
+	if _, exist := g.names[key(address)]; exist && len(symbol) > 0 {
+		g.symbols[key(address)] = symbol
+	}
+}
+
+// Symbol returns the symbol of token, and whether it has one.
+func (g *Graph) Symbol(token string) (string, bool) {
+	symbol, exist := g.symbols[key(token)]
+	return symbol, exist
+}
+
+// Name returns the name of token, and whether the token is in the graph.
+func (g *Graph) Name(token string) (string, bool) {
+	name, exist := g.names[key(token)]
+	return name, exist
+}
+
+// Tokens returns all the tokens in lower case, sorted.
+func (g *Graph) Tokens() []string {
+	tokens := make([]string, 0, len(g.names))
+	for token := range g.names {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// Edges returns the edges from token.
+func (g *Graph) Edges(token string) []*Edge {
+	return g.adj[key(token)]
+}
+
+// EdgeCount returns the count of the directed edges.
+func (g *Graph) EdgeCount() int {
+	return g.edges
+}
+
+// FindRoutes finds the loop free routes from src to dst in at most maxSteps steps, 0 for
+// DefaultMaxSteps, over the edges with tracked liquidity above minTracked. Every route
+// has one pair per step, the shorter routes come first.
+func (g *Graph) FindRoutes(src, dst string, maxSteps int, minTracked float64) []*types.TokenRoute {
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	routes := make([]*types.TokenRoute, 0)
+	visited := map[string]bool{key(src): true}
+	path := make([]*Edge, 0, maxSteps)
+	var walk func(node string)
+	walk = func(node string) {
+		if len(path) == maxSteps {
+			return
+		}
+		for _, e := range g.adj[node] {
+			next := key(e.Dst)
+			if visited[next] || (minTracked > 0 && e.Tracked <= minTracked) {
+				continue
+			}
+			path = append(path, e)
+			if next == key(dst) {
+				routes = append(routes, toRoute(path))
+			} else {
+				visited[next] = true
+				walk(next)
+				visited[next] = false
+			}
+			path = path[:len(path)-1]
+		}
+	}
+	walk(key(src))
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Steps) < len(routes[j].Steps)
+	})
+	return routes
+}
+
+func toRoute(path []*Edge) *types.TokenRoute {
+	route := &types.TokenRoute{Steps: make([]types.RouteStep, len(path))}
+	for i, e := range path {
+		route.Steps[i] = types.RouteStep{
+			Src:   e.Src,
+			Dst:   e.Dst,
+			Pairs: []types.RoutePairInfo{e.Pair},
+		}
+	}
+	return route
+}
+
+// Subgraph returns the graph of the tokens within hops steps of the given tokens, with
+// all the edges between them. It returns an error if a given token is not in the graph.
+func (g *Graph) Subgraph(tokens []string, hops int) (*Graph, error) {
+	depth := make(map[string]int)
+	queue := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if _, exist := g.names[key(token)]; !exist {
+			return nil, fmt.Errorf("token %s is not in the graph", token)
+		}
+		if _, seen := depth[key(token)]; !seen {
+			depth[key(token)] = 0
+			queue = append(queue, key(token))
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if depth[node] == hops {
+			continue
+		}
+		for _, e := range g.adj[node] {
+			if _, seen := depth[key(e.Dst)]; !seen {
+				depth[key(e.Dst)] = depth[node] + 1
+				queue = append(queue, key(e.Dst))
+			}
+		}
+	}
+	sub := New()
+	for token := range depth {
+		sub.names[token] = g.names[token]
+		if symbol, exist := g.symbols[token]; exist {
+			sub.symbols[token] = symbol
+		}
+		for _, e := range g.adj[token] {
+			if _, in := depth[key(e.Dst)]; in {
+				sub.AddEdge(e)
+			}
+		}
+	}
+	return sub, nil
+}
+
+// Pools returns one edge per pool, the one from the lower token address, ordered by
+// the tokens, the dex and the pair address.
+func (g *Graph) Pools() []*Edge {
+	pools := make([]*Edge, 0, g.edges/2)
+	seen := make(map[string]bool)
+	for _, token := range g.Tokens() {
+		for _, e := range g.adj[token] {
+			src, dst := key(e.Src), key(e.Dst)
+			if src > dst {
+				src, dst = dst, src
+			}
+			id := strings.Join([]string{src, dst, key(e.Pair.Dex), key(e.Pair.Pair)}, "|")
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			pools = append(pools, e)
+		}
+	}
+	sort.SliceStable(pools, func(i, j int) bool {
+		a, b := pools[i], pools[j]
+		if key(a.Src) != key(b.Src) {
+			return key(a.Src) < key(b.Src)
+		}
+		if key(a.Dst) != key(b.Dst) {
+			return key(a.Dst) < key(b.Dst)
+		}
+		if a.Pair.Dex != b.Pair.Dex {
+			return a.Pair.Dex < b.Pair.Dex
+		}
+		return key(a.Pair.Pair) < key(b.Pair.Pair)
+	})
+	return pools
+}
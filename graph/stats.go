@@ -0,0 +1,270 @@
+package graph
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sort"
+)
+
+// TokenScore is a token with its degree or betweenness.
+type TokenScore struct {
+	Token string  `json:"token"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// DegreeBucket is the count of the tokens with a degree in [Min, Max].
+type DegreeBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// Stats is the shape of the graph, the pools are undirected and the degree of a token
+// is the count of its distinct neighbours.
+type Stats struct {
+	Tokens         int            `json:"tokens"`
+	Pools          int            `json:"pools"`
+	PoolsByDex     map[string]int `json:"pools_by_dex"`
+	TokensByDex    map[string]int `json:"tokens_by_dex"`
+	Components     int            `json:"components"`
+	LargestSize    int            `json:"largest_component"`
+	Isolated       int            `json:"isolated_tokens"`
+	TopDegree      []TokenScore   `json:"top_degree"`
+	TopBetweenness []TokenScore   `json:"top_betweenness"`
+	Degrees        []DegreeBucket `json:"degree_histogram"`
+	Bases          []string       `json:"bases,omitempty"`
+	Unreachable    []string       `json:"unreachable,omitempty"`
+}
+
+// StatsOptions selects the optional parts of the stats.
+type StatsOptions struct {
+	// Top is the count of the hub tokens listed.
+	Top int
+	// Samples is the count of the source tokens of the betweenness, 0 for all the tokens.
+	Samples int
+	// Bases are the tokens the reachability is checked from.
+	Bases []string
+}
+
+// neighbours returns the sorted distinct neighbours of every token, the tokens are
+// indexed in the order of Tokens. A pool links both tokens even if its reverse edge is missing.
+func (g *Graph) neighbours() ([]string, [][]int) {
+	tokens := g.Tokens()
+	index := make(map[string]int, len(tokens))
+	for i, token := range tokens {
+		index[token] = i
+	}
+	sets := make([]map[int]bool, len(tokens))
+	for i := range sets {
+		sets[i] = make(map[int]bool)
+	}
+	for i, token := range tokens {
+		for _, e := range g.adj[token] {
+			if j := index[key(e.Dst)]; j != i {
+				sets[i][j], sets[j][i] = true, true
+			}
+		}
+	}
+	adj := make([][]int, len(tokens))
+	for i, set := range sets {
+		adj[i] = make([]int, 0, len(set))
+		for j := range set {
+			adj[i] = append(adj[i], j)
+		}
+		sort.Ints(adj[i])
+	}
+	return tokens, adj
+}
+
+// unionFind is a disjoint set of the token indexes.
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]]
+		i = uf[i]
+	}
+	return i
+}
+
+func (uf unionFind) union(a, b int) {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra != rb {
+		uf[ra] = rb
+	}
+}
+
+// betweenness is the betweenness centrality of Brandes on the unweighted graph, from
+// samples random sources scaled to all the tokens if samples is below the token count.
+func betweenness(adj [][]int, samples int) []float64 {
+	n := len(adj)
+	score := make([]float64, n)
+	sources := make([]int, n)
+	for i := range sources {
+		sources[i] = i
+	}
+	if samples > 0 && samples < n {
+		// a fixed seed keeps the result of the same graph stable.
+		r := rand.New(rand.NewSource(1))
+		r.Shuffle(n, func(i, j int) { sources[i], sources[j] = sources[j], sources[i] })
+		sources = sources[:samples]
+	}
+	sigma := make([]float64, n)
+	dist := make([]int, n)
+	delta := make([]float64, n)
+	preds := make([][]int, n)
+	stack := make([]int, 0, n)
+	queue := make([]int, 0, n)
+	for _, s := range sources {
+		for i := 0; i < n; i++ {
+			sigma[i], dist[i], delta[i], preds[i] = 0, -1, 0, preds[i][:0]
+		}
+		sigma[s], dist[s] = 1, 0
+		stack, queue = stack[:0], append(queue[:0], s)
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, w := range adj[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				score[w] += delta[w]
+			}
+		}
+	}
+	// every path is counted from both ends in an undirected graph.
+	scale := 0.5 * float64(n) / float64(len(sources))
+	for i := range score {
+		score[i] *= scale
+	}
+	return score
+}
+
+// degreeHistogram buckets the degrees by powers of two: 0, 1, 2, 3-4, 5-8 and so on.
+func degreeHistogram(adj [][]int) []DegreeBucket {
+	counts := make(map[int]int)
+	maxBucket := 0
+	for _, list := range adj {
+		b := 0
+		if len(list) > 0 {
+			b = bits.Len(uint(len(list)-1)) + 1
+		}
+		counts[b]++
+		if b > maxBucket {
+			maxBucket = b
+		}
+	}
+	buckets := make([]DegreeBucket, 0, maxBucket+1)
+	for b := 0; b <= maxBucket; b++ {
+		bucket := DegreeBucket{Count: counts[b]}
+		switch b {
+		case 0, 1:
+			bucket.Min, bucket.Max = b, b
+		default:
+			bucket.Min, bucket.Max = 1<<(b-2)+1, 1<<(b-1)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// topScores returns the top tokens by score, the ties are ordered by token.
+func (g *Graph) topScores(tokens []string, score func(i int) float64, top int) []TokenScore {
+	scores := make([]TokenScore, len(tokens))
+	for i, token := range tokens {
+		scores[i] = TokenScore{Token: token, Name: g.names[token], Score: score(i)}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	if top < len(scores) {
+		scores = scores[:top]
+	}
+	return scores
+}
+
+// Stats reports the counts, the connected components, the hub tokens, the degree
+// histogram and the tokens unreachable from the bases.
+func (g *Graph) Stats(opts StatsOptions) (*Stats, error) {
+	tokens, adj := g.neighbours()
+	stats := &Stats{Tokens: len(tokens), PoolsByDex: make(map[string]int), TokensByDex: make(map[string]int)}
+	dexTokens := make(map[string]map[string]bool)
+	for _, e := range g.Pools() {
+		stats.Pools++
+		stats.PoolsByDex[e.Pair.Dex]++
+		if dexTokens[e.Pair.Dex] == nil {
+			dexTokens[e.Pair.Dex] = make(map[string]bool)
+		}
+		dexTokens[e.Pair.Dex][key(e.Src)], dexTokens[e.Pair.Dex][key(e.Dst)] = true, true
+	}
+	for dex, set := range dexTokens {
+		stats.TokensByDex[dex] = len(set)
+	}
+
+	uf := newUnionFind(len(tokens))
+	for i, list := range adj {
+		for _, j := range list {
+			uf.union(i, j)
+		}
+		if len(list) == 0 {
+			stats.Isolated++
+		}
+	}
+	sizes := make(map[int]int)
+	for i := range tokens {
+		sizes[uf.find(i)]++
+	}
+	stats.Components = len(sizes)
+	for _, size := range sizes {
+		if size > stats.LargestSize {
+			stats.LargestSize = size
+		}
+	}
+
+	stats.TopDegree = g.topScores(tokens, func(i int) float64 { return float64(len(adj[i])) }, opts.Top)
+	between := betweenness(adj, opts.Samples)
+	stats.TopBetweenness = g.topScores(tokens, func(i int) float64 { return between[i] }, opts.Top)
+	stats.Degrees = degreeHistogram(adj)
+
+	if len(opts.Bases) > 0 {
+		reached := make(map[int]bool)
+		for _, base := range opts.Bases {
+			if _, exist := g.names[key(base)]; !exist {
+				return nil, fmt.Errorf("base token %s is not in the graph", base)
+			}
+			stats.Bases = append(stats.Bases, key(base))
+			reached[uf.find(sort.SearchStrings(tokens, key(base)))] = true
+		}
+		stats.Unreachable = make([]string, 0)
+		for i, token := range tokens {
+			if !reached[uf.find(i)] {
+				stats.Unreachable = append(stats.Unreachable, token)
+			}
+		}
+	}
+	return stats, nil
+}
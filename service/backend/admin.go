@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/xueqianLu/routegen/contracts"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/service/param"
+)
+
+// purgeCache drops the cached routes after the graph is changed, and reloads the token
+// index, so the changed pairs are not served until the next refresh.
+func purgeCache() {
+	if b.cache != nil {
+		b.cache.Purge()
+	}
+	go b.loadIndex()
+}
+
+// checkAddresses fails unless all the values are addresses, they are put into nGQL.
+func checkAddresses(values ...string) error {
+	for _, value := range values {
+		if !common.IsHexAddress(value) {
+			return fmt.Errorf("%w (%s)", ErrInvalidAddress, value)
+		}
+	}
+	return nil
+}
+
+func UpsertPair(p param.UpsertPairParam) (*param.MutationResponse, error) {
+	if len(p.Dex) == 0 || len(p.Pair) == 0 || len(p.Token0) == 0 || len(p.Token1) == 0 {
+		return nil, errors.New("dex, pair, token0 and token1 are required")
+	}
+	if err := checkAddresses(p.Pair, p.Token0, p.Token1); err != nil {
+		return nil, err
+	}
+	reserves, err := contracts.ParsePairReserves(p.Reserve0, p.Reserve1, p.Block)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.getDb()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Token0Name) > 0 {
+		if err = database.InsertToken(db, p.Token0Name, p.Token0); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.Token1Name) > 0 {
+		if err = database.InsertToken(db, p.Token1Name, p.Token1); err != nil {
+			return nil, err
+		}
+	}
+	if err = database.UpsertPair(db, p.Dex, p.Pair, p.Fee, p.Tracked, p.Token0, p.Token1, reserves); err != nil {
+		return nil, err
+	}
+	purgeCache()
+	return &param.MutationResponse{Edges: 2}, nil
+}
+
+func UpdatePair(p param.UpdatePairParam) (*param.MutationResponse, error) {
+	if err := checkAddresses(p.Pair); err != nil {
+		return nil, err
+	}
+	reserves, err := contracts.ParsePairReserves(p.Reserve0, p.Reserve1, p.Block)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.getDb()
+	if err != nil {
+		return nil, err
+	}
+	state := database.PairState{Fee: p.Fee, Tracked: p.Tracked, Reserves: reserves, Token0: p.Token0}
+	edges, err := database.UpdatePairState(db, p.Pair, state)
+	purgeCache()
+	if err != nil {
+		return nil, err
+	}
+	return &param.MutationResponse{Edges: edges}, nil
+}
+
+func DeletePair(p param.DeletePairParam) (*param.MutationResponse, error) {
+	if err := checkAddresses(p.Pair); err != nil {
+		return nil, err
+	}
+	db, err := b.getDb()
+	if err != nil {
+		return nil, err
+	}
+	edges, err := database.DeletePair(db, p.Pair)
+	purgeCache()
+	if err != nil {
+		return nil, err
+	}
+	return &param.MutationResponse{Edges: edges}, nil
+}
+
+func DeleteToken(p param.DeleteTokenParam) error {
+	if len(p.Token) == 0 {
+		return errors.New("token is required")
+	}
+	if err := checkAddresses(p.Token); err != nil {
+		return err
+	}
+	db, err := b.getDb()
+	if err != nil {
+		return err
+	}
+	err = database.DeleteToken(db, p.Token)
+	purgeCache()
+	return err
+}
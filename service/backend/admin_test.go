@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/service/param"
+)
+
+// TestAdminNebulaOnly checks that the graph mutations are refused on the other stores
+// without changing them.
+func TestAdminNebulaOnly(t *testing.T) {
+	store, err := database.OpenBoltStore(filepath.Join(t.TempDir(), "routes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err = store.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	saved := b
+	defer func() { b = saved }()
+	b = new(Backend)
+	b.store.Store(database.Store(store))
+
+	const (
+		pair   = "0x00000000000000000000000000000000000000f1"
+		token0 = "0x000000000000000000000000000000000000000a"
+		token1 = "0x000000000000000000000000000000000000000b"
+	)
+	mutations := map[string]func() error{
+		"upsert pair": func() error {
+			_, err := UpsertPair(param.UpsertPairParam{Dex: "dex", Pair: pair, Fee: "30", Tracked: "1",
+				Token0: token0, Token1: token1, Token0Name: "A"})
+			return err
+		},
+		"update pair": func() error {
+			_, err := UpdatePair(param.UpdatePairParam{Pair: pair})
+			return err
+		},
+		"delete pair": func() error {
+			_, err := DeletePair(param.DeletePairParam{Pair: pair})
+			return err
+		},
+		"delete token": func() error {
+			return DeleteToken(param.DeleteTokenParam{Token: token0})
+		},
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrNotNebula) {
+			t.Errorf("%s: got %v, want ErrNotNebula", name, err)
+		}
+	}
+	tokens, err := store.Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("the refused mutations inserted %d tokens", len(tokens))
+	}
+}
+
+// TestAdminInvalidAddress checks that the addresses are checked before they reach nGQL.
+func TestAdminInvalidAddress(t *testing.T) {
+	mutations := map[string]func() error{
+		"upsert pair": func() error {
+			_, err := UpsertPair(param.UpsertPairParam{Dex: "dex", Pair: "0x00000000000000000000000000000000000000f1",
+				Token0: "0x000000000000000000000000000000000000000a", Token1: `0xb" OR 1`})
+			return err
+		},
+		"update pair": func() error {
+			_, err := UpdatePair(param.UpdatePairParam{Pair: "0xp"})
+			return err
+		},
+		"delete pair": func() error {
+			_, err := DeletePair(param.DeletePairParam{Pair: "pair"})
+			return err
+		},
+		"delete token": func() error {
+			return DeleteToken(param.DeleteTokenParam{Token: "0xa"})
+		},
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("%s: got %v, want ErrInvalidAddress", name, err)
+		}
+	}
+}
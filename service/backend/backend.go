@@ -4,31 +4,230 @@ import (
 	"errors"
 	"github.com/xueqianLu/routegen/config"
 	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
 	"github.com/xueqianLu/routegen/service/param"
+	"github.com/xueqianLu/routegen/types"
 	"github.com/zhihu/norm"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSpaceCheckPeriod  = 30 * time.Second
+	defaultRiskRefreshPeriod = 60 * time.Second
+	// closeDelay is the time the queries started on the former space have to finish.
+	closeDelay = 30 * time.Second
 )
 
 var (
 	b *Backend
 )
 
+var (
+	ErrNotNebula      = errors.New("only supported on the nebula store")
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
 type Backend struct {
-	db *norm.DB
+	store atomic.Value // database.Store
+	risks atomic.Value // database.RiskSet
+	// verified is the verified tokens of the token lists.
+	verified atomic.Value // database.VerifiedSet
+	// index is the token search index, it also resolves the symbols of the route queries.
+	index atomic.Value // *database.TokenIndex
+	space string
+	cache *routeCache
 }
 
 func SetupBackend() error {
 	b = new(Backend)
-	db := database.NewDb(config.GetConfig())
-	if db == nil {
+	b.risks.Store(database.RiskSet{})
+	b.verified.Store(database.VerifiedSet{})
+	conf := config.GetConfig()
+	if !database.IsNebula(conf) {
+		store, err := database.OpenStore(conf)
+		if err != nil {
+			return err
+		}
+		b.store.Store(store)
+		log.Infof("backend uses %s store", conf.DbDriver)
+		b.setupTokenSets(conf)
+		b.setupIndex(conf)
+		return b.setupCache(conf)
+	}
+	space, err := database.ActiveSpace(conf)
+	if err != nil {
+		return err
+	}
+	store, err := database.OpenNebulaStore(conf, space)
+	if err != nil {
 		return errors.New("create db failed")
 	}
-	b.db = db
+	b.store.Store(database.Store(store))
+	b.space = space
+	log.Infof("backend uses space %s", space)
+	b.setupTokenSets(conf)
+	b.setupIndex(conf)
+	if err = b.setupCache(conf); err != nil {
+		return err
+	}
+	if len(conf.DbControlSpace) > 0 {
+		period := time.Duration(conf.SpaceCheckPeriod) * time.Second
+		if period <= 0 {
+			period = defaultSpaceCheckPeriod
+		}
+		go b.watchSpace(conf, period)
+	}
+	return nil
+}
+
+func (b *Backend) setupCache(conf *config.Config) error {
+	if conf.RouteCacheSize > 0 {
+		cache, err := newRouteCache(conf.RouteCacheSize, time.Duration(conf.RouteCacheTTL)*time.Second, conf.AsymmetricRoutes)
+		if err != nil {
+			return err
+		}
+		b.cache = cache
+	}
 	return nil
 }
 
-func QueryRoute(query param.QueryRouteParam) *param.QueryRouteResponse {
-	paths := database.QueryRoute(b.db, query.Token0, query.Token1)
+func (b *Backend) getStore() database.Store {
+	return b.store.Load().(database.Store)
+}
+
+func (b *Backend) getRisks() database.RiskSet {
+	return b.risks.Load().(database.RiskSet)
+}
+
+func (b *Backend) getVerified() database.VerifiedSet {
+	return b.verified.Load().(database.VerifiedSet)
+}
+
+// setupTokenSets loads the token risks and the verified tokens, and reloads them every
+// risk_refresh_period.
+func (b *Backend) setupTokenSets(conf *config.Config) {
+	b.loadTokenSets()
+	period := time.Duration(conf.RiskRefresh) * time.Second
+	if period <= 0 {
+		period = defaultRiskRefreshPeriod
+	}
+	go b.watchTokenSets(period)
+}
+
+func (b *Backend) watchTokenSets(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.loadTokenSets()
+	}
+}
+
+// loadTokenSets reloads the token risks and the verified tokens of the store, the former
+// sets are kept on error.
+func (b *Backend) loadTokenSets() {
+	risks, err := database.LoadRiskSet(b.getStore())
+	if err != nil {
+		log.WithField("err", err).Error("load token risks failed")
+	} else {
+		b.risks.Store(risks)
+	}
+	verified, err := database.LoadVerifiedSet(b.getStore())
+	if err != nil {
+		log.WithField("err", err).Error("load verified tokens failed")
+	} else {
+		b.verified.Store(verified)
+	}
+}
+
+// getDb returns the nebula connection for the nebula only features.
+func (b *Backend) getDb() (*norm.DB, error) {
+	if store, ok := b.getStore().(*database.NebulaStore); ok {
+		return store.DB(), nil
+	}
+	return nil, ErrNotNebula
+}
+
+// watchSpace polls the active space in the control space, and switches to it when it changes.
+func (b *Backend) watchSpace(conf *config.Config, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		space, err := database.ActiveSpace(conf)
+		if err != nil {
+			log.WithField("err", err).Error("get active space failed")
+			continue
+		}
+		if space == b.space {
+			continue
+		}
+		store, err := database.OpenNebulaStore(conf, space)
+		if err != nil {
+			log.WithField("err", err).WithField("space", space).Error("connect active space failed")
+			continue
+		}
+		old := b.getStore()
+		b.store.Store(database.Store(store))
+		if b.cache != nil {
+			b.cache.Purge()
+		}
+		log.Infof("backend switched from space %s to %s", b.space, space)
+		b.space = space
+		b.loadTokenSets()
+		go b.loadIndex()
+		time.AfterFunc(closeDelay, old.Close)
+	}
+}
+
+func findRoute(token0, token1 string, minTracked float64) ([]*types.TokenRoute, error) {
+	paths, err := b.getStore().QueryRoutes(token0, token1, 0, minTracked)
+	if err != nil {
+		log.WithField("err", err).Error("query route failed")
+		return nil, err
+	}
+	return paths, nil
+}
+
+func queryRoute(token0, token1 string, minTracked float64) ([]*types.TokenRoute, error) {
+	// the cache only keeps the unfiltered routes.
+	if b.cache == nil || minTracked > 0 {
+		return findRoute(token0, token1, minTracked)
+	}
+	if paths, ok := b.cache.Get(token0, token1); ok {
+		return paths, nil
+	}
+	paths, err := findRoute(token0, token1, 0)
+	if err != nil {
+		// a failed lookup is not cached, the next query asks the store again.
+		return nil, err
+	}
+	b.cache.Add(token0, token1, paths)
+	return paths, nil
+}
+
+// QueryRoute returns the routes of the query, the tokens are addresses or symbols that
+// resolve to one token.
+func QueryRoute(query param.QueryRouteParam) (*param.QueryRouteResponse, error) {
+	index := b.getIndex()
+	token0, err := index.Resolve(query.Token0)
+	if err != nil {
+		return nil, err
+	}
+	token1, err := index.Resolve(query.Token1)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := queryRoute(token0, token1, query.MinTracked)
+	if err != nil {
+		return nil, err
+	}
+	if !query.IncludeRisky {
+		paths = b.getRisks().FilterRoutes(paths)
+	}
+	if query.VerifiedOnly {
+		paths = b.getVerified().FilterRoutes(paths)
+	}
 	result := new(param.QueryRouteResponse)
 	result.Routes = paths
-	return result
+	return result, nil
 }
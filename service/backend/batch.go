@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/service/param"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	// maxBatchQueries is the most queries of a batch.
+	maxBatchQueries     = 100
+	defaultBatchWorkers = 8
+)
+
+// QueryRoutes runs the queries of the batch on at most route_batch_workers goroutines,
+// and returns the results in the order of the queries. A query that fails has its error
+// in its result, the others are not affected.
+func QueryRoutes(batch param.BatchRouteParam) (*param.BatchRouteResponse, error) {
+	if len(batch.Queries) == 0 {
+		return nil, errors.New("no queries")
+	}
+	if len(batch.Queries) > maxBatchQueries {
+		return nil, fmt.Errorf("%d queries, at most %d in a batch", len(batch.Queries), maxBatchQueries)
+	}
+	workers := config.GetConfig().BatchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	if workers > len(batch.Queries) {
+		workers = len(batch.Queries)
+	}
+	results := make([]param.BatchRouteResult, len(batch.Queries))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				results[n] = batchQuery(batch.Queries[n])
+			}
+		}()
+	}
+	for n := range batch.Queries {
+		queue <- n
+	}
+	close(queue)
+	wg.Wait()
+	return &param.BatchRouteResponse{Results: results}, nil
+}
+
+// batchQuery runs one query of the batch, a panic of the query fails its result only.
+func batchQuery(query param.QueryRouteParam) (result param.BatchRouteResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("panic", r).Errorf("route query %s -> %s panicked\n%s", query.Token0, query.Token1, debug.Stack())
+			result = param.BatchRouteResult{Error: fmt.Sprintf("query failed: %v", r)}
+		}
+	}()
+	if len(query.Token0) == 0 || len(query.Token1) == 0 {
+		return param.BatchRouteResult{Error: "token0 and token1 are required"}
+	}
+	res, err := QueryRoute(query)
+	if err != nil {
+		return param.BatchRouteResult{Error: err.Error()}
+	}
+	return param.BatchRouteResult{Routes: res.Routes}
+}
@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/graph"
+	"github.com/xueqianLu/routegen/service/param"
+	"github.com/xueqianLu/routegen/types"
+)
+
+const (
+	batchTokenA = "0x000000000000000000000000000000000000000a"
+	batchTokenB = "0x000000000000000000000000000000000000000b"
+	// batchFailing fails in the store, batchPanic panics in it.
+	batchFailing = "0x00000000000000000000000000000000000000ee"
+	batchPanic   = "0x00000000000000000000000000000000000000ff"
+)
+
+// batchStore answers the route queries without a database.
+type batchStore struct {
+	database.Store
+}
+
+func (batchStore) QueryRoutes(token0, token1 string, maxSteps int, minTracked float64) ([]*types.TokenRoute, error) {
+	switch token1 {
+	case batchFailing:
+		return nil, errors.New("store unavailable")
+	case batchPanic:
+		panic("broken route")
+	}
+	route := &types.TokenRoute{Steps: []types.RouteStep{{
+		Src:   token0,
+		Dst:   token1,
+		Pairs: []types.RoutePairInfo{{Pair: "0x00000000000000000000000000000000000000f1", Fee: "30", Dex: "dex"}},
+	}}}
+	return []*types.TokenRoute{route}, nil
+}
+
+func setupBatchBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := ioutil.WriteFile(path, []byte("route_batch_workers = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.ParseConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	saved := b
+	t.Cleanup(func() { b = saved })
+	b = new(Backend)
+	b.store.Store(database.Store(batchStore{}))
+	b.risks.Store(database.RiskSet{})
+	b.verified.Store(database.VerifiedSet{})
+	b.index.Store(database.NewTokenIndex(nil, graph.New(), nil))
+}
+
+func TestQueryRoutesItemErrors(t *testing.T) {
+	setupBatchBackend(t)
+	batch := param.BatchRouteParam{Queries: []param.QueryRouteParam{
+		{Token0: batchTokenA, Token1: batchTokenB},
+		{Token0: batchTokenA, Token1: batchFailing},
+		{Token0: batchTokenA, Token1: batchPanic},
+		{Token0: batchTokenA},
+		{Token0: batchTokenB, Token1: batchTokenA},
+	}}
+	res, err := QueryRoutes(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != len(batch.Queries) {
+		t.Fatalf("got %d results for %d queries", len(res.Results), len(batch.Queries))
+	}
+	for _, i := range []int{0, 4} {
+		r := res.Results[i]
+		if len(r.Error) > 0 || len(r.Routes) != 1 || r.Routes[0].Steps[0].Src != batch.Queries[i].Token0 {
+			t.Fatalf("query %d: got %+v", i, r)
+		}
+	}
+	wantErrors := map[int]string{
+		1: "store unavailable",
+		2: "query failed: broken route",
+		3: "token0 and token1 are required",
+	}
+	for i, want := range wantErrors {
+		if r := res.Results[i]; r.Error != want || len(r.Routes) != 0 {
+			t.Fatalf("query %d: got %+v, want error %q", i, r, want)
+		}
+	}
+}
+
+func TestQueryRoutesLimits(t *testing.T) {
+	setupBatchBackend(t)
+	if _, err := QueryRoutes(param.BatchRouteParam{}); err == nil {
+		t.Fatal("an empty batch should fail")
+	}
+	queries := make([]param.QueryRouteParam, maxBatchQueries+1)
+	if _, err := QueryRoutes(param.BatchRouteParam{Queries: queries}); err == nil {
+		t.Fatal("a batch over the limit should fail")
+	}
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/xueqianLu/routegen/types"
+	"time"
+)
+
+type cachedRoutes struct {
+	routes  []*types.TokenRoute
+	expires time.Time
+}
+
+// routeCache caches the routes of token pairs, the reverse routes are derived and
+// cached together unless asymmetric is set.
+type routeCache struct {
+	cache      *lru.Cache
+	ttl        time.Duration
+	asymmetric bool
+}
+
+func newRouteCache(size int, ttl time.Duration, asymmetric bool) (*routeCache, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &routeCache{cache: cache, ttl: ttl, asymmetric: asymmetric}, nil
+}
+
+func routeCacheKey(token0, token1 string) string {
+	return token0 + "-" + token1
+}
+
+func (c *routeCache) Get(token0, token1 string) ([]*types.TokenRoute, bool) {
+	v, ok := c.cache.Get(routeCacheKey(token0, token1))
+	if !ok {
+		return nil, false
+	}
+	cached := v.(*cachedRoutes)
+	if c.ttl > 0 && time.Now().After(cached.expires) {
+		c.cache.Remove(routeCacheKey(token0, token1))
+		return nil, false
+	}
+	return cached.routes, true
+}
+
+func (c *routeCache) Add(token0, token1 string, routes []*types.TokenRoute) {
+	expires := time.Now().Add(c.ttl)
+	c.cache.Add(routeCacheKey(token0, token1), &cachedRoutes{routes: routes, expires: expires})
+	if c.asymmetric {
+		return
+	}
+	reversed := make([]*types.TokenRoute, len(routes))
+	for i, route := range routes {
+		reversed[i] = types.ReverseRoute(route)
+	}
+	c.cache.Add(routeCacheKey(token1, token0), &cachedRoutes{routes: reversed, expires: expires})
+}
+
+// Purge drops all the cached routes, the routes are stale after the space is switched.
+func (c *routeCache) Purge() {
+	c.cache.Purge()
+}
@@ -0,0 +1,235 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/graph"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/service/param"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultIndexRefreshPeriod = 300 * time.Second
+	defaultSearchLimit        = 20
+	maxSearchLimit            = 100
+	defaultPageLimit          = 50
+	maxPageLimit              = 500
+)
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+func (b *Backend) getIndex() *database.TokenIndex {
+	return b.index.Load().(*database.TokenIndex)
+}
+
+// setupIndex loads the token index in the background, the searches find nothing until
+// it is loaded, and reloads it every token_index_refresh_period.
+func (b *Backend) setupIndex(conf *config.Config) {
+	b.index.Store(database.NewTokenIndex(nil, graph.New(), nil))
+	period := time.Duration(conf.IndexRefresh) * time.Second
+	if period <= 0 {
+		period = defaultIndexRefreshPeriod
+	}
+	go b.watchIndex(period)
+}
+
+func (b *Backend) watchIndex(period time.Duration) {
+	b.loadIndex()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.loadIndex()
+	}
+}
+
+// loadIndex reloads the token index of the store, the former index is kept on error.
+func (b *Backend) loadIndex() {
+	index, err := database.LoadTokenIndex(b.getStore())
+	if err != nil {
+		log.WithField("err", err).Error("load token index failed")
+		return
+	}
+	b.index.Store(index)
+	log.Infof("token index loaded with %d tokens", index.Len())
+}
+
+// SearchTokens returns the tokens matching q, limit defaults to 20 and is at most 100.
+func SearchTokens(q string, limit int) *param.TokenSearchResponse {
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	return &param.TokenSearchResponse{Tokens: b.getIndex().Search(q, limit)}
+}
+
+// addressVariants returns the address as given, in lower case and checksummed, the
+// stores keep the case of the imported data.
+func addressVariants(address string) []string {
+	variants := make([]string, 0, 3)
+	for _, variant := range []string{address, strings.ToLower(address), common.HexToAddress(address).Hex()} {
+		if !contains(variants, variant) {
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenPairs returns the address of the token as stored and its pair edges, the deepest
+// pools first. The token is not found if it is neither in the index nor in a pool.
+func tokenPairs(address string) (string, []database.PairRecord, error) {
+	if !common.IsHexAddress(address) {
+		return "", nil, fmt.Errorf("%w (%s)", ErrInvalidAddress, address)
+	}
+	variants := addressVariants(address)
+	entry, indexed := b.getIndex().Get(address)
+	if indexed {
+		variants = append([]string{entry.Address}, variants...)
+	}
+	for _, variant := range variants {
+		pairs, err := b.getStore().TokenPairs(variant)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(pairs) > 0 {
+			sort.Slice(pairs, func(i, j int) bool {
+				if pairs[i].Tracked != pairs[j].Tracked {
+					return pairs[i].Tracked > pairs[j].Tracked
+				}
+				return strings.ToLower(pairs[i].Pair) < strings.ToLower(pairs[j].Pair)
+			})
+			return variant, pairs, nil
+		}
+	}
+	if indexed {
+		return entry.Address, []database.PairRecord{}, nil
+	}
+	return "", nil, fmt.Errorf("%w (%s)", ErrTokenNotFound, address)
+}
+
+// GetToken returns the token with its metadata, its risk flag and its pools.
+func GetToken(address string) (*param.TokenResponse, error) {
+	token, pairs, err := tokenPairs(address)
+	if err != nil {
+		return nil, err
+	}
+	index := b.getIndex()
+	result := &param.TokenResponse{Address: token}
+	if entry, exist := index.Get(token); exist {
+		result.Name = entry.Name
+	}
+	if info, exist := index.Info(token); exist {
+		result.Info = &info
+	}
+	if risk, exist := b.getRisks().Get(token); exist {
+		result.Risk = &risk
+	}
+	neighbours := make(map[string]bool)
+	for _, pair := range pairs {
+		neighbours[strings.ToLower(pair.Dst)] = true
+		result.Liquidity += pair.Tracked
+	}
+	result.Degree, result.Pools = len(neighbours), len(pairs)
+	return result, nil
+}
+
+// GetTokenPairs returns the page of the pair edges from the token at offset, limit
+// defaults to 50 and is at most 500.
+func GetTokenPairs(address string, offset, limit int) (*param.TokenPairsResponse, error) {
+	if offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	token, pairs, err := tokenPairs(address)
+	if err != nil {
+		return nil, err
+	}
+	result := &param.TokenPairsResponse{Token: token, Total: len(pairs), Offset: offset, Limit: limit}
+	if offset > len(pairs) {
+		offset = len(pairs)
+	}
+	end := offset + limit
+	if end > len(pairs) {
+		end = len(pairs)
+	}
+	result.Pairs = pairs[offset:end]
+	return result, nil
+}
+
+// pairToken returns the token with its name, symbol and decimals of the index.
+func pairToken(index *database.TokenIndex, address string) param.PairToken {
+	token := param.PairToken{Address: address}
+	if entry, exist := index.Get(address); exist {
+		token.Name, token.Symbol, token.Decimals = entry.Name, entry.Symbol, entry.Decimals
+	}
+	return token
+}
+
+// GetPair returns the pool of the pair address with its tokens and state.
+func GetPair(address string) (*param.PairResponse, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("%w (%s)", ErrInvalidAddress, address)
+	}
+	var edges []database.PairRecord
+	for _, variant := range addressVariants(address) {
+		var err error
+		if edges, err = b.getStore().PairEdges(variant); err != nil {
+			return nil, err
+		}
+		if len(edges) > 0 {
+			break
+		}
+	}
+	if len(edges) == 0 {
+		return nil, fmt.Errorf("%w (%s)", database.ErrPairNotFound, address)
+	}
+	// the edge from the lower address has the reserves in the order of the pool.
+	edge := edges[0]
+	for _, e := range edges {
+		if strings.ToLower(e.Src) < strings.ToLower(e.Dst) {
+			edge = e
+			break
+		}
+	}
+	reserve0, reserve1 := edge.Reserve0, edge.Reserve1
+	token0, token1 := edge.Src, edge.Dst
+	if strings.ToLower(token0) > strings.ToLower(token1) {
+		token0, token1, reserve0, reserve1 = token1, token0, reserve1, reserve0
+	}
+	index := b.getIndex()
+	return &param.PairResponse{
+		Pair:     edge.Pair,
+		Dex:      edge.Dex,
+		Fee:      edge.Fee,
+		Tracked:  edge.Tracked,
+		Token0:   pairToken(index, token0),
+		Token1:   pairToken(index, token1),
+		Reserve0: reserve0,
+		Reserve1: reserve1,
+		Block:    edge.Block,
+		Edges:    len(edges),
+	}, nil
+}
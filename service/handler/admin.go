@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/xueqianLu/routegen/config"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/service/backend"
+	"github.com/xueqianLu/routegen/service/param"
+)
+
+const AdminTokenHeader = "X-Admin-Token"
+
+// Admin serves the endpoints that change the graph, they are disabled if admin_token is not set.
+// They change the nebula space in place, so they are only supported on the nebula store,
+// the sqlite, postgres and bolt stores are rebuilt with import instead.
+type Admin struct {
+	BaseController
+}
+
+func (a *Admin) Prepare() {
+	token := config.GetConfig().AdminToken
+	given := a.Ctx.Input.Header(AdminTokenHeader)
+	if len(token) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(given)) != 1 {
+		a.Ctx.Output.SetStatus(401)
+		a.ResponseError(401, "unauthorized")
+		a.StopRun()
+	}
+}
+
+func (a *Admin) parse(v interface{}) bool {
+	if err := json.Unmarshal(a.Ctx.Input.RequestBody, v); err != nil {
+		log.Error(err)
+		a.ResponseError(500, "parse param failed")
+		return false
+	}
+	return true
+}
+
+// respond serves the result, or the error with 400 for an invalid address, 501 if the
+// backend store is not nebula and 500 for the others.
+func (a *Admin) respond(result interface{}, err error) {
+	switch {
+	case err == nil:
+		a.ResponseInfo(200, nil, result)
+	case errors.Is(err, backend.ErrInvalidAddress):
+		a.ResponseError(400, err.Error())
+	case errors.Is(err, backend.ErrNotNebula):
+		a.ResponseError(501, err.Error())
+	default:
+		log.WithField("err", err).Error("admin request failed")
+		a.ResponseError(500, err.Error())
+	}
+}
+
+func (a *Admin) UpsertPair() {
+	var p param.UpsertPairParam
+	if a.parse(&p) {
+		a.respond(backend.UpsertPair(p))
+	}
+}
+
+func (a *Admin) UpdatePair() {
+	var p param.UpdatePairParam
+	if a.parse(&p) {
+		a.respond(backend.UpdatePair(p))
+	}
+}
+
+func (a *Admin) DeletePair() {
+	var p param.DeletePairParam
+	if a.parse(&p) {
+		a.respond(backend.DeletePair(p))
+	}
+}
+
+func (a *Admin) DeleteToken() {
+	var p param.DeleteTokenParam
+	if a.parse(&p) {
+		a.respond(nil, backend.DeleteToken(p))
+	}
+}
@@ -19,3 +19,10 @@ func (d *BaseController) ResponseInfo(code int, errMsg interface{}, result inter
 	}
 	d.ServeJSON()
 }
+
+// ResponseError responds the error with its own code, the route endpoints keep reporting
+// every error as 500 with ResponseInfo.
+func (d *BaseController) ResponseError(code int, errMsg interface{}) {
+	d.Data["json"] = map[string]interface{}{"code": code, "err_msg": errMsg}
+	d.ServeJSON()
+}
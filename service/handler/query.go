@@ -21,7 +21,11 @@ func (q *RouteQuery) Route() {
 		q.ResponseInfo(500, "parse param failed", nil)
 		return
 	}
-	result := backend.QueryRoute(query)
+	result, err := backend.QueryRoute(query)
+	if err != nil {
+		q.ResponseInfo(500, err.Error(), nil)
+		return
+	}
 	q.ResponseInfo(200, nil, result)
 }
 
@@ -33,11 +37,33 @@ func (q *RouteQuery) MergedRoute() {
 		q.ResponseInfo(500, "parse param failed", nil)
 		return
 	}
-	result := backend.QueryRoute(query)
+	result, err := backend.QueryRoute(query)
+	if err != nil {
+		q.ResponseInfo(500, err.Error(), nil)
+		return
+	}
 	// todo: add route merge filter
 	q.ResponseInfo(200, nil, result)
 }
 
+// BatchRoute runs the route queries of the batch concurrently, a query that fails has
+// its error in its result.
+func (q *RouteQuery) BatchRoute() {
+	var batch param.BatchRouteParam
+	data := q.Ctx.Input.RequestBody
+	if err := json.Unmarshal(data, &batch); err != nil {
+		logs.Error(err)
+		q.ResponseInfo(500, "parse param failed", nil)
+		return
+	}
+	result, err := backend.QueryRoutes(batch)
+	if err != nil {
+		q.ResponseInfo(500, err.Error(), nil)
+		return
+	}
+	q.ResponseInfo(200, nil, result)
+}
+
 func (q *RouteQuery) Version() {
 	q.ResponseInfo(200, nil, "1.0.0")
 }
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/log"
+	"github.com/xueqianLu/routegen/service/backend"
+)
+
+// Tokens serves the token and pair lookups of the token pickers and the route debugging.
+type Tokens struct {
+	BaseController
+}
+
+// Search finds the tokens by address, symbol or name, q is the text and limit the count
+// of the tokens returned.
+func (t *Tokens) Search() {
+	q := t.GetString("q")
+	if len(q) == 0 {
+		t.ResponseError(400, "q is required")
+		return
+	}
+	limit, err := t.GetInt("limit", 0)
+	if err != nil {
+		t.ResponseError(400, "invalid limit")
+		return
+	}
+	t.ResponseInfo(200, nil, backend.SearchTokens(q, limit))
+}
+
+// respond serves the result, or the error with 400 for an invalid address, 404 for an
+// unknown token or pair and 500 for the others.
+func (t *Tokens) respond(result interface{}, err error) {
+	switch {
+	case err == nil:
+		t.ResponseInfo(200, nil, result)
+	case errors.Is(err, backend.ErrInvalidAddress):
+		t.ResponseError(400, err.Error())
+	case errors.Is(err, backend.ErrTokenNotFound), errors.Is(err, database.ErrPairNotFound):
+		t.ResponseError(404, err.Error())
+	default:
+		log.WithField("err", err).Error("token request failed")
+		t.ResponseError(500, err.Error())
+	}
+}
+
+// Token returns the token of the address with its metadata and degree.
+func (t *Tokens) Token() {
+	t.respond(backend.GetToken(t.Ctx.Input.Param(":address")))
+}
+
+// TokenPairs returns a page of the pools of the token, offset and limit select the page.
+func (t *Tokens) TokenPairs() {
+	offset, err := t.GetInt("offset", 0)
+	if err != nil {
+		t.ResponseError(400, "invalid offset")
+		return
+	}
+	limit, err := t.GetInt("limit", 0)
+	if err != nil {
+		t.ResponseError(400, "invalid limit")
+		return
+	}
+	t.respond(backend.GetTokenPairs(t.Ctx.Input.Param(":address"), offset, limit))
+}
+
+// Pair returns the pool of the address with its tokens and state.
+func (t *Tokens) Pair() {
+	t.respond(backend.GetPair(t.Ctx.Input.Param(":address")))
+}
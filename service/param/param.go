@@ -1,12 +1,127 @@
 package param
 
-import "github.com/xueqianLu/routegen/types"
+import (
+	"github.com/xueqianLu/routegen/database"
+	"github.com/xueqianLu/routegen/types"
+)
 
+// QueryRouteParam is a route query, the tokens are addresses, or symbols of the imported
+// token lists that resolve to one token.
 type QueryRouteParam struct {
 	Token0 string `json:"token0"`
 	Token1 string `json:"token1"`
+	// MinTracked only routes over the pairs with more tracked liquidity, 0 for all pairs.
+	MinTracked float64 `json:"min_tracked,omitempty"`
+	// IncludeRisky keeps the routes through the tokens flagged as risky, they are excluded by default.
+	IncludeRisky bool `json:"include_risky,omitempty"`
+	// VerifiedOnly only keeps the routes through the tokens verified by an imported token list.
+	VerifiedOnly bool `json:"verified_only,omitempty"`
 }
 
 type QueryRouteResponse struct {
 	Routes []*types.TokenRoute `json:"routes"`
 }
+
+// BatchRouteParam is the route queries of a batch, at most 100.
+type BatchRouteParam struct {
+	Queries []QueryRouteParam `json:"queries"`
+}
+
+// BatchRouteResult is the routes of a query of the batch, or the error that failed it.
+type BatchRouteResult struct {
+	Routes []*types.TokenRoute `json:"routes"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// BatchRouteResponse is the results in the order of the queries.
+type BatchRouteResponse struct {
+	Results []BatchRouteResult `json:"results"`
+}
+
+// TokenSearchResponse is the tokens found, the best matches first.
+type TokenSearchResponse struct {
+	Tokens []database.TokenEntry `json:"tokens"`
+}
+
+// TokenResponse is a token with its metadata and its pools in the graph, Info is the
+// metadata of the token lists and Risk the risk flag, if the token has them.
+type TokenResponse struct {
+	Address string              `json:"address"`
+	Name    string              `json:"name"`
+	Info    *database.TokenInfo `json:"info,omitempty"`
+	Risk    *database.TokenRisk `json:"risk,omitempty"`
+	// Degree is the count of the tokens the token has a pool with.
+	Degree    int     `json:"degree"`
+	Pools     int     `json:"pools"`
+	Liquidity float64 `json:"liquidity"`
+}
+
+// TokenPairsResponse is a page of the pair edges from a token, the deepest pools first.
+type TokenPairsResponse struct {
+	Token  string                `json:"token"`
+	Total  int                   `json:"total"`
+	Offset int                   `json:"offset"`
+	Limit  int                   `json:"limit"`
+	Pairs  []database.PairRecord `json:"pairs"`
+}
+
+// PairToken is a token of a pair, the symbol and decimals come from the token lists.
+type PairToken struct {
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"`
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+// PairResponse is a pool with its tokens and state, token0 is the lower address and
+// reserve0 its reserve. Edges is the count of the pair edges, 2 for a pool routable both ways.
+type PairResponse struct {
+	Pair     string    `json:"pair"`
+	Dex      string    `json:"dex"`
+	Fee      int64     `json:"fee"`
+	Tracked  float64   `json:"tracked"`
+	Token0   PairToken `json:"token0"`
+	Token1   PairToken `json:"token1"`
+	Reserve0 string    `json:"reserve0,omitempty"`
+	Reserve1 string    `json:"reserve1,omitempty"`
+	Block    int64     `json:"block,omitempty"`
+	Edges    int       `json:"edges"`
+}
+
+type UpsertPairParam struct {
+	Dex        string `json:"dex"`
+	Pair       string `json:"pair"`
+	Fee        string `json:"fee"`
+	Tracked    string `json:"tracked"`
+	Token0     string `json:"token0"`
+	Token1     string `json:"token1"`
+	Token0Name string `json:"token0_name,omitempty"`
+	Token1Name string `json:"token1_name,omitempty"`
+	Reserve0   string `json:"reserve0,omitempty"`
+	Reserve1   string `json:"reserve1,omitempty"`
+	Block      uint64 `json:"block,omitempty"`
+}
+
+// UpdatePairParam updates the state of a pair, the empty fields are kept unchanged,
+// reserve0 and reserve1 are the reserves of token0.
+type UpdatePairParam struct {
+	Pair     string  `json:"pair"`
+	Fee      *string `json:"fee,omitempty"`
+	Tracked  *string `json:"tracked,omitempty"`
+	Token0   string  `json:"token0,omitempty"`
+	Reserve0 string  `json:"reserve0,omitempty"`
+	Reserve1 string  `json:"reserve1,omitempty"`
+	Block    uint64  `json:"block,omitempty"`
+}
+
+type DeletePairParam struct {
+	Pair string `json:"pair"`
+}
+
+type DeleteTokenParam struct {
+	Token string `json:"token"`
+}
+
+type MutationResponse struct {
+	Edges int `json:"edges"`
+}
@@ -11,5 +11,14 @@ func init() {
 	log.Info("init router")
 	beego.Router("/defiroute/api/v1/route", &handler.RouteQuery{}, "post:Route")
 	beego.Router("/defiroute/api/v1/mergedroute", &handler.RouteQuery{}, "post:MergedRoute")
+	beego.Router("/defiroute/api/v1/route/batch", &handler.RouteQuery{}, "post:BatchRoute")
 	beego.Router("/defiroute/api/v1/version", &handler.RouteQuery{}, "get:Version")
+	beego.Router("/defiroute/api/v1/tokens/search", &handler.Tokens{}, "get:Search")
+	beego.Router("/defiroute/api/v1/tokens/:address", &handler.Tokens{}, "get:Token")
+	beego.Router("/defiroute/api/v1/tokens/:address/pairs", &handler.Tokens{}, "get:TokenPairs")
+	beego.Router("/defiroute/api/v1/pairs/:address", &handler.Tokens{}, "get:Pair")
+	beego.Router("/defiroute/api/v1/admin/pair/upsert", &handler.Admin{}, "post:UpsertPair")
+	beego.Router("/defiroute/api/v1/admin/pair/update", &handler.Admin{}, "post:UpdatePair")
+	beego.Router("/defiroute/api/v1/admin/pair/delete", &handler.Admin{}, "post:DeletePair")
+	beego.Router("/defiroute/api/v1/admin/token/delete", &handler.Admin{}, "post:DeleteToken")
 }
@@ -0,0 +1,91 @@
+package types
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const feeDenominator = 10000
+
+// QuoteSnapshot is the quote of a route for one reference input size, computed
+// from the reserves stored with the pairs.
+type QuoteSnapshot struct {
+	Size        float64 `json:"size"`
+	AmountIn    string  `json:"amount_in"`
+	AmountOut   string  `json:"amount_out"`
+	PriceImpact float64 `json:"price_impact"`
+	Block       int64   `json:"block"`
+}
+
+// FeeBps returns the swap fee of the pair in basis points.
+func (p RoutePairInfo) FeeBps() (int64, bool) {
+	fee, err := strconv.ParseInt(p.Fee, 10, 64)
+	if err != nil || fee < 0 || fee >= feeDenominator {
+		return 0, false
+	}
+	return fee, true
+}
+
+// ReservesFor returns the reserves of the input and output token when swapping src through the pair.
+func (p RoutePairInfo) ReservesFor(src string) (*big.Int, *big.Int, bool) {
+	reserve0, ok0 := new(big.Int).SetString(p.Reserve0, 10)
+	reserve1, ok1 := new(big.Int).SetString(p.Reserve1, 10)
+	if !ok0 || !ok1 || reserve0.Sign() <= 0 || reserve1.Sign() <= 0 || len(p.Token0) == 0 {
+		return nil, nil, false
+	}
+	if strings.EqualFold(src, p.Token0) {
+		return reserve0, reserve1, true
+	}
+	return reserve1, reserve0, true
+}
+
+// GetAmountOut is the output amount of an uniswap v2 like pair with feeBps.
+func GetAmountOut(amountIn, reserveIn, reserveOut *big.Int, feeBps int64) *big.Int {
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(feeDenominator-feeBps))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(feeDenominator))
+	denominator.Add(denominator, amountInWithFee)
+	return numerator.Div(numerator, denominator)
+}
+
+// QuoteRoute swaps amountIn along the route, every step uses the pair with the best output.
+// It returns the output amount, the price impact against the mid price after fees and
+// the oldest block of the used reserves, ok is false if a step has no pair with reserves.
+func QuoteRoute(r *TokenRoute, amountIn *big.Int) (amountOut *big.Int, impact float64, block int64, ok bool) {
+	amount := new(big.Int).Set(amountIn)
+	mid := new(big.Float).SetInt(amountIn)
+	for _, step := range r.Steps {
+		var best *big.Int
+		var bestMid *big.Float
+		var bestBlock int64
+		for _, pair := range step.Pairs {
+			reserveIn, reserveOut, exist := pair.ReservesFor(step.Src)
+			fee, feeOk := pair.FeeBps()
+			if !exist || !feeOk {
+				continue
+			}
+			out := GetAmountOut(amount, reserveIn, reserveOut, fee)
+			if best == nil || out.Cmp(best) > 0 {
+				best = out
+				price := new(big.Float).Quo(new(big.Float).SetInt(reserveOut), new(big.Float).SetInt(reserveIn))
+				price.Mul(price, big.NewFloat(float64(feeDenominator-fee)/feeDenominator))
+				bestMid = price
+				bestBlock = pair.Block
+			}
+		}
+		if best == nil {
+			return nil, 0, 0, false
+		}
+		amount = best
+		mid.Mul(mid, bestMid)
+		if block == 0 || (bestBlock > 0 && bestBlock < block) {
+			block = bestBlock
+		}
+	}
+	if mid.Sign() > 0 {
+		ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), mid).Float64()
+		impact = 1 - ratio
+	}
+	return amount, impact, block, true
+}
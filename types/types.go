@@ -24,12 +24,28 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 )
 
 type RoutePairInfo struct {
-	Pair string `json:"pair"`
-	Fee  string `json:"fee"`
-	Dex  string `json:"dex"`
+	Pair     string `json:"pair"`
+	Fee      string `json:"fee"`
+	Dex      string `json:"dex"`
+	Tracked  string `json:"-"`
+	Token0   string `json:"token0,omitempty"`
+	Reserve0 string `json:"reserve0,omitempty"`
+	Reserve1 string `json:"reserve1,omitempty"`
+	Block    int64  `json:"block,omitempty"`
+}
+
+// Liquidity returns the tracked liquidity of the pair, 0 if it is unknown.
+func (p RoutePairInfo) Liquidity() float64 {
+	v, err := strconv.ParseFloat(p.Tracked, 64)
+	if err != nil {
+		return 0
+	}
+	return v
 }
 
 func TextAddress(addr string) string {
@@ -42,8 +58,50 @@ type RouteStep struct {
 	Dst   string          `json:"to"`
 }
 
+// Liquidity returns the tracked liquidity of all pairs in the step.
+func (s RouteStep) Liquidity() float64 {
+	var sum float64
+	for _, pair := range s.Pairs {
+		sum += pair.Liquidity()
+	}
+	return sum
+}
+
 type TokenRoute struct {
-	Steps []RouteStep `json:"steps"`
+	Steps  []RouteStep     `json:"steps"`
+	Score  float64         `json:"-"`
+	Quotes []QuoteSnapshot `json:"quotes,omitempty"`
+}
+
+// ReverseRoute returns the route in the opposite direction, it uses the same pools
+// in every step, so it is only valid for scores that do not depend on the direction.
+func ReverseRoute(r *TokenRoute) *TokenRoute {
+	reversed := &TokenRoute{
+		Steps: make([]RouteStep, len(r.Steps)),
+		Score: r.Score,
+	}
+	for i, step := range r.Steps {
+		pairs := make([]RoutePairInfo, len(step.Pairs))
+		copy(pairs, step.Pairs)
+		reversed.Steps[len(r.Steps)-1-i] = RouteStep{
+			Pairs: pairs,
+			Src:   step.Dst,
+			Dst:   step.Src,
+		}
+	}
+	return reversed
+}
+
+// ScoreRoute scores the route with its bottleneck liquidity, the smallest step liquidity.
+func ScoreRoute(r *TokenRoute) float64 {
+	if len(r.Steps) == 0 {
+		return 0
+	}
+	score := math.MaxFloat64
+	for _, step := range r.Steps {
+		score = math.Min(score, step.Liquidity())
+	}
+	return score
 }
 
 func (r TokenRoute) String() string {
@@ -56,3 +114,16 @@ type SortTokenRoutes []*TokenRoute
 func (s SortTokenRoutes) Len() int           { return len(s) }
 func (s SortTokenRoutes) Less(i, j int) bool { return len(s[i].Steps) < len(s[j].Steps) }
 func (s SortTokenRoutes) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// SortScoredTokenRoutes sorts the shorter routes first, and the routes with the same
+// length by score, the dump ranks the routes with it.
+type SortScoredTokenRoutes []*TokenRoute
+
+func (s SortScoredTokenRoutes) Len() int      { return len(s) }
+func (s SortScoredTokenRoutes) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s SortScoredTokenRoutes) Less(i, j int) bool {
+	if len(s[i].Steps) != len(s[j].Steps) {
+		return len(s[i].Steps) < len(s[j].Steps)
+	}
+	return s[i].Score > s[j].Score
+}